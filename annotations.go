@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sensu/sensu-go/types"
+	"github.com/sensu/sensu-plugin-sdk/sensu"
+)
+
+// stdinEvent is the event read by --read-event. stdin can only be read
+// once, so a --daemon reload applies its annotations again from here.
+var stdinEvent *types.Event
+
+// readEvent reads the Sensu event the agent writes to stdin when the check
+// definition sets stdin: true, for --read-event.
+func readEvent(r io.Reader) (*types.Event, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	event := &types.Event{}
+	if err := json.Unmarshal(data, event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// applyAnnotations overrides the options with the annotations of the event
+// under keyspace, such as
+//
+//	sensu.io/plugins/check-disk-io/config/warn-read-bps: 100MiB
+//
+// The check's annotations win over the entity's, which win over flags and
+// environment variables. This is what the plugin SDK does for events it
+// reads itself; it is done here because the event is only read with
+// --read-event, so that a check run without one does not wait on stdin.
+func applyAnnotations(keyspace string, options []*sensu.PluginConfigOption, event *types.Event) error {
+	for _, opt := range options {
+		key := path.Join(keyspace, opt.Path)
+		value, ok := annotation(event, key)
+		if !ok {
+			continue
+		}
+		if err := setOption(opt, value); err != nil {
+			return fmt.Errorf("invalid annotation %s %q: %v", key, value, err)
+		}
+	}
+	return nil
+}
+
+// metricsKey is the path under the keyspace of the annotations enabling or
+// disabling one metric group each, such as
+//
+//	sensu.io/plugins/check-disk-io/config/metrics/disk_io_time: "false"
+const metricsKey = "metrics"
+
+// metricToggles returns the metric groups the annotations of the event
+// under keyspace enable (true) or disable (false). As with the options,
+// the check's annotations win over the entity's. Unknown groups and values
+// other than booleans are an error.
+func metricToggles(keyspace string, event *types.Event) (map[string]bool, error) {
+	prefix := strings.ToLower(path.Join(keyspace, metricsKey)) + "/"
+	toggles := map[string]bool{}
+	var sources []map[string]string
+	if event.Check != nil {
+		sources = append(sources, event.Check.Annotations)
+	}
+	if event.Entity != nil {
+		sources = append(sources, event.Entity.Annotations)
+	}
+	for _, annotations := range sources {
+		keys := make([]string, 0, len(annotations))
+		for k := range annotations {
+			keys = append(keys, k)
+		}
+		// Sorted, so the same bad annotation is reported on every run.
+		sort.Strings(keys)
+		for _, key := range keys {
+			if !strings.HasPrefix(strings.ToLower(key), prefix) {
+				continue
+			}
+			name := key[len(prefix):]
+			if !knownGroup(name) {
+				return nil, fmt.Errorf("invalid annotation %s, unknown metric group %q", key, name)
+			}
+			on, err := strconv.ParseBool(annotations[key])
+			if err != nil {
+				return nil, fmt.Errorf("invalid annotation %s %q, must be true or false", key, annotations[key])
+			}
+			if _, ok := toggles[name]; !ok {
+				toggles[name] = on
+			}
+		}
+	}
+	return toggles, nil
+}
+
+// annotation returns the value of the annotation key of the event's check
+// or, failing that, its entity. The key is also looked up lower-cased,
+// since annotation keys are often written that way.
+func annotation(event *types.Event, key string) (string, bool) {
+	var sources []map[string]string
+	if event.Check != nil {
+		sources = append(sources, event.Check.Annotations)
+	}
+	if event.Entity != nil {
+		sources = append(sources, event.Entity.Annotations)
+	}
+	for _, annotations := range sources {
+		for _, k := range []string{key, strings.ToLower(key)} {
+			if v := annotations[k]; len(v) > 0 {
+				return v, true
+			}
+		}
+	}
+	return "", false
+}
+
+// setOption sets an option from the string form of an annotation: strings
+// as they are, lists as a JSON array or a single value, everything else as
+// JSON, like the plugin SDK.
+func setOption(opt *sensu.PluginConfigOption, value string) error {
+	v := reflect.Indirect(reflect.ValueOf(opt.Value))
+	switch {
+	case v.Kind() == reflect.String:
+		v.SetString(value)
+		return nil
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		if err := json.Unmarshal([]byte(value), opt.Value); err == nil {
+			return nil
+		}
+		v.Set(reflect.ValueOf([]string{value}))
+		return nil
+	}
+	return json.Unmarshal([]byte(value), opt.Value)
+}
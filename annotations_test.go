@@ -0,0 +1,105 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sensu/sensu-go/types"
+	"github.com/sensu/sensu-plugin-sdk/sensu"
+)
+
+func TestReadEvent(t *testing.T) {
+	event, err := readEvent(strings.NewReader(`{"entity":{"metadata":{"name":"node1","annotations":{"a":"b"}}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Entity == nil || event.Entity.Annotations["a"] != "b" {
+		t.Errorf("readEvent() = %+v", event)
+	}
+	if _, err := readEvent(strings.NewReader("")); err == nil {
+		t.Error("readEvent accepted empty input")
+	}
+}
+
+func TestApplyAnnotations(t *testing.T) {
+	var (
+		warn    string
+		rate    bool
+		retries int
+		include []string
+		headers map[string]string
+	)
+	options := []*sensu.PluginConfigOption{
+		{Path: "warn-read-bytes", Value: &warn},
+		{Path: "rate", Value: &rate},
+		{Path: "retries", Value: &retries},
+		{Path: "fstype-include", Value: &include},
+		{Path: "otlp-header", Value: &headers},
+	}
+	warn = "10MiB"
+	event := &types.Event{
+		Check: &types.Check{ObjectMeta: types.ObjectMeta{Annotations: map[string]string{
+			"sensu.io/plugins/check-disk-io/config/warn-read-bytes": "100MiB",
+		}}},
+		Entity: &types.Entity{ObjectMeta: types.ObjectMeta{Annotations: map[string]string{
+			"sensu.io/plugins/check-disk-io/config/warn-read-bytes": "1GiB",
+			"sensu.io/plugins/check-disk-io/config/rate":            "true",
+			"sensu.io/plugins/check-disk-io/config/retries":         "3",
+			"sensu.io/plugins/check-disk-io/config/fstype-include":  `["ext4","xfs"]`,
+			"sensu.io/plugins/check-disk-io/config/otlp-header":     `{"Authorization":"Bearer x"}`,
+		}}},
+	}
+	if err := applyAnnotations("sensu.io/plugins/check-disk-io/config", options, event); err != nil {
+		t.Fatal(err)
+	}
+	// The check's annotation wins over the entity's.
+	if warn != "100MiB" {
+		t.Errorf("warn-read-bytes = %q, want 100MiB", warn)
+	}
+	if !rate || retries != 3 {
+		t.Errorf("rate = %v, retries = %d, want true and 3", rate, retries)
+	}
+	if !reflect.DeepEqual(include, []string{"ext4", "xfs"}) {
+		t.Errorf("fstype-include = %q", include)
+	}
+	if headers["Authorization"] != "Bearer x" {
+		t.Errorf("otlp-header = %v", headers)
+	}
+
+	event.Entity.Annotations["sensu.io/plugins/check-disk-io/config/retries"] = "many"
+	if err := applyAnnotations("sensu.io/plugins/check-disk-io/config", options, event); err == nil {
+		t.Error("applyAnnotations accepted a non-numeric retries")
+	}
+}
+
+func TestMetricToggles(t *testing.T) {
+	event := &types.Event{
+		Check: &types.Check{ObjectMeta: types.ObjectMeta{Annotations: map[string]string{
+			"sensu.io/plugins/check-disk-io/config/metrics/disk_io_time": "false",
+		}}},
+		Entity: &types.Entity{ObjectMeta: types.ObjectMeta{Annotations: map[string]string{
+			"sensu.io/plugins/check-disk-io/config/metrics/disk_io_time":    "true",
+			"Sensu.io/plugins/check-disk-io/config/metrics/disk_read_bytes": "true",
+			"sensu.io/plugins/check-disk-io/config/metrics":                 "disk_read_count",
+		}}},
+	}
+	toggles, err := metricToggles("sensu.io/plugins/check-disk-io/config", event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The check's annotation wins over the entity's.
+	if want := map[string]bool{"disk_io_time": false, "disk_read_bytes": true}; !reflect.DeepEqual(toggles, want) {
+		t.Errorf("metricToggles() = %v, want %v", toggles, want)
+	}
+
+	for key, value := range map[string]string{
+		"sensu.io/plugins/check-disk-io/config/metrics/disk_read_byte": "true",
+		"sensu.io/plugins/check-disk-io/config/metrics/disk_io_time":   "off",
+	} {
+		event := &types.Event{Entity: &types.Entity{ObjectMeta: types.ObjectMeta{Annotations: map[string]string{key: value}}}}
+		if _, err := metricToggles("sensu.io/plugins/check-disk-io/config", event); err == nil {
+			t.Errorf("metricToggles accepted %s: %s", key, value)
+		}
+	}
+}
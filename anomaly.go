@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/jadiunr/check-disk-io/thresholds"
+	"github.com/sensu/sensu-plugin-sdk/sensu"
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// anomalyMinSamples is the number of past runs --anomaly-factor needs before
+// it compares a device with its median; fewer runs say little about what is
+// normal for it.
+const anomalyMinSamples = 5
+
+// anomalyHistory is the recent throughput and await of a device, between
+// consecutive runs, kept for --anomaly-factor.
+type anomalyHistory struct {
+	ReadRate   []float64 `json:"read_rate,omitempty"`
+	WriteRate  []float64 `json:"write_rate,omitempty"`
+	ReadAwait  []float64 `json:"read_await,omitempty"`
+	WriteAwait []float64 `json:"write_await,omitempty"`
+}
+
+// median returns the median of values, the mean of the two middle values
+// for an even count.
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// evaluateAnomalies warns about the throughput and await of a device between
+// two samples taken elapsedMs apart that exceed factor times their median
+// over the runs in h, then appends them to h, keeping at most window values
+// per series. A series is only checked once it has anomalyMinSamples values
+// and a median above zero, so an idle device that starts working is not
+// reported.
+func evaluateAnomalies(device string, h *anomalyHistory, prev, cur disk.IOCountersStat, elapsedMs int64, factor float64, window int) []thresholds.Violation {
+	readRate, writeRate, ratesOK := thresholds.ByteRates(prev, cur, elapsedMs)
+	readAwait, readOK := thresholds.AverageLatency(prev.ReadTime, cur.ReadTime, prev.ReadCount, cur.ReadCount)
+	writeAwait, writeOK := thresholds.AverageLatency(prev.WriteTime, cur.WriteTime, prev.WriteCount, cur.WriteCount)
+	var violations []thresholds.Violation
+	for _, s := range []struct {
+		direction string
+		value     float64
+		ok        bool
+		history   *[]float64
+		unit      string
+	}{
+		{"read", readRate, ratesOK, &h.ReadRate, ""},
+		{"write", writeRate, ratesOK, &h.WriteRate, ""},
+		{"read await", readAwait, readOK, &h.ReadAwait, "ms"},
+		{"write await", writeAwait, writeOK, &h.WriteAwait, "ms"},
+	} {
+		if !s.ok {
+			continue
+		}
+		if n := len(*s.history); n >= anomalyMinSamples {
+			m := median(*s.history)
+			limit := factor * m
+			if len(s.unit) > 0 {
+				// Rounded as shown in the message.
+				limit = math.Round(limit*10) / 10
+			}
+			if m > 0 && s.value > limit {
+				violations = append(violations, thresholds.Violation{
+					State:     sensu.CheckStateWarning,
+					Device:    device,
+					Direction: s.direction,
+					Rate:      s.value,
+					Limit:     limit,
+					Unit:      s.unit,
+					Rule:      fmt.Sprintf("--anomaly-factor %s times the median of %d runs", thresholds.FormatLimit(factor), n),
+				})
+			}
+		}
+		*s.history = appendWindow(*s.history, s.value, window)
+	}
+	return violations
+}
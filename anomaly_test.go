@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+func TestMedian(t *testing.T) {
+	tests := []struct {
+		in   []float64
+		want float64
+	}{
+		{nil, 0},
+		{[]float64{3, 1, 2}, 2},
+		{[]float64{4, 1, 3, 2}, 2.5},
+	}
+	for _, tt := range tests {
+		if got := median(tt.in); got != tt.want {
+			t.Errorf("median(%v) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestEvaluateAnomalies(t *testing.T) {
+	h := &anomalyHistory{}
+	prev := disk.IOCountersStat{}
+	// 10MiB/s of writes at 2ms per write, five times.
+	normal := disk.IOCountersStat{WriteBytes: 10 << 20, WriteCount: 100, WriteTime: 200}
+	for i := 0; i < anomalyMinSamples; i++ {
+		if v := evaluateAnomalies("sda", h, prev, normal, 1000, 3, 30); len(v) != 0 {
+			t.Fatalf("evaluateAnomalies() while learning = %v, want none", v)
+		}
+	}
+	if len(h.WriteRate) != anomalyMinSamples || len(h.ReadAwait) != 0 {
+		t.Errorf("history = %+v, want %d write samples and no read await", h, anomalyMinSamples)
+	}
+
+	// 40MiB/s at 2ms: only the throughput is anomalous.
+	busy := disk.IOCountersStat{WriteBytes: 40 << 20, WriteCount: 400, WriteTime: 800}
+	v := evaluateAnomalies("sda", h, prev, busy, 1000, 3, 30)
+	if len(v) != 1 || v[0].Direction != "write" || v[0].Limit != 30<<20 {
+		t.Fatalf("evaluateAnomalies() = %v, want the write throughput above 30MiB/s", v)
+	}
+	if got, want := v[0].String(), "WARNING: sda write 40.0MiB/s exceeds 30.0MiB/s (--anomaly-factor 3 times the median of 5 runs)"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	// 10MiB/s at 8ms per write.
+	slow := disk.IOCountersStat{WriteBytes: 10 << 20, WriteCount: 100, WriteTime: 800}
+	v = evaluateAnomalies("sda", h, prev, slow, 1000, 3, 30)
+	if len(v) != 1 || v[0].Direction != "write await" || v[0].Limit != 6 || v[0].Unit != "ms" {
+		t.Errorf("evaluateAnomalies() = %v, want the write await above 6ms", v)
+	}
+	if len(h.WriteRate) != anomalyMinSamples+2 {
+		t.Errorf("%d write rate samples kept, want %d", len(h.WriteRate), anomalyMinSamples+2)
+	}
+}
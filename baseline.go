@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// Baseline is a snapshot of the counters of every reported device, taken
+// with --set-baseline.
+type Baseline struct {
+	Timestamp int64                          `json:"timestamp"`
+	Devices   map[string]disk.IOCountersStat `json:"devices"`
+}
+
+// loadBaseline reads the baseline file at path.
+func loadBaseline(path string) (*Baseline, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b := &Baseline{}
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, err
+	}
+	if b.Devices == nil {
+		b.Devices = map[string]disk.IOCountersStat{}
+	}
+	return b, nil
+}
+
+// device returns the baseline counters of the named device. It is safe to
+// call on a nil baseline.
+func (b *Baseline) device(name string) (disk.IOCountersStat, bool) {
+	if b == nil {
+		return disk.IOCountersStat{}, false
+	}
+	v, ok := b.Devices[name]
+	return v, ok
+}
+
+// saveBaseline writes the baseline file atomically.
+func saveBaseline(path string, b *Baseline) error {
+	data, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0600)
+}
+
+// sinceBaseline returns how much a counter grew since the baseline. A
+// counter below its baseline was reset (reboot, device re-added), in which
+// case everything counted since the reset is the best available answer.
+func sinceBaseline(base, cur uint64) uint64 {
+	if cur < base {
+		return cur
+	}
+	return cur - base
+}
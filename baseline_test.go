@@ -0,0 +1,37 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+func TestBaselineRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "baseline.json")
+	b := &Baseline{Timestamp: 42, Devices: map[string]disk.IOCountersStat{
+		"sda": {Name: "sda", ReadBytes: 1000},
+	}}
+	if err := saveBaseline(path, b); err != nil {
+		t.Fatal(err)
+	}
+	got, err := loadBaseline(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := got.device("sda"); !ok || v.ReadBytes != 1000 {
+		t.Errorf("device(sda) = %+v, %v", v, ok)
+	}
+	if _, ok := (*Baseline)(nil).device("sda"); ok {
+		t.Errorf("nil baseline must not report devices")
+	}
+}
+
+func TestSinceBaseline(t *testing.T) {
+	if got := sinceBaseline(100, 250); got != 150 {
+		t.Errorf("sinceBaseline(100, 250) = %d, want 150", got)
+	}
+	if got := sinceBaseline(100, 30); got != 30 {
+		t.Errorf("sinceBaseline after reset = %d, want 30", got)
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// cgroupIO is the IO one cgroup did on one block device, as read by
+// --cgroups.
+type cgroupIO struct {
+	// Cgroup is the path of the cgroup below the hierarchy root, "/" for
+	// the root cgroup.
+	Cgroup string
+	// Device is the major:minor number of the block device.
+	Device     string
+	ReadBytes  uint64
+	WriteBytes uint64
+	ReadCount  uint64
+	WriteCount uint64
+}
+
+// cgroupStats walks the cgroup hierarchy below /sys/fs/cgroup and returns
+// the IO of every cgroup and device: from io.stat on the unified (v2)
+// hierarchy, from the blkio controller's throttle files on v1.
+func cgroupStats() ([]cgroupIO, error) {
+	root := hostSys("fs", "cgroup")
+	if pathExists(filepath.Join(root, "cgroup.controllers")) {
+		return walkCgroups(root, "io.stat", func(dir string) ([]cgroupIO, error) {
+			data, err := ioutil.ReadFile(filepath.Join(dir, "io.stat"))
+			if err != nil {
+				return nil, err
+			}
+			return parseIOStat(data), nil
+		})
+	}
+	return walkCgroups(filepath.Join(root, "blkio"), "blkio.throttle.io_service_bytes", func(dir string) ([]cgroupIO, error) {
+		bytesData, err := ioutil.ReadFile(filepath.Join(dir, "blkio.throttle.io_service_bytes"))
+		if err != nil {
+			return nil, err
+		}
+		countData, err := ioutil.ReadFile(filepath.Join(dir, "blkio.throttle.io_serviced"))
+		if err != nil {
+			return nil, err
+		}
+		return parseBlkioThrottle(bytesData, countData), nil
+	})
+}
+
+// walkCgroups calls read for every cgroup below root that has the given
+// stat file and tags the results with the cgroup path. Cgroups that vanish
+// during the walk are skipped.
+func walkCgroups(root, file string, read func(dir string) ([]cgroupIO, error)) ([]cgroupIO, error) {
+	var stats []cgroupIO
+	err := filepath.Walk(root, func(dir string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && dir != root {
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() || !pathExists(filepath.Join(dir, file)) {
+			return nil
+		}
+		entries, err := read(dir)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, dir)
+		for i := range entries {
+			entries[i].Cgroup = path.Clean("/" + filepath.ToSlash(rel))
+		}
+		stats = append(stats, entries...)
+		return nil
+	})
+	return stats, err
+}
+
+// parseIOStat parses a cgroup v2 io.stat file:
+//
+//	8:0 rbytes=90430464 wbytes=299008000 rios=8950 wios=1252 dbytes=0 dios=0
+func parseIOStat(data []byte) []cgroupIO {
+	var stats []cgroupIO
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		s := cgroupIO{Device: fields[0]}
+		for _, f := range fields[1:] {
+			kv := strings.SplitN(f, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			v, err := strconv.ParseUint(kv[1], 10, 64)
+			if err != nil {
+				continue
+			}
+			switch kv[0] {
+			case "rbytes":
+				s.ReadBytes = v
+			case "wbytes":
+				s.WriteBytes = v
+			case "rios":
+				s.ReadCount = v
+			case "wios":
+				s.WriteCount = v
+			}
+		}
+		stats = append(stats, s)
+	}
+	return stats
+}
+
+// parseBlkioThrottle combines the cgroup v1 blkio.throttle.io_service_bytes
+// and blkio.throttle.io_serviced files, whose lines look like
+//
+//	8:0 Read 90430464
+//
+// into one entry per device, in the order the devices first appear.
+func parseBlkioThrottle(bytesData, countData []byte) []cgroupIO {
+	var order []string
+	byDevice := map[string]*cgroupIO{}
+	parse := func(data []byte, read, write func(*cgroupIO, uint64)) {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			// The trailing "Total <n>" line has only two fields.
+			if len(fields) != 3 {
+				continue
+			}
+			v, err := strconv.ParseUint(fields[2], 10, 64)
+			if err != nil {
+				continue
+			}
+			s, ok := byDevice[fields[0]]
+			if !ok {
+				s = &cgroupIO{Device: fields[0]}
+				byDevice[fields[0]] = s
+				order = append(order, fields[0])
+			}
+			switch fields[1] {
+			case "Read":
+				read(s, v)
+			case "Write":
+				write(s, v)
+			}
+		}
+	}
+	parse(bytesData, func(s *cgroupIO, v uint64) { s.ReadBytes = v }, func(s *cgroupIO, v uint64) { s.WriteBytes = v })
+	parse(countData, func(s *cgroupIO, v uint64) { s.ReadCount = v }, func(s *cgroupIO, v uint64) { s.WriteCount = v })
+	stats := make([]cgroupIO, 0, len(order))
+	for _, d := range order {
+		stats = append(stats, *byDevice[d])
+	}
+	return stats
+}
+
+// containerIDPattern matches the 64 hex digit ids Docker, containerd and
+// CRI-O put in the cgroup paths of their containers, such as
+// /system.slice/docker-<id>.scope or /kubepods/burstable/pod<uid>/<id>.
+var containerIDPattern = regexp.MustCompile(`[0-9a-f]{64}`)
+
+// containerID returns the container id found in a cgroup path, or "" when
+// the cgroup does not belong to a container. The last match wins so that a
+// container nested in another one is attributed to itself.
+func containerID(cgroup string) string {
+	ids := containerIDPattern.FindAllString(cgroup, -1)
+	if len(ids) == 0 {
+		return ""
+	}
+	return ids[len(ids)-1]
+}
+
+// blockDeviceName returns the kernel name of the block device with the given
+// major:minor number from the /sys/dev/block links, or the number itself
+// when it cannot be resolved.
+func blockDeviceName(majorMinor string) string {
+	path, err := filepath.EvalSymlinks(hostSys("dev", "block", majorMinor))
+	if err != nil {
+		return majorMinor
+	}
+	return filepath.Base(path)
+}
+
+// cgroupGroups are the metric groups of --cgroups with the value of each.
+var cgroupGroups = []struct {
+	Name    string
+	Comment string
+	Value   func(cgroupIO) uint64
+}{
+	{"disk_cgroup_read_bytes", "This is the total number of bytes the cgroup read from the device.", func(s cgroupIO) uint64 { return s.ReadBytes }},
+	{"disk_cgroup_write_bytes", "This is the total number of bytes the cgroup wrote to the device.", func(s cgroupIO) uint64 { return s.WriteBytes }},
+	{"disk_cgroup_read_count", "This is the total number of read IOs the cgroup issued to the device.", func(s cgroupIO) uint64 { return s.ReadCount }},
+	{"disk_cgroup_write_count", "This is the total number of write IOs the cgroup issued to the device.", func(s cgroupIO) uint64 { return s.WriteCount }},
+}
+
+// addCgroupMetrics adds the samples of stats to the --cgroups groups, in
+// cgroup order, tagging container cgroups with their container_id.
+func addCgroupMetrics(groups map[string]*MetricGroup, stats []cgroupIO) {
+	sort.SliceStable(stats, func(i, j int) bool { return stats[i].Cgroup < stats[j].Cgroup })
+	for _, s := range stats {
+		tags := map[string]string{"cgroup": s.Cgroup, "device": deviceIdentifier(blockDeviceName(s.Device))}
+		if id := containerID(s.Cgroup); len(id) > 0 {
+			tags["container_id"] = id
+		}
+		for _, g := range cgroupGroups {
+			groups[g.Name].AddIntMetric(tags, g.Value(s))
+		}
+	}
+}
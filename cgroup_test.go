@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseIOStat(t *testing.T) {
+	data := []byte("8:0 rbytes=90430464 wbytes=299008000 rios=8950 wios=1252 dbytes=0 dios=0\n253:0 rbytes=4096 wbytes=0 rios=1 wios=0 dbytes=0 dios=0\n")
+	want := []cgroupIO{
+		{Device: "8:0", ReadBytes: 90430464, WriteBytes: 299008000, ReadCount: 8950, WriteCount: 1252},
+		{Device: "253:0", ReadBytes: 4096, ReadCount: 1},
+	}
+	if got := parseIOStat(data); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseIOStat() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseBlkioThrottle(t *testing.T) {
+	bytesData := []byte("8:0 Read 8192\n8:0 Write 4096\n8:0 Sync 0\n8:0 Async 12288\n8:0 Total 12288\n8:16 Read 512\n8:16 Write 0\nTotal 12800\n")
+	countData := []byte("8:0 Read 2\n8:0 Write 1\n8:0 Total 3\n8:16 Read 1\n8:16 Write 0\nTotal 4\n")
+	want := []cgroupIO{
+		{Device: "8:0", ReadBytes: 8192, WriteBytes: 4096, ReadCount: 2, WriteCount: 1},
+		{Device: "8:16", ReadBytes: 512, ReadCount: 1},
+	}
+	if got := parseBlkioThrottle(bytesData, countData); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseBlkioThrottle() = %+v, want %+v", got, want)
+	}
+}
+
+func TestContainerID(t *testing.T) {
+	id := "3f6c1d6e8a1b4c0e9d2f7a5b6c8d9e0f1a2b3c4d5e6f7a8b9c0d1e2f3a4b5c6d"
+	tests := map[string]string{
+		"/system.slice/docker-" + id + ".scope":                             id,
+		"/kubepods/burstable/pod1b2c3d4e-1111-2222-3333-444455556666/" + id: id,
+		"/docker/" + id:              id,
+		"/system.slice/sshd.service": "",
+		"/":                          "",
+	}
+	for in, want := range tests {
+		if got := containerID(in); got != want {
+			t.Errorf("containerID(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestCgroupStats(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("HOST_SYS", root)
+	writeSysFile(t, root, "fs/cgroup/cgroup.controllers", "cpu io memory\n")
+	writeSysFile(t, root, "fs/cgroup/io.stat", "8:0 rbytes=100 wbytes=200 rios=1 wios=2 dbytes=0 dios=0\n")
+	writeSysFile(t, root, "fs/cgroup/system.slice/docker-abc.scope/io.stat", "8:0 rbytes=10 wbytes=20 rios=3 wios=4 dbytes=0 dios=0\n")
+	writeSysFile(t, root, "fs/cgroup/user.slice/cgroup.procs", "")
+	stats, err := cgroupStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []cgroupIO{
+		{Cgroup: "/", Device: "8:0", ReadBytes: 100, WriteBytes: 200, ReadCount: 1, WriteCount: 2},
+		{Cgroup: "/system.slice/docker-abc.scope", Device: "8:0", ReadBytes: 10, WriteBytes: 20, ReadCount: 3, WriteCount: 4},
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("cgroupStats() = %+v, want %+v", stats, want)
+	}
+
+	// cgroup v1 keeps the counters in the blkio hierarchy.
+	root = t.TempDir()
+	t.Setenv("HOST_SYS", root)
+	writeSysFile(t, root, "fs/cgroup/blkio/docker/x/blkio.throttle.io_service_bytes", "8:0 Read 4096\n8:0 Write 0\nTotal 4096\n")
+	writeSysFile(t, root, "fs/cgroup/blkio/docker/x/blkio.throttle.io_serviced", "8:0 Read 1\n8:0 Write 0\nTotal 1\n")
+	stats, err = cgroupStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []cgroupIO{{Cgroup: "/docker/x", Device: "8:0", ReadBytes: 4096, ReadCount: 1}}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("cgroupStats() = %+v, want %+v", stats, want)
+	}
+}
+
+func TestBlockDeviceName(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("HOST_SYS", root)
+	writeSysFile(t, root, "devices/virtual/block/dm-0/dev", "253:0\n")
+	if err := os.MkdirAll(filepath.Join(root, "dev", "block"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../../devices/virtual/block/dm-0", filepath.Join(root, "dev", "block", "253:0")); err != nil {
+		t.Fatal(err)
+	}
+	if got := blockDeviceName("253:0"); got != "dm-0" {
+		t.Errorf("blockDeviceName(253:0) = %q, want dm-0", got)
+	}
+	if got := blockDeviceName("8:0"); got != "8:0" {
+		t.Errorf("blockDeviceName(8:0) = %q, want 8:0", got)
+	}
+}
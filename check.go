@@ -0,0 +1,1290 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jadiunr/check-disk-io/collector"
+	"github.com/jadiunr/check-disk-io/output"
+	"github.com/jadiunr/check-disk-io/thresholds"
+	"github.com/sensu/sensu-plugin-sdk/sensu"
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// diskCheck is one run of the check. Collect reads the devices into metric
+// groups; evaluate, finish, write and result then report on them, render
+// them and turn the collection errors into the check state.
+type diskCheck struct {
+	// start is when the run began, for disk_io_collect_duration_seconds.
+	start time.Time
+	// now is the time of the run in the state file and the Graphite
+	// output, and timestamp the Timestamp of every sample of the run.
+	now       time.Time
+	timestamp int64
+	// failed records whether any collection or persistence step failed,
+	// for disk_io_scrape_success.
+	failed     bool
+	collection collectionErrors
+	violations []thresholds.Violation
+	// loads are the devices ranked by the --summary-top line.
+	loads []deviceLoad
+	// state is the state file, nil when no option uses it, and updated
+	// the devices this run recorded in it.
+	state   *State
+	updated map[string]bool
+	// host is the host tag, also the host.name of the OTLP resource; it is
+	// empty with --no-hostname.
+	host string
+}
+
+// Collect reads the partitions and IO counters and everything derived from
+// them, records the run in the state and baseline files, and returns the
+// metric groups sorted by name. A step that fails only marks the run as
+// failed; the error is for failures that stop the run.
+func (d *diskCheck) Collect() ([]MetricGroup, error) {
+	failed := false
+	enrichments = enrichmentStatus{}
+	// Before anything reads /proc or /sys.
+	if err := exportHostRoots(plugin.HostProc, plugin.HostSys); err != nil {
+		return nil, fmt.Errorf("failed to set the host roots: %v", err)
+	}
+	// timestamp is the Timestamp of every sample of this run.
+	var timestamp int64
+	if !plugin.NoTimestamp {
+		timestamp = time.Now().UnixMilli()
+	}
+
+	if plugin.WithCloudTags {
+		instance, err := lookupCloudInstance(plugin.Cloud)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to get cloud instance metadata, skipping cloud tags, error: %v\n", err)
+		}
+		enrichments.record("cloud", err == nil)
+		cloudTags = instance.tags()
+	}
+
+	deviceIdentifiers = nil
+	if plugin.DeviceIdentifier != identifierKernel {
+		var err error
+		deviceIdentifiers, err = stableNames(plugin.DeviceIdentifier)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read /dev/disk/%s, using kernel names, error: %v\n", plugin.DeviceIdentifier, err)
+		}
+		enrichments.record(plugin.DeviceIdentifier, len(deviceIdentifiers) > 0)
+	}
+	if plugin.ResolveDMNames {
+		names, err := dmNames()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read device-mapper names, using kernel names, error: %v\n", err)
+		}
+		if deviceIdentifiers == nil {
+			deviceIdentifiers = map[string]string{}
+		}
+		// The device-mapper name wins over a udev name for dm devices.
+		for device, name := range names {
+			deviceIdentifiers[device] = name
+		}
+	}
+
+	c := newCollector()
+	if plugin.Retries > 0 {
+		c = collector.Retry{Collector: c, Retries: plugin.Retries, Delay: plugin.retryDelay}
+	}
+	if plugin.timeout > 0 {
+		// The deadline covers the retries too.
+		ctx, cancel := context.WithTimeout(context.Background(), plugin.timeout)
+		defer cancel()
+		c = collector.Context{Collector: c, Ctx: ctx}
+	}
+	var collection collectionErrors
+	var parts []disk.PartitionStat
+	var err error
+	// first is the earlier of the two samples --rate compares, and
+	// inFlightPeaks the most IOs in flight seen per device in between.
+	var first map[string]disk.IOCountersStat
+	var inFlightPeaks map[string]uint64
+	// subSeries holds the sub-interval values of --sub-sample-interval.
+	var subSeries map[string]*subSampleSeries
+	if plugin.Rate {
+		first, err = c.IOCounters()
+		collection.recordFirstSample(first, err)
+		if err != nil {
+			failed = true
+			fmt.Fprintf(os.Stderr, "Failed to get IO counters for the first --rate sample, error: %v\n", err)
+		}
+		switch {
+		case plugin.subSampleInterval > 0:
+			// The sub-samples also provide the IOs in flight peaks.
+			snapshots := collector.Snapshots(c, plugin.interval, plugin.subSampleInterval)
+			subSeries = subSamples(first, snapshots)
+			inFlightPeaks = map[string]uint64{}
+			for _, snap := range snapshots {
+				for name, s := range snap.Stats {
+					if s.IopsInProgress > inFlightPeaks[name] {
+						inFlightPeaks[name] = s.IopsInProgress
+					}
+				}
+			}
+		case plugin.IopsWarning > 0 || plugin.IopsCritical > 0:
+			inFlightPeaks = collector.PeakInFlight(c, plugin.interval)
+		default:
+			time.Sleep(plugin.interval)
+		}
+		if inFlightPeaks != nil {
+			for name, s := range first {
+				if s.IopsInProgress > inFlightPeaks[name] {
+					inFlightPeaks[name] = s.IopsInProgress
+				}
+			}
+		}
+	}
+	parts, err = c.Partitions(false)
+	if err != nil {
+		failed = true
+		if plugin.AllDevices {
+			// Only the mountpoint tags are lost.
+			fmt.Fprintf(os.Stderr, "Failed to get partitions, reporting all devices without mountpoints, error: %v\n", err)
+		} else {
+			collection.partitions = err
+			fmt.Fprintf(os.Stderr, "Failed to get partitions, error: %v\n", err)
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			collection.timeouts++
+		}
+	}
+	mdMemberArrays = nil
+	if plugin.WithMdArrays || plugin.MdRollup {
+		mdMemberArrays, err = mdMembers()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read /proc/mdstat, error: %v\n", err)
+		}
+	}
+	mountFstypes = map[string]string{}
+	deviceMetadataCache = map[string]deviceMetadata{}
+	for _, p := range parts {
+		mountFstypes[p.Mountpoint] = p.Fstype
+	}
+
+	metricGroups := map[string]*MetricGroup{}
+	for _, b := range collector.Counters {
+		if groupSupported(b.Name) && groupNeeded(b.Name, plugin.metrics) {
+			metricGroups[b.Name] = &MetricGroup{Name: b.Name, Type: b.Type, Comment: b.Comment}
+		}
+	}
+
+	if len(plugin.Devices) > 0 {
+		metricGroups["disk_io_up"] = &MetricGroup{
+			Name:    "disk_io_up",
+			Type:    "GAUGE",
+			Comment: "This value is 1 when the IO counters of a device given with --device could be read, 0 when the device is absent.",
+		}
+	}
+
+	if plugin.WithDeviceInfo {
+		metricGroups["disk_io_device_info"] = &MetricGroup{
+			Name:    "disk_io_device_info",
+			Type:    "GAUGE",
+			Comment: "This value is always 1, the labels carry the serial number and label of the device.",
+		}
+	}
+
+	for _, dir := range []string{"read", "write"} {
+		name := "disk_" + dir + "_wait_ms"
+		if groupSupported(name) {
+			metricGroups[name] = &MetricGroup{
+				Name:    name,
+				Type:    "GAUGE",
+				Comment: "This value is the average time in milliseconds spent per " + dir + " since boot: disk_" + dir + "_time / disk_" + dir + "_count, 0 before the first " + dir + ".",
+			}
+		}
+	}
+
+	if plugin.WithMergeRatio {
+		for _, dir := range []string{"read", "write"} {
+			name := "disk_" + dir + "_merge_ratio"
+			if !groupSupported(name) {
+				continue
+			}
+			metricGroups[name] = &MetricGroup{
+				Name:    name,
+				Type:    "GAUGE",
+				Comment: "This value is the share of " + dir + " requests that were merged with an adjacent one before reaching the device, since boot: merged / (completed + merged).",
+			}
+		}
+	}
+
+	if plugin.subSampleInterval > 0 {
+		for _, g := range subSampleGroups {
+			if groupSupported(g.Name) {
+				metricGroups[g.Name] = &MetricGroup{Name: g.Name, Type: "GAUGE", Comment: g.Comment}
+			}
+		}
+		if groupSupported(subSampleAwaitGroup) {
+			metricGroups[subSampleAwaitGroup] = &MetricGroup{
+				Name:    subSampleAwaitGroup,
+				Type:    "GAUGE",
+				Comment: "This value is the number of sub-intervals of --sub-sample-interval in this run in which the IOs completed took le seconds or less on average.",
+			}
+		}
+	}
+
+	if plugin.WithUsage {
+		for _, g := range usageGroups {
+			if groupSupported(g.Name) {
+				metricGroups[g.Name] = &MetricGroup{Name: g.Name, Type: "GAUGE", Comment: g.Comment}
+			}
+		}
+	}
+
+	if plugin.WithIowait && groupSupported("disk_iowait_contribution_ms") {
+		metricGroups["disk_iowait_contribution_ms"] = &MetricGroup{
+			Name:    "disk_iowait_contribution_ms",
+			Type:    "GAUGE",
+			Comment: "This value estimates the milliseconds of CPU iowait caused by the device since the previous run, from its weighted IO time capped at the available CPU time.",
+		}
+	}
+
+	if plugin.WithIostat {
+		for name, comment := range map[string]string{
+			"disk_util_percent":      "This value is the percentage of the time since the previous run during which the device had IOs in flight (iostat %util).",
+			"disk_read_await_ms":     "This value is the average time in milliseconds per read completed since the previous run, queueing included (iostat r_await).",
+			"disk_write_await_ms":    "This value is the average time in milliseconds per write completed since the previous run, queueing included (iostat w_await).",
+			"disk_avg_request_bytes": "This value is the average size in bytes of the requests completed since the previous run (iostat avgrq-sz).",
+			"disk_avg_queue_size":    "This value is the average number of requests in flight since the previous run (iostat avgqu-sz).",
+		} {
+			if groupSupported(name) {
+				metricGroups[name] = &MetricGroup{Name: name, Type: "GAUGE", Comment: comment}
+			}
+		}
+	}
+
+	if plugin.WithPerQueue {
+		metricGroups["disk_queue_issued"] = &MetricGroup{
+			Name:    "disk_queue_issued",
+			Type:    "COUNTER",
+			Comment: "This is the total number of requests dispatched to the driver by a blk-mq hardware queue.",
+		}
+		metricGroups["disk_queue_completed"] = &MetricGroup{
+			Name:    "disk_queue_completed",
+			Type:    "COUNTER",
+			Comment: "This is the total number of requests completed by a blk-mq hardware queue.",
+		}
+	}
+
+	if plugin.Smart && groupSupported("disk_smart_attribute_value") {
+		for _, n := range nvmeGroups {
+			metricGroups[n.Name] = &MetricGroup{Name: n.Name, Type: n.Type, Comment: n.Comment}
+		}
+		metricGroups["disk_smart_attribute_value"] = &MetricGroup{
+			Name:    "disk_smart_attribute_value",
+			Type:    "GAUGE",
+			Comment: "This value is the normalized value of an ATA SMART attribute, which the vendor lowers towards its threshold as the attribute degrades.",
+		}
+		metricGroups["disk_smart_attribute_raw"] = &MetricGroup{
+			Name:    "disk_smart_attribute_raw",
+			Type:    "GAUGE",
+			Comment: "This value is the raw value of an ATA SMART attribute, whose meaning depends on the attribute and the vendor.",
+		}
+	}
+
+	if groupSupported("disk_io_parse_suspect") {
+		metricGroups["disk_io_parse_suspect"] = &MetricGroup{
+			Name:    "disk_io_parse_suspect",
+			Type:    "GAUGE",
+			Comment: "This value is 1 when the device reports completed IOs but all of its time counters are zero, which usually means /proc/diskstats was not parsed correctly.",
+		}
+	}
+
+	if plugin.DetectStuck && groupSupported("disk_io_stuck") {
+		metricGroups["disk_io_stuck"] = &MetricGroup{
+			Name:    "disk_io_stuck",
+			Type:    "GAUGE",
+			Comment: "This value is 1 when the counters of the device did not change for --stuck-threshold consecutive runs while IOs were in flight.",
+		}
+	}
+
+	if plugin.WithLatencyPercentiles {
+		for _, name := range []string{"disk_read_latency_p50_ms", "disk_read_latency_p95_ms", "disk_write_latency_p50_ms", "disk_write_latency_p95_ms"} {
+			if !groupSupported(name) {
+				continue
+			}
+			metricGroups[name] = &MetricGroup{
+				Name:    name,
+				Type:    "GAUGE",
+				Comment: "Percentile of the average per-IO latency in milliseconds observed over the last runs of this check.",
+			}
+		}
+	}
+
+	var baseline *Baseline
+	newBaseline := &Baseline{Timestamp: time.Now().Unix(), Devices: map[string]disk.IOCountersStat{}}
+	if len(plugin.BaselineFile) > 0 && !plugin.SetBaseline {
+		baseline, err = loadBaseline(plugin.BaselineFile)
+		if err != nil {
+			failed = true
+			fmt.Fprintf(os.Stderr, "Failed to load baseline file, run with --set-baseline first, error: %v\n", err)
+		}
+	}
+	if baseline != nil {
+		for _, b := range collector.Counters {
+			g, ok := metricGroups[b.Name]
+			if !ok || g.Type != "COUNTER" {
+				continue
+			}
+			name := b.Name + "_since_baseline"
+			metricGroups[name] = &MetricGroup{
+				Name:    name,
+				Type:    "COUNTER",
+				Comment: "Increase of " + b.Name + " since the baseline was set with --set-baseline.",
+			}
+		}
+	}
+
+	for _, b := range collector.Counters {
+		g, ok := metricGroups[b.Name]
+		if !ok || g.Type != "COUNTER" {
+			continue
+		}
+		if plugin.EmitDelta {
+			metricGroups[b.Name+"_delta"] = &MetricGroup{
+				Name:    b.Name + "_delta",
+				Type:    "GAUGE",
+				Comment: "Increase of " + b.Name + " since the previous run, 0 after a counter reset.",
+			}
+		}
+		if plugin.EmitRate {
+			metricGroups[b.Name+"_per_sec"] = &MetricGroup{
+				Name:    b.Name + "_per_sec",
+				Type:    "GAUGE",
+				Comment: "Per-second rate of " + b.Name + " since the previous run, 0 after a counter reset.",
+			}
+		}
+	}
+
+	rateSuffix := "_rate_" + windowSuffix(plugin.rateWindow)
+	if plugin.rateWindow > 0 {
+		for _, b := range collector.Counters {
+			g, ok := metricGroups[b.Name]
+			if !ok || g.Type != "COUNTER" {
+				continue
+			}
+			name := b.Name + rateSuffix
+			metricGroups[name] = &MetricGroup{
+				Name:    name,
+				Type:    "GAUGE",
+				Comment: "Per-second rate of " + b.Name + " averaged over the last " + windowSuffix(plugin.rateWindow) + ", computed from the state file history.",
+			}
+		}
+	}
+
+	// With --rate the counter groups carry the per-second rate over
+	// --interval, which is a gauge.
+	rateGroups := map[string]bool{}
+	if plugin.Rate {
+		for _, b := range collector.Counters {
+			g, ok := metricGroups[b.Name]
+			if !ok || g.Type != "COUNTER" {
+				continue
+			}
+			g.Type = "GAUGE"
+			g.Comment += " With --rate, the value is the per-second rate over --interval."
+			rateGroups[b.Name] = true
+		}
+	}
+
+	now := time.Now()
+	var state *State
+	if useState() {
+		if daemonState != nil {
+			state = daemonState
+		} else if state, err = loadState(plugin.StateFile); err != nil {
+			failed = true
+			fmt.Fprintf(os.Stderr, "Failed to load state file, starting over, error: %v\n", err)
+		}
+		metricGroups["disk_io_device_reappeared"] = &MetricGroup{
+			Name:    "disk_io_device_reappeared",
+			Type:    "GAUGE",
+			Comment: "This value is 1 in the run in which a device that was absent from the previous runs is seen again, its state having been reset.",
+		}
+		metricGroups["disk_io_counter_resets_total"] = &MetricGroup{
+			Name:    "disk_io_counter_resets_total",
+			Type:    "COUNTER",
+			Comment: "This value counts the runs in which the counters of a device went backwards, after a driver reload or a live migration for example, persisted in the state file.",
+		}
+	}
+	reappeared := map[string]bool{}
+	updated := map[string]bool{}
+	// reported holds the devices that made it past the filters, for
+	// disk_io_devices_filtered.
+	reported := map[string]bool{}
+	var violations []thresholds.Violation
+	// loads are the devices ranked by the --summary-top line.
+	var loads []deviceLoad
+	iowait := map[string]float64{}
+	iostat := map[string]map[string]float64{}
+	// deltas holds the counter increases since the previous run and the
+	// seconds elapsed in between, for --emit-delta and --emit-rate.
+	deltas := map[string]map[string]uint64{}
+	elapsed := map[string]float64{}
+	sloBreached := false
+	infos := deviceInfoCache{}
+	infoDone := map[string]bool{}
+	iopsChecked := map[string]bool{}
+	queuesDone := map[string]bool{}
+	smartDone := map[string]bool{}
+	usageDone := map[string]bool{}
+
+	// evaluateRates checks the throughput and IOPS of a device between two
+	// samples against the thresholds and computes its --with-iostat values,
+	// once per device.
+	rateEvaluated := map[string]bool{}
+	evaluateRates := func(name string, prev, cur disk.IOCountersStat, elapsedMs int64) {
+		if rateEvaluated[name] {
+			return
+		}
+		rateEvaluated[name] = true
+		readRate, writeRate, bytesOK := thresholds.ByteRates(prev, cur, elapsedMs)
+		readIops, writeIops, iopsOK := thresholds.IopsRates(prev, cur, elapsedMs)
+		rules := plugin.rateThresholds
+		if limits, ok := plugin.deviceThresholds[name]; ok {
+			// A --device-threshold entry replaces the byte rate rules.
+			rules.ReadBpsWarn, rules.ReadBpsCrit, rules.WriteBpsWarn, rules.WriteBpsCrit = nil, nil, nil, nil
+			if bytesOK {
+				violations = append(violations, thresholds.EvaluateLimits(name, limits, readRate, writeRate)...)
+			}
+		}
+		if bytesOK && iopsOK {
+			violations = append(violations, thresholds.EvaluateRules(name, rules, readRate, writeRate, readIops, writeIops)...)
+		}
+		violations = append(violations, thresholds.EvaluateAwait(name, rules, prev, cur)...)
+		violations = append(violations, thresholds.EvaluateQueueDepth(name, rules, prev, cur, elapsedMs)...)
+		if plugin.SummaryTop > 0 {
+			if load, ok := loadOf(name, prev, cur, elapsedMs); ok {
+				loads = append(loads, load)
+			}
+		}
+		if plugin.WithIostat {
+			if values, ok := iostatValues(prev, cur, float64(elapsedMs)); ok {
+				iostat[name] = values
+			}
+		}
+	}
+
+	record := func(v disk.IOCountersStat, mountpoint string) {
+		prev, sampled := first[v.Name]
+		if plugin.Rate && !sampled {
+			fmt.Fprintf(os.Stderr, "Device %s appeared between the two --rate samples, skipping it\n", v.Name)
+			return
+		}
+		reported[v.Name] = true
+		// A reset between the two --rate samples leaves nothing to compute
+		// a rate from: the rates are reported as 0 and, the device being
+		// marked as evaluated, no threshold is checked.
+		rateReset := plugin.Rate && counterReset(prev, v)
+		if rateReset && !rateEvaluated[v.Name] {
+			rateEvaluated[v.Name] = true
+			fmt.Fprintf(os.Stderr, "Counters of device %s went backwards between the two --rate samples, reporting rates of 0\n", v.Name)
+		}
+		if plugin.Rate {
+			evaluateRates(v.Name, prev, v, plugin.interval.Milliseconds())
+		}
+		tags := deviceTags(v.Name, mountpoint)
+		if state != nil {
+			ds, found := state.Devices[v.Name]
+			if found && ds.Absent {
+				// The counters of a hotplugged device restart from zero,
+				// so nothing from before its absence is comparable.
+				found = false
+				reappeared[v.Name] = true
+			}
+			if !found {
+				ds = &DeviceState{}
+				state.Devices[v.Name] = ds
+			}
+			// Under the primary multi-mount policy the counters of the
+			// other mountpoints are zero, and so are their deltas.
+			zeroed := updated[v.Name] && plugin.MultiMountPolicy == multiMountPrimary
+			if !updated[v.Name] {
+				nowMs := now.UnixNano() / int64(time.Millisecond)
+				if found && ds.Time > 0 && counterReset(ds.Counters, v) {
+					// Nothing from before the reset is comparable, so
+					// the device starts over from this sample and its
+					// deltas are 0, as the counters cannot tell how much
+					// was done in between.
+					fmt.Fprintf(os.Stderr, "Counters of device %s went backwards since the previous run, starting over\n", v.Name)
+					if (plugin.EmitDelta || plugin.EmitRate) && nowMs > ds.Time {
+						d := map[string]uint64{}
+						for _, b := range collector.Counters {
+							if g, ok := metricGroups[b.Name]; ok && g.Type == "COUNTER" {
+								d[b.Name] = 0
+							}
+						}
+						deltas[v.Name] = d
+						elapsed[v.Name] = float64(nowMs-ds.Time) / 1000
+					}
+					ds = &DeviceState{Resets: ds.Resets + 1}
+					state.Devices[v.Name] = ds
+					found = false
+				}
+				if found && plugin.WithLatencyPercentiles {
+					updateLatencyHistory(ds, v, plugin.LatencyWindow)
+				}
+				if found && ds.Time > 0 {
+					if readRate, writeRate, ok := thresholds.ByteRates(ds.Counters, v, nowMs-ds.Time); ok && plugin.SuggestThresholds {
+						ds.ReadRate = appendWindow(ds.ReadRate, readRate, plugin.ThroughputHistory)
+						ds.WriteRate = appendWindow(ds.WriteRate, writeRate, plugin.ThroughputHistory)
+					}
+					if !plugin.Rate {
+						evaluateRates(v.Name, ds.Counters, v, nowMs-ds.Time)
+					}
+					if plugin.AnomalyFactor > 0 {
+						if ds.Anomaly == nil {
+							ds.Anomaly = &anomalyHistory{}
+						}
+						violations = append(violations, evaluateAnomalies(v.Name, ds.Anomaly, ds.Counters, v, nowMs-ds.Time, plugin.AnomalyFactor, plugin.AnomalyWindow)...)
+					}
+				}
+				if plugin.LatencySLOMs > 0 && found && breachesLatencySLO(ds.Counters, v, plugin.LatencySLOMs) {
+					fmt.Fprintf(os.Stderr, "Device %s breached the latency SLO of %dms\n", v.Name, plugin.LatencySLOMs)
+					sloBreached = true
+				}
+				if (plugin.EmitDelta || plugin.EmitRate) && found && ds.Time > 0 && nowMs > ds.Time {
+					d := map[string]uint64{}
+					for _, b := range collector.Counters {
+						if g, ok := metricGroups[b.Name]; ok && g.Type == "COUNTER" {
+							d[b.Name] = clampedDelta(b.Value(ds.Counters), b.Value(v))
+						}
+					}
+					deltas[v.Name] = d
+					elapsed[v.Name] = float64(nowMs-ds.Time) / 1000
+				}
+				if plugin.WithIowait && found && ds.Time > 0 {
+					if ms, ok := iowaitContribution(ds.Counters.WeightedIO, v.WeightedIO, float64(nowMs-ds.Time), runtime.NumCPU()); ok {
+						iowait[v.Name] = ms
+					}
+				}
+				if plugin.rateWindow > 0 {
+					cur := windowSample{Time: nowMs, Values: map[string]uint64{}}
+					for _, b := range collector.Counters {
+						if _, ok := metricGroups[b.Name+rateSuffix]; ok {
+							cur.Values[b.Name] = b.Value(v)
+						}
+					}
+					ds.Window = updateWindow(ds.Window, cur, plugin.rateWindow)
+				}
+				if found && plugin.DetectStuck && updateStuck(ds, v, plugin.StuckThreshold) {
+					fmt.Fprintf(os.Stderr, "Device %s looks stuck: counters unchanged for %d runs with IOs in flight\n", v.Name, ds.Unchanged)
+				}
+				ds.Counters = v
+				ds.Time = nowMs
+				updated[v.Name] = true
+			}
+			reappearedValue := 0.0
+			if reappeared[v.Name] {
+				reappearedValue = 1
+			}
+			metricGroups["disk_io_device_reappeared"].AddMetric(tags, reappearedValue)
+			metricGroups["disk_io_counter_resets_total"].AddIntMetric(tags, ds.Resets)
+			for _, b := range collector.Counters {
+				g, ok := metricGroups[b.Name+rateSuffix]
+				if !ok {
+					continue
+				}
+				if rate, ok := windowRate(ds.Window, b.Name, plugin.rateWindow); ok {
+					g.AddMetric(tags, rate)
+				}
+			}
+			for name, delta := range deltas[v.Name] {
+				if zeroed {
+					delta = 0
+				}
+				if g, ok := metricGroups[name+"_delta"]; ok {
+					g.AddIntMetric(tags, delta)
+				}
+				if g, ok := metricGroups[name+"_per_sec"]; ok {
+					g.AddMetric(tags, float64(delta)/elapsed[v.Name])
+				}
+			}
+			if ms, ok := iowait[v.Name]; ok {
+				metricGroups["disk_iowait_contribution_ms"].AddMetric(tags, ms)
+			}
+			if plugin.DetectStuck {
+				stuck := 0.0
+				if ds.Unchanged >= plugin.StuckThreshold {
+					stuck = 1
+				}
+				metricGroups["disk_io_stuck"].AddMetric(tags, stuck)
+			}
+			if plugin.WithLatencyPercentiles {
+				if len(ds.ReadLatency) > 0 {
+					metricGroups["disk_read_latency_p50_ms"].AddMetric(tags, percentile(ds.ReadLatency, 50))
+					metricGroups["disk_read_latency_p95_ms"].AddMetric(tags, percentile(ds.ReadLatency, 95))
+				}
+				if len(ds.WriteLatency) > 0 {
+					metricGroups["disk_write_latency_p50_ms"].AddMetric(tags, percentile(ds.WriteLatency, 50))
+					metricGroups["disk_write_latency_p95_ms"].AddMetric(tags, percentile(ds.WriteLatency, 95))
+				}
+			}
+		}
+		if g, ok := metricGroups["disk_io_up"]; ok {
+			g.AddMetric(tags, 1)
+		}
+		if (plugin.IopsWarning > 0 || plugin.IopsCritical > 0) && !iopsChecked[v.Name] {
+			iopsChecked[v.Name] = true
+			inFlight := v.IopsInProgress
+			if peak := inFlightPeaks[v.Name]; peak > inFlight {
+				inFlight = peak
+			}
+			if violation, ok := thresholds.CheckIopsInProgress(v.Name, inFlight, plugin.IopsWarning, plugin.IopsCritical); ok {
+				violations = append(violations, violation)
+			}
+		}
+		if g, ok := metricGroups["disk_io_device_info"]; ok {
+			if !infoDone[v.Name] {
+				infoDone[v.Name] = true
+				info := infos.lookup(v.Name)
+				g.AddMetric(map[string]string{"device": deviceIdentifier(v.Name), "serial": info.Serial, "label": info.Label}, 1)
+			}
+		}
+		if plugin.WithPerQueue {
+			if d := diskOf(v.Name); !queuesDone[d] {
+				queues := deviceQueues(d, plugin.MaxQueues)
+				enrichments.record("queues", len(queues) > 0)
+				for _, q := range queues {
+					qtags := map[string]string{"device": deviceIdentifier(d), "queue": strconv.Itoa(q.Index)}
+					metricGroups["disk_queue_issued"].AddIntMetric(qtags, q.Issued)
+					metricGroups["disk_queue_completed"].AddIntMetric(qtags, q.Completed)
+				}
+				queuesDone[d] = true
+			}
+		}
+		if _, ok := metricGroups["disk_smart_attribute_value"]; ok {
+			if d := diskOf(v.Name); !smartDone[d] {
+				smartDone[d] = true
+				data, err := readSMART(d)
+				enrichments.record("smart", err == nil)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to read SMART data of %s, error: %v\n", d, err)
+				}
+				addSMARTMetrics(metricGroups, deviceIdentifier(d), data)
+			}
+		}
+		for _, b := range collector.Counters {
+			g, ok := metricGroups[b.Name]
+			if !ok {
+				continue
+			}
+			if rateGroups[b.Name] {
+				rate := 0.0
+				if !rateReset {
+					rate = float64(clampedDelta(b.Value(prev), b.Value(v))) / plugin.interval.Seconds()
+				}
+				g.AddMetric(tags, rate)
+				continue
+			}
+			g.AddIntMetric(tags, b.Value(v))
+		}
+		for name, value := range iostat[v.Name] {
+			if g, ok := metricGroups[name]; ok {
+				g.AddMetric(tags, value)
+			}
+		}
+		if s, ok := subSeries[v.Name]; ok {
+			addSubSampleMetrics(metricGroups, tags, s)
+		}
+		if _, ok := newBaseline.Devices[v.Name]; !ok {
+			newBaseline.Devices[v.Name] = v
+		}
+		if base, ok := baseline.device(v.Name); ok {
+			for _, b := range collector.Counters {
+				if g, ok := metricGroups[b.Name+"_since_baseline"]; ok {
+					g.AddIntMetric(tags, sinceBaseline(b.Value(base), b.Value(v)))
+				}
+			}
+		}
+		if g, ok := metricGroups["disk_read_wait_ms"]; ok {
+			g.AddMetric(tags, averageWait(v.ReadTime, v.ReadCount))
+			metricGroups["disk_write_wait_ms"].AddMetric(tags, averageWait(v.WriteTime, v.WriteCount))
+		}
+		if g, ok := metricGroups["disk_read_merge_ratio"]; ok {
+			g.AddMetric(tags, mergeRatio(v.MergedReadCount, v.ReadCount))
+			metricGroups["disk_write_merge_ratio"].AddMetric(tags, mergeRatio(v.MergedWriteCount, v.WriteCount))
+		}
+		if plugin.WithUsage && len(mountpoint) > 0 && !usageDone[mountpoint] {
+			usageDone[mountpoint] = true
+			u, err := filesystemUsage(mountpoint)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to get usage of %s, error: %v\n", mountpoint, err)
+			} else {
+				addUsageMetrics(metricGroups, tags, u)
+			}
+			enrichments.record("usage", err == nil)
+		}
+		if g, ok := metricGroups["disk_io_parse_suspect"]; ok {
+			suspect := 0.0
+			if parseSuspect(v) {
+				fmt.Fprintf(os.Stderr, "IO counters of %s look mis-parsed: IOs completed but all time counters are zero\n", v.Name)
+				suspect = 1
+			}
+			g.AddMetric(tags, suspect)
+		}
+	}
+
+	expected := map[string]bool{}
+	for _, d := range plugin.Devices {
+		expected[resolveDevice(d)] = true
+	}
+	seen := map[string]bool{}
+	// scanned holds every device considered in this run and filtered those
+	// a filter skipped, for --with-self-metrics.
+	scanned, filtered := map[string]bool{}, map[string]bool{}
+	for name := range expected {
+		scanned[name] = true
+	}
+
+	var swaps map[string]bool
+	if plugin.SkipSwap {
+		swaps, err = swapDevices()
+		if err != nil {
+			failed = true
+			fmt.Fprintf(os.Stderr, "Failed to read swap devices, only skipping zram, error: %v\n", err)
+		}
+	}
+
+	sizes := deviceSizeFilter{}
+	excluded := map[string]bool{}
+	var found []mountSample
+	// The counters of all devices are read in one sweep, rather than once
+	// per partition, which would read /proc/diskstats again every time.
+	// sweep is nil when nothing needed reading or the sweep failed.
+	var sweep map[string]disk.IOCountersStat
+	if plugin.AllDevices {
+		// Every device appears exactly once in the map, mounted ones with
+		// their first mountpoint.
+		mountpoints := firstMountpoints(parts, c.DeviceName)
+		sweep, err = c.IOCounters()
+		collection.recordSweep("all devices", sweep, err)
+		if err != nil {
+			failed = true
+			fmt.Fprintf(os.Stderr, "Failed to get IO counters, error: %v\n", err)
+		}
+		names := make([]string, 0, len(sweep))
+		for name := range sweep {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			scanned[name] = true
+			if plugin.WholeDeviceOnly && isPartition(name) {
+				filtered[name] = true
+				continue
+			}
+			found = append(found, mountSample{Counters: sweep[name], Mountpoint: mountpoints[name]})
+		}
+	} else {
+		// A device mounted at several places is listed once per distinct
+		// mountpoint. With --whole-device-only the partitions of a device
+		// are reported through their parent.
+		var mounts mountIndex
+		for _, p := range parts {
+			name := c.DeviceName(p.Device)
+			if plugin.WholeDeviceOnly {
+				name = parentDevice(name)
+			}
+			scanned[name] = true
+			if !fstypeAllowed(p.Fstype, plugin.FstypeInclude, plugin.FstypeExclude) {
+				filtered[name] = true
+				continue
+			}
+			// The name filter is applied again below to the names actually
+			// reported; skipping here keeps the index small.
+			if len(expected) == 0 && !nameMatches(name, plugin.includeDevice, plugin.excludeDevice) {
+				filtered[name] = true
+				continue
+			}
+			mounts.add(name, p.Mountpoint)
+		}
+		if len(mounts.names) > 0 {
+			sweep, err = c.IOCounters()
+			collection.recordSweep("all devices", sweep, err)
+			if err != nil {
+				failed = true
+				fmt.Fprintf(os.Stderr, "Failed to get IO counters, error: %v\n", err)
+			}
+			found = mounts.samples(sweep)
+		}
+	}
+
+	var samples []mountSample
+	for _, s := range found {
+		v := s.Counters
+		// A device skipped below or by --root-only counts as filtered,
+		// unless another of its samples is reported.
+		filtered[v.Name] = true
+		if len(expected) > 0 && !expected[v.Name] {
+			if len(plugin.FixedDeviceSet) == 0 || plugin.UnexpectedDevices != unexpectedWarn {
+				continue
+			}
+			if !seen[v.Name] {
+				fmt.Fprintf(os.Stderr, "Device %s is not in the fixed device set %s\n", v.Name, plugin.FixedDeviceSet)
+			}
+		}
+		if plugin.SkipSwap && len(expected) == 0 && isSwapDevice(v.Name, swaps) {
+			continue
+		}
+		if plugin.SkipIdle && len(expected) == 0 && idle(v) {
+			continue
+		}
+		if len(expected) == 0 && !sizes.inRange(v.Name, s.Mountpoint) {
+			continue
+		}
+		if len(expected) == 0 && !nameMatches(v.Name, plugin.includeDevice, plugin.excludeDevice) {
+			continue
+		}
+		if excluded[v.Name] || len(plugin.ExcludeSerials) > 0 && infos.excluded(v.Name, plugin.ExcludeSerials) {
+			excluded[v.Name] = true
+			continue
+		}
+		seen[v.Name] = true
+		samples = append(samples, s)
+	}
+	if plugin.RootOnly {
+		if hasRootMount(parts) {
+			samples = rootSamples(samples)
+		} else {
+			fmt.Fprintf(os.Stderr, "No block device is mounted at /, the root filesystem may be an overlay or tmpfs, reporting all devices\n")
+		}
+	}
+	for _, s := range applyMultiMountPolicy(samples, plugin.MultiMountPolicy) {
+		record(s.Counters, s.Mountpoint)
+	}
+
+	// Explicitly requested devices without a mounted partition are looked
+	// up directly, and reported as absent if the kernel does not know them.
+	for _, name := range sortedKeys(expected) {
+		if seen[name] || excluded[name] {
+			continue
+		}
+		diskio := sweep
+		if diskio == nil {
+			diskio, err = c.IOCounters(name)
+			collection.record(name, err)
+			if err != nil {
+				failed = true
+				fmt.Fprintf(os.Stderr, "Failed to get IO counters of %s, error: %v\n", name, err)
+			}
+		}
+		if v, ok := diskio[name]; ok {
+			if len(plugin.ExcludeSerials) == 0 || !infos.excluded(name, plugin.ExcludeSerials) {
+				record(v, "")
+			}
+			continue
+		}
+		if plugin.EmitZeroForMissing {
+			tags := deviceTags(name, "")
+			for _, b := range collector.Counters {
+				if g, ok := metricGroups[b.Name]; ok {
+					g.AddIntMetric(tags, 0)
+				}
+			}
+			metricGroups["disk_io_up"].AddMetric(tags, 0)
+		}
+	}
+
+	if state != nil {
+		if plugin.LatencySLOMs > 0 {
+			if sloBreached {
+				state.LatencySLOBreaches++
+			}
+			metricGroups["disk_latency_slo_breaches_total"] = &MetricGroup{
+				Name:    "disk_latency_slo_breaches_total",
+				Type:    "COUNTER",
+				Comment: "This value counts the runs in which the average IO latency of any reported device exceeded --latency-slo-ms, persisted in the state file.",
+				Metrics: []Metric{{Tags: map[string]string{}, IntValue: state.LatencySLOBreaches, IsInt: true}},
+			}
+		}
+		if !failed {
+			state.Sequence++
+		}
+		metricGroups["disk_io_run_sequence"] = &MetricGroup{
+			Name:    "disk_io_run_sequence",
+			Type:    "COUNTER",
+			Comment: "This value is incremented by every successful run that uses the state file, so a gap in the sequence means runs were missed.",
+			Metrics: []Metric{{Tags: map[string]string{}, IntValue: state.Sequence, IsInt: true}},
+		}
+		pruneState(state, updated, now.UnixNano()/int64(time.Millisecond), plugin.absentRetention)
+		state.Timestamp = now.Unix()
+		// --daemon keeps the state in memory between its samples.
+		if daemonState == nil {
+			if err := saveState(plugin.StateFile, state); err != nil {
+				failed = true
+				fmt.Fprintf(os.Stderr, "Failed to save state file, error: %v\n", err)
+			}
+		}
+	}
+
+	if plugin.SetBaseline {
+		if err := saveBaseline(plugin.BaselineFile, newBaseline); err != nil {
+			return nil, fmt.Errorf("failed to save baseline file: %v", err)
+		}
+	}
+
+	if plugin.Totals {
+		addTotals(metricGroups)
+	}
+
+	if plugin.MdRollup && len(mdMemberArrays) > 0 && groupSupported("disk_md_member_read_wait_ms_max") {
+		// The sweep above holds every device, mounted or not; the members
+		// are read here only when it was not taken. With --rate the first
+		// sample holds every device.
+		diskio := sweep
+		if diskio == nil {
+			diskio, err = c.IOCounters()
+			collection.recordSweep("md members", diskio, err)
+			if err != nil {
+				failed = true
+				fmt.Fprintf(os.Stderr, "Failed to get IO counters of the md members, error: %v\n", err)
+			}
+		}
+		ranges := mdWaitRanges(mdMemberArrays, diskio, first)
+		groups := map[string]*MetricGroup{}
+		for _, dir := range []string{"read", "write"} {
+			for _, extreme := range []string{"min", "max"} {
+				name := "disk_md_member_" + dir + "_wait_ms_" + extreme
+				groups[name] = &MetricGroup{
+					Name:    name,
+					Type:    "GAUGE",
+					Comment: "This value is the " + extreme + "imum average time in milliseconds per " + dir + " among the active members of the md array, since the first --rate sample or else since boot.",
+				}
+				metricGroups[name] = groups[name]
+			}
+		}
+		for array, r := range ranges {
+			tags := map[string]string{"array": array}
+			if r.reads > 0 {
+				groups["disk_md_member_read_wait_ms_min"].AddMetric(tags, r.ReadMin)
+				groups["disk_md_member_read_wait_ms_max"].AddMetric(tags, r.ReadMax)
+			}
+			if r.writes > 0 {
+				groups["disk_md_member_write_wait_ms_min"].AddMetric(tags, r.WriteMin)
+				groups["disk_md_member_write_wait_ms_max"].AddMetric(tags, r.WriteMax)
+			}
+		}
+	}
+
+	if plugin.Cgroups && groupSupported("disk_cgroup_read_bytes") {
+		stats, err := cgroupStats()
+		collection.record("cgroups", err)
+		if err != nil {
+			failed = true
+			fmt.Fprintf(os.Stderr, "Failed to read cgroup IO stats, error: %v\n", err)
+		}
+		for _, g := range cgroupGroups {
+			metricGroups[g.Name] = &MetricGroup{Name: g.Name, Type: "COUNTER", Comment: g.Comment}
+		}
+		addCgroupMetrics(metricGroups, stats)
+	}
+
+	if plugin.ZFS {
+		pools, err := zfsPools(plugin.ZpoolCommand)
+		collection.record("zfs", err)
+		if err != nil {
+			failed = true
+			fmt.Fprintf(os.Stderr, "Failed to read ZFS pool stats, error: %v\n", err)
+		}
+		for _, g := range zfsIOGroups {
+			metricGroups[g.Name] = &MetricGroup{Name: g.Name, Type: "GAUGE", Comment: g.Comment}
+		}
+		for _, dir := range []string{"read", "write"} {
+			name := "disk_zfs_" + dir + "_latency_seconds_bucket"
+			metricGroups[name] = &MetricGroup{
+				Name:    name,
+				Type:    "COUNTER",
+				Comment: "This is the number of " + dir + "s of the pool since it was imported that completed within le seconds, waiting in total or at the disk.",
+			}
+		}
+		addZFSMetrics(metricGroups, pools)
+	}
+
+	if plugin.WithSelfMetrics {
+		cpu, rss, err := processUsage()
+		if err != nil {
+			// Windows has no getrusage: fall back to the Go runtime's
+			// view of the memory and leave the CPU time out.
+			var mem runtime.MemStats
+			runtime.ReadMemStats(&mem)
+			rss = mem.Sys
+		} else {
+			metricGroups["disk_io_plugin_cpu_seconds"] = &MetricGroup{
+				Name:    "disk_io_plugin_cpu_seconds",
+				Type:    "GAUGE",
+				Comment: "This value is the user and system CPU time in seconds used by this run of the check.",
+				Metrics: []Metric{{Tags: map[string]string{}, Value: cpu}},
+			}
+		}
+		metricGroups["disk_io_plugin_rss_bytes"] = &MetricGroup{
+			Name:    "disk_io_plugin_rss_bytes",
+			Type:    "GAUGE",
+			Comment: "This value is the peak resident set size in bytes of this run of the check, or the memory obtained from the OS by the Go runtime where that is not available.",
+			Metrics: []Metric{{Tags: map[string]string{}, IntValue: rss, IsInt: true}},
+		}
+		metricGroups["disk_io_collect_duration_seconds"] = &MetricGroup{
+			Name:    "disk_io_collect_duration_seconds",
+			Type:    "GAUGE",
+			Comment: "This value is the wall-clock time in seconds this run of the check took up to its output, --interval included.",
+			Metrics: []Metric{{Tags: map[string]string{}, Value: time.Since(d.start).Seconds()}},
+		}
+		skipped := 0
+		for name := range filtered {
+			if !reported[name] {
+				skipped++
+			}
+		}
+		metricGroups["disk_io_devices_scanned"] = &MetricGroup{
+			Name:    "disk_io_devices_scanned",
+			Type:    "GAUGE",
+			Comment: "This value is the number of devices this run of the check considered: those of the mounted partitions, or with --all-devices every device with IO counters, plus those named by --device.",
+			Metrics: []Metric{{Tags: map[string]string{}, IntValue: uint64(len(scanned)), IsInt: true}},
+		}
+		metricGroups["disk_io_devices_filtered"] = &MetricGroup{
+			Name:    "disk_io_devices_filtered",
+			Type:    "GAUGE",
+			Comment: "This value is the number of scanned devices that the device, filesystem type, size, swap, idle and serial filters left out in this run of the check.",
+			Metrics: []Metric{{Tags: map[string]string{}, IntValue: uint64(skipped), IsInt: true}},
+		}
+		v, commit := pluginVersion()
+		metricGroups["disk_io_plugin_info"] = &MetricGroup{
+			Name:    "disk_io_plugin_info",
+			Type:    "GAUGE",
+			Comment: "This value is always 1, with the version and commit of the check as tags.",
+			Metrics: []Metric{{Tags: map[string]string{"version": v, "commit": commit}, Value: 1}},
+		}
+	}
+
+	if len(enrichments) > 0 {
+		g := enrichments.group()
+		metricGroups[g.Name] = g
+	}
+
+	collectErrors := &MetricGroup{
+		Name:    "disk_io_collect_errors",
+		Type:    "GAUGE",
+		Comment: "This value counts the partition listings and device IO counter reads that failed in this run of the check.",
+	}
+	collectErrors.AddIntMetric(map[string]string{}, uint64(collection.count()))
+	metricGroups[collectErrors.Name] = collectErrors
+	if plugin.timeout > 0 {
+		timeouts := &MetricGroup{
+			Name:    "disk_io_collect_timeouts",
+			Type:    "GAUGE",
+			Comment: "This value counts the partition listings and device IO counter reads abandoned at the --timeout deadline in this run of the check.",
+		}
+		timeouts.AddIntMetric(map[string]string{}, uint64(collection.timeouts))
+		metricGroups[timeouts.Name] = timeouts
+	}
+
+	selectGroups(metricGroups, plugin.metrics, plugin.disabledMetrics)
+	emitted := &MetricGroup{
+		Name:    "disk_io_metrics_emitted_total",
+		Type:    "GAUGE",
+		Comment: "This value counts the samples emitted by this run of the check, not including itself.",
+	}
+	emitted.AddIntMetric(map[string]string{}, uint64(countSamples(metricGroups)))
+	if (len(plugin.metrics) == 0 || plugin.metrics[emitted.Name]) && !plugin.disabledMetrics[emitted.Name] {
+		metricGroups[emitted.Name] = emitted
+	}
+
+	for _, g := range metricGroups {
+		g.SetTimestamp(timestamp)
+	}
+	d.now, d.timestamp = now, timestamp
+	d.failed, d.collection = failed, collection
+	d.violations, d.loads = violations, loads
+	d.state, d.updated = state, updated
+
+	groups := make([]MetricGroup, 0, len(metricGroups))
+	for _, name := range output.GroupNames(metricGroups) {
+		groups = append(groups, *metricGroups[name])
+	}
+	return groups, nil
+}
+
+// evaluate prints the threshold violations, or the --suggest-thresholds
+// suggestions, and returns the state they put the check in.
+func (d *diskCheck) evaluate() int {
+	status := thresholds.WorstState(d.violations)
+	// The summary comes first so notifications that show only the start
+	// of the output still explain the state.
+	if line := summaryLine(d.violations, d.loads, plugin.SummaryTop); len(line) > 0 && !plugin.SuggestThresholds {
+		fmt.Fprintln(os.Stderr, line)
+	}
+	for _, v := range d.violations {
+		fmt.Fprintln(os.Stderr, v)
+	}
+	if plugin.SuggestThresholds && d.state != nil {
+		status = sensu.CheckStateOK
+		for _, name := range sortedKeys(d.updated) {
+			ds := d.state.Devices[name]
+			entry, ok := suggestThresholds(name, ds.ReadRate, ds.WriteRate)
+			switch {
+			case ok:
+				fmt.Fprintf(os.Stderr, "Suggested: --device-threshold %s\n", entry)
+			case len(ds.ReadRate) < suggestMinSamples:
+				fmt.Fprintf(os.Stderr, "No suggestion for %s yet: %d of %d samples collected\n", name, len(ds.ReadRate), suggestMinSamples)
+			default:
+				fmt.Fprintf(os.Stderr, "No suggestion for %s: no traffic observed\n", name)
+			}
+		}
+	}
+	return status
+}
+
+// finish applies the tag, type and name options to groups and adds
+// disk_io_scrape_success, returned separately as the encoders write it last.
+func (d *diskCheck) finish(groups []MetricGroup) (map[string]*MetricGroup, *MetricGroup) {
+	metricGroups := make(map[string]*MetricGroup, len(groups))
+	for i := range groups {
+		metricGroups[groups[i].Name] = &groups[i]
+	}
+
+	targetTags := map[string]string{}
+	if len(plugin.Instance) > 0 {
+		targetTags["instance"] = plugin.Instance
+	}
+	if len(plugin.Job) > 0 {
+		targetTags["job"] = plugin.Job
+	}
+	staticTags := plugin.staticTags
+	if !plugin.NoHostname {
+		d.host = plugin.Hostname
+		if len(d.host) == 0 {
+			var err error
+			if d.host, err = os.Hostname(); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to get hostname, leaving out the host tag, error: %v\n", err)
+			}
+		}
+		staticTags = withHost(staticTags, d.host)
+	}
+	// apply runs the tag, type and name options on groups just before they
+	// are rendered; disk_io_scrape_success goes through it separately.
+	apply := func(groups map[string]*MetricGroup) map[string]*MetricGroup {
+		applyStaticTags(groups, staticTags)
+		applyTargetTags(groups, targetTags)
+		maskTags(groups, plugin.MaskLabelValues, plugin.MaskMethod, plugin.MaskSalt)
+		applyTypeOverrides(groups, plugin.typeOverrides)
+		groups = applyUnits(groups, plugin.TimeUnit, plugin.SizeUnit)
+		return applyNamespace(applyNamingScheme(groups, plugin.NamingScheme), plugin.Namespace)
+	}
+	metricGroups = apply(metricGroups)
+
+	success := &MetricGroup{
+		Name:    "disk_io_scrape_success",
+		Type:    "GAUGE",
+		Comment: "This value is 1 when every collection, persistence and rendering step of this run succeeded, 0 when any of them failed.",
+	}
+	success.AddIntMetric(map[string]string{}, 1)
+	success.SetTimestamp(d.timestamp)
+	for _, g := range apply(map[string]*MetricGroup{success.Name: success}) {
+		success = g
+	}
+	if d.failed {
+		success.Metrics[0].IntValue = 0
+	}
+	return metricGroups, success
+}
+
+// write renders the metrics to every --output and exports them to
+// --otlp-endpoint and --statsd-addr.
+func (d *diskCheck) write(metricGroups map[string]*MetricGroup, success *MetricGroup) error {
+	// render writes the metrics in one format of --format.
+	render := func(w io.Writer, format string) error {
+		return encoder(format, d.now).Encode(w, metricGroups, success)
+	}
+
+	for _, sink := range plugin.outputs {
+		if len(sink.File) > 0 {
+			// The output file is rendered in memory and renamed into
+			// place, so a reader never sees it half written.
+			file := &bytes.Buffer{}
+			render(file, sink.Format)
+			if err := writeFileAtomic(sink.File, file.Bytes(), 0644); err != nil {
+				return fmt.Errorf("failed to write metrics to %s: %v", sink.File, err)
+			}
+			continue
+		}
+		var dest io.Writer = stdout
+		if plugin.StatsDOnly {
+			dest = ioutil.Discard
+		}
+		if len(plugin.FIFO) > 0 {
+			f, err := openFIFO(plugin.FIFO, plugin.fifoTimeout)
+			if err != nil {
+				return fmt.Errorf("failed to open fifo: %v", err)
+			}
+			defer f.Close()
+			dest = f
+		}
+		var buf *bufio.Writer
+		if plugin.OutputBufferSize > 0 {
+			buf = bufio.NewWriterSize(dest, plugin.OutputBufferSize)
+			// Flushed explicitly below; the deferred call only matters
+			// when rendering panics, so the metrics written so far are
+			// not lost.
+			defer buf.Flush()
+			dest = buf
+		}
+		err := render(dest, sink.Format)
+		if buf != nil && err == nil {
+			err = buf.Flush()
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write metrics: %v", err)
+		}
+	}
+
+	if len(plugin.OTLPEndpoint) > 0 {
+		resource := map[string]string{"service.name": plugin.Name}
+		if len(d.host) > 0 {
+			resource["host.name"] = d.host
+		}
+		req := buildOTLP(metricGroups, resource, time.Now())
+		if err := exportOTLP(plugin.OTLPEndpoint, plugin.OTLPHeaders, plugin.OTLPInsecure, req); err != nil {
+			return fmt.Errorf("failed to export metrics to %s: %v", plugin.OTLPEndpoint, err)
+		}
+	}
+
+	if len(plugin.StatsDAddr) > 0 {
+		if err := sendStatsD(plugin.StatsDAddr, metricGroups); err != nil {
+			return fmt.Errorf("failed to send metrics to %s: %v", plugin.StatsDAddr, err)
+		}
+	}
+	return nil
+}
+
+// result turns the collection errors into the final state of the check,
+// starting from the state of the thresholds.
+func (d *diskCheck) result(status int) (int, error) {
+	// The metrics that could be collected have been written; a partial
+	// failure is a warning, a total one --fail-state.
+	total, err := d.collection.err()
+	if err != nil && plugin.IgnoreCollectionErrors {
+		fmt.Fprintf(os.Stderr, "Ignoring collection errors, error: %v\n", err)
+		return status, nil
+	}
+	if total && plugin.failState > status {
+		status = plugin.failState
+	} else if err != nil && sensu.CheckStateWarning > status {
+		status = sensu.CheckStateWarning
+	}
+	return status, err
+}
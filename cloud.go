@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// cloudMetadataTimeout bounds every metadata request, so hosts outside a
+// cloud, where the endpoints do not answer, are not slowed down noticeably.
+const cloudMetadataTimeout = time.Second
+
+// Instance metadata endpoints, replaceable in tests.
+var (
+	awsMetadataURL   = "http://169.254.169.254"
+	gcpMetadataURL   = "http://metadata.google.internal"
+	azureMetadataURL = "http://169.254.169.254"
+)
+
+// cloudProviders lists the supported providers in the order they are
+// preferred when detecting automatically.
+var cloudProviders = []string{"aws", "gcp", "azure"}
+
+// cloudInstance is the instance metadata turned into tags.
+type cloudInstance struct {
+	InstanceID string
+	Region     string
+	Zone       string
+}
+
+// tags returns the instance metadata as tags, leaving out unknown values.
+func (c cloudInstance) tags() map[string]string {
+	tags := map[string]string{}
+	for k, v := range map[string]string{"instance_id": c.InstanceID, "region": c.Region, "zone": c.Zone} {
+		if len(v) > 0 {
+			tags[k] = v
+		}
+	}
+	return tags
+}
+
+// lookupCloudInstance queries the metadata service of the given provider,
+// or of all supported providers at once when provider is "auto".
+func lookupCloudInstance(provider string) (cloudInstance, error) {
+	if provider != "auto" {
+		return cloudLookups[provider]()
+	}
+
+	type result struct {
+		instance cloudInstance
+		err      error
+	}
+	results := make([]chan result, len(cloudProviders))
+	for i, p := range cloudProviders {
+		results[i] = make(chan result, 1)
+		go func(lookup func() (cloudInstance, error), ch chan result) {
+			instance, err := lookup()
+			ch <- result{instance, err}
+		}(cloudLookups[p], results[i])
+	}
+	for _, ch := range results {
+		if r := <-ch; r.err == nil {
+			return r.instance, nil
+		}
+	}
+	return cloudInstance{}, fmt.Errorf("no instance metadata service answered")
+}
+
+// cloudLookups maps each provider to its metadata lookup.
+var cloudLookups = map[string]func() (cloudInstance, error){
+	"aws":   lookupAWS,
+	"gcp":   lookupGCP,
+	"azure": lookupAzure,
+}
+
+// metadataGet performs a metadata request and returns the body.
+func metadataGet(method, url string, headers map[string]string) ([]byte, error) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	client := &http.Client{Timeout: cloudMetadataTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return body, nil
+}
+
+// lookupAWS reads the EC2 instance identity document, using an IMDSv2
+// session token when the service hands one out.
+func lookupAWS() (cloudInstance, error) {
+	headers := map[string]string{}
+	token, err := metadataGet(http.MethodPut, awsMetadataURL+"/latest/api/token", map[string]string{"X-aws-ec2-metadata-token-ttl-seconds": "60"})
+	if err == nil {
+		headers["X-aws-ec2-metadata-token"] = string(token)
+	}
+	body, err := metadataGet(http.MethodGet, awsMetadataURL+"/latest/dynamic/instance-identity/document", headers)
+	if err != nil {
+		return cloudInstance{}, err
+	}
+	var doc struct {
+		InstanceID       string `json:"instanceId"`
+		Region           string `json:"region"`
+		AvailabilityZone string `json:"availabilityZone"`
+	}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return cloudInstance{}, err
+	}
+	return cloudInstance{InstanceID: doc.InstanceID, Region: doc.Region, Zone: doc.AvailabilityZone}, nil
+}
+
+// lookupGCP reads the instance id and zone from the GCE metadata server.
+// The zone comes as projects/<n>/zones/<zone>, the region is the zone
+// without its last dash-separated part.
+func lookupGCP() (cloudInstance, error) {
+	headers := map[string]string{"Metadata-Flavor": "Google"}
+	id, err := metadataGet(http.MethodGet, gcpMetadataURL+"/computeMetadata/v1/instance/id", headers)
+	if err != nil {
+		return cloudInstance{}, err
+	}
+	zonePath, err := metadataGet(http.MethodGet, gcpMetadataURL+"/computeMetadata/v1/instance/zone", headers)
+	if err != nil {
+		return cloudInstance{}, err
+	}
+	zone := string(zonePath)
+	zone = zone[strings.LastIndex(zone, "/")+1:]
+	region := zone
+	if i := strings.LastIndex(zone, "-"); i > 0 {
+		region = zone[:i]
+	}
+	return cloudInstance{InstanceID: strings.TrimSpace(string(id)), Region: region, Zone: zone}, nil
+}
+
+// lookupAzure reads the compute section of the Azure instance metadata.
+func lookupAzure() (cloudInstance, error) {
+	body, err := metadataGet(http.MethodGet, azureMetadataURL+"/metadata/instance/compute?api-version=2021-02-01", map[string]string{"Metadata": "true"})
+	if err != nil {
+		return cloudInstance{}, err
+	}
+	var compute struct {
+		VMID     string `json:"vmId"`
+		Location string `json:"location"`
+		Zone     string `json:"zone"`
+	}
+	if err := json.Unmarshal(body, &compute); err != nil {
+		return cloudInstance{}, err
+	}
+	return cloudInstance{InstanceID: compute.VMID, Region: compute.Location, Zone: compute.Zone}, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLookupCloudInstance(t *testing.T) {
+	gcp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			http.Error(w, "missing header", http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/computeMetadata/v1/instance/id":
+			w.Write([]byte("4520031799277581759"))
+		case "/computeMetadata/v1/instance/zone":
+			w.Write([]byte("projects/123456/zones/europe-west1-b"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer gcp.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	defer down.Close()
+
+	origAWS, origGCP, origAzure := awsMetadataURL, gcpMetadataURL, azureMetadataURL
+	defer func() { awsMetadataURL, gcpMetadataURL, azureMetadataURL = origAWS, origGCP, origAzure }()
+	awsMetadataURL, gcpMetadataURL, azureMetadataURL = down.URL, gcp.URL, down.URL
+
+	got, err := lookupCloudInstance("auto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := cloudInstance{InstanceID: "4520031799277581759", Region: "europe-west1", Zone: "europe-west1-b"}
+	if got != want {
+		t.Errorf("lookupCloudInstance(auto) = %+v, want %+v", got, want)
+	}
+
+	if _, err := lookupCloudInstance("aws"); err == nil {
+		t.Errorf("expected an error when the AWS endpoint does not answer")
+	}
+}
+
+func TestLookupAWS(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/latest/api/token":
+			w.Write([]byte("tok"))
+		case "/latest/dynamic/instance-identity/document":
+			if r.Header.Get("X-aws-ec2-metadata-token") != "tok" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"instanceId":"i-0abc","region":"eu-west-1","availabilityZone":"eu-west-1a"}`))
+		}
+	}))
+	defer srv.Close()
+	orig := awsMetadataURL
+	defer func() { awsMetadataURL = orig }()
+	awsMetadataURL = srv.URL
+
+	got, err := lookupAWS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tags := got.tags(); tags["instance_id"] != "i-0abc" || tags["region"] != "eu-west-1" || tags["zone"] != "eu-west-1a" {
+		t.Errorf("tags = %v", tags)
+	}
+}
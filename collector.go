@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jadiunr/check-disk-io/collector"
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// unsupportedGroups is the capability table: for each GOOS, the metric
+// groups whose counters the platform does not provide. gopsutil reports
+// those as zero, so they are not emitted at all.
+var unsupportedGroups = map[string][]string{
+	"freebsd": {
+		"disk_weighted_io",
+		"disk_iops_in_progress",
+		"disk_merged_read_count",
+		"disk_merged_write_count",
+	},
+	"darwin": {
+		// gopsutil reports the sum of the read and write time as the IO
+		// time, which is not the time the disk was busy.
+		"disk_io_time",
+		"disk_weighted_io",
+		"disk_iops_in_progress",
+		"disk_merged_read_count",
+		"disk_merged_write_count",
+	},
+	"openbsd": {
+		"disk_read_time",
+		"disk_write_time",
+		"disk_io_time",
+		"disk_weighted_io",
+		"disk_iops_in_progress",
+		"disk_merged_read_count",
+		"disk_merged_write_count",
+	},
+	"windows": {
+		"disk_io_time",
+		"disk_weighted_io",
+		"disk_merged_read_count",
+		"disk_merged_write_count",
+		// NTFS has no inode counts.
+		"disk_inodes_total",
+		"disk_inodes_used",
+		"disk_inodes_free",
+		"disk_inodes_used_percent",
+	},
+}
+
+// groupSources maps the metric groups computed from a counter, rather than
+// read directly, to the group of that counter. A derived group is only
+// emitted where its source is.
+var groupSources = map[string]string{
+	"disk_read_wait_ms":                    "disk_read_time",
+	"disk_write_wait_ms":                   "disk_write_time",
+	"disk_read_latency_p50_ms":             "disk_read_time",
+	"disk_read_latency_p95_ms":             "disk_read_time",
+	"disk_write_latency_p50_ms":            "disk_write_time",
+	"disk_write_latency_p95_ms":            "disk_write_time",
+	"disk_read_merge_ratio":                "disk_merged_read_count",
+	"disk_write_merge_ratio":               "disk_merged_write_count",
+	"disk_iowait_contribution_ms":          "disk_weighted_io",
+	"disk_io_stuck":                        "disk_iops_in_progress",
+	"disk_util_percent":                    "disk_io_time",
+	"disk_read_await_ms":                   "disk_read_time",
+	"disk_write_await_ms":                  "disk_write_time",
+	"disk_avg_queue_size":                  "disk_weighted_io",
+	"disk_util_percent_min":                "disk_io_time",
+	"disk_util_percent_max":                "disk_io_time",
+	"disk_util_percent_p95":                "disk_io_time",
+	"disk_read_await_ms_min":               "disk_read_time",
+	"disk_read_await_ms_max":               "disk_read_time",
+	"disk_read_await_ms_p95":               "disk_read_time",
+	"disk_write_await_ms_min":              "disk_write_time",
+	"disk_write_await_ms_max":              "disk_write_time",
+	"disk_write_await_ms_p95":              "disk_write_time",
+	"disk_sub_sample_await_seconds_bucket": "disk_read_time",
+}
+
+// linuxGroups are only emitted on Linux, because they come from sysfs,
+// /proc/mdstat or Linux-only ioctls, or check how /proc/diskstats was parsed.
+var linuxGroups = []string{
+	"disk_cgroup_read_bytes",
+	"disk_cgroup_read_count",
+	"disk_cgroup_write_bytes",
+	"disk_cgroup_write_count",
+	"disk_io_parse_suspect",
+	"disk_md_member_read_wait_ms_max",
+	"disk_md_member_read_wait_ms_min",
+	"disk_md_member_write_wait_ms_max",
+	"disk_md_member_write_wait_ms_min",
+	"disk_queue_completed",
+	"disk_queue_issued",
+	"disk_nvme_available_spare_percent",
+	"disk_nvme_available_spare_threshold_percent",
+	"disk_nvme_controller_busy_minutes",
+	"disk_nvme_critical_warning",
+	"disk_nvme_error_log_entries",
+	"disk_nvme_media_errors",
+	"disk_nvme_percentage_used",
+	"disk_nvme_power_on_hours",
+	"disk_nvme_temperature_celsius",
+	"disk_nvme_unsafe_shutdowns",
+	"disk_smart_attribute_raw",
+	"disk_smart_attribute_value",
+}
+
+// groupSupported reports whether the current platform provides the counter
+// behind the named metric group.
+func groupSupported(name string) bool {
+	if runtime.GOOS != "linux" {
+		for _, g := range linuxGroups {
+			if g == name {
+				return false
+			}
+		}
+	}
+	if source, ok := groupSources[name]; ok {
+		name = source
+	}
+	for _, g := range unsupportedGroups[runtime.GOOS] {
+		if g == name {
+			return false
+		}
+	}
+	return true
+}
+
+// platformGroups returns the names of the metric groups the current platform
+// can emit, leaving out the variants derived from every counter such as
+// *_delta, in sorted order.
+func platformGroups() []string {
+	var names []string
+	for _, b := range collector.Counters {
+		if groupSupported(b.Name) {
+			names = append(names, b.Name)
+		}
+	}
+	for _, n := range extraGroupNames {
+		if groupSupported(n) {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Values accepted by --fail-state.
+const (
+	failStateWarning  = "warning"
+	failStateCritical = "critical"
+)
+
+// collectionErrors tracks the partition and IO counter lookups of a run, so
+// a host whose collector is broken does not report a healthy check.
+type collectionErrors struct {
+	partitions error
+	// firstSample is the error of a first --rate sample that returned no
+	// counters at all.
+	firstSample error
+	attempts    int
+	failures    []string
+	// timeouts counts the lookups abandoned at the --timeout deadline.
+	timeouts int
+}
+
+// record notes the outcome of reading the IO counters of target.
+func (c *collectionErrors) record(target string, err error) {
+	c.attempts++
+	if errors.Is(err, context.DeadlineExceeded) {
+		c.timeouts++
+	}
+	if err != nil {
+		c.failures = append(c.failures, fmt.Sprintf("%s: %v", target, err))
+	}
+}
+
+// recordSweep notes the outcome of reading the IO counters of every device
+// at once as target. The devices a collector.DeviceErrors names count as
+// failed lookups of their own and those that were read as successful ones,
+// so a sweep failing on some devices is a partial failure; so is a sweep
+// that returned counters along with any other error.
+func (c *collectionErrors) recordSweep(target string, stats map[string]disk.IOCountersStat, err error) {
+	var devices collector.DeviceErrors
+	switch {
+	case errors.As(err, &devices):
+		c.attempts += len(stats)
+		names := make([]string, 0, len(devices))
+		for name := range devices {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			c.record(name, devices[name])
+		}
+	case err != nil && len(stats) > 0:
+		c.attempts += len(stats)
+		c.record(target, err)
+	default:
+		c.record(target, err)
+	}
+}
+
+// recordFirstSample notes the outcome of the first --rate sample. Without
+// its counters no device has a rate, so a first sample that returned none
+// fails the run like the partition listing does, however many devices the
+// second sample read.
+func (c *collectionErrors) recordFirstSample(stats map[string]disk.IOCountersStat, err error) {
+	if err == nil || len(stats) > 0 {
+		c.recordSweep("first sample", stats, err)
+		return
+	}
+	c.firstSample = err
+	if errors.Is(err, context.DeadlineExceeded) {
+		c.timeouts++
+	}
+}
+
+// count returns the number of failed lookups, the partition listing and
+// the first --rate sample included.
+func (c *collectionErrors) count() int {
+	n := len(c.failures)
+	if c.partitions != nil {
+		n++
+	}
+	if c.firstSample != nil {
+		n++
+	}
+	return n
+}
+
+// err summarizes the failed lookups. total is true when nothing could be
+// collected: the partitions could not be listed, the first --rate sample
+// read nothing, or every IO counter lookup failed. A partial failure still
+// yields an error, with total false.
+func (c *collectionErrors) err() (total bool, err error) {
+	switch {
+	case c.partitions != nil:
+		return true, fmt.Errorf("failed to get partitions: %v", c.partitions)
+	case c.firstSample != nil:
+		return true, fmt.Errorf("failed to get IO counters for the first --rate sample: %v", c.firstSample)
+	case len(c.failures) == 0:
+		return false, nil
+	case len(c.failures) == c.attempts:
+		return true, fmt.Errorf("failed to get IO counters of every device: %s", strings.Join(c.failures, "; "))
+	default:
+		return false, fmt.Errorf("failed to get IO counters of %d of %d devices: %s", len(c.failures), c.attempts, strings.Join(c.failures, "; "))
+	}
+}
+
+// maxRetryTime bounds the time --retries and --retry-delay may add to one
+// IO counter read, so a flaky host cannot hang the scheduler.
+const maxRetryTime = 10 * time.Second
@@ -0,0 +1,58 @@
+//go:build freebsd || openbsd
+// +build freebsd openbsd
+
+package collector
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+func New() Collector {
+	return bsdCollector{}
+}
+
+// bsdPartition matches BSD partition device names and captures the disk
+// they live on: GPT (ada0p2), MBR slices (ada0s1a) and OpenBSD disklabel
+// partitions (sd0a).
+var bsdPartition = regexp.MustCompile(`^([a-z]+[0-9]+)(p[0-9]+|s[0-9]+[a-h]?|[a-p])?$`)
+
+// bsdDiskName maps a partition device path to the devstat/diskstats name
+// of its disk, or returns "" when the path is not a plain disk partition
+// (ZFS datasets, GEOM labels, memory disks without a unit).
+func bsdDiskName(device string) string {
+	m := bsdPartition.FindStringSubmatch(strings.TrimPrefix(device, "/dev/"))
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+// bsdCollector reads all disk statistics at once and maps partitions to
+// their disk, because the BSDs only keep statistics per disk and name them
+// without the /dev/ prefix.
+type bsdCollector struct{}
+
+func (bsdCollector) Partitions(all bool) ([]disk.PartitionStat, error) {
+	return disk.Partitions(all)
+}
+
+func (bsdCollector) IOCounters(names ...string) (map[string]disk.IOCountersStat, error) {
+	all, err := disk.IOCounters()
+	if len(names) == 0 || err != nil {
+		return all, err
+	}
+	ret := map[string]disk.IOCountersStat{}
+	for _, name := range names {
+		if v, ok := all[bsdDiskName(name)]; ok {
+			ret[v.Name] = v
+		}
+	}
+	return ret, nil
+}
+
+func (bsdCollector) DeviceName(path string) string {
+	return bsdDiskName(path)
+}
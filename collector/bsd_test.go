@@ -0,0 +1,25 @@
+//go:build freebsd || openbsd
+// +build freebsd openbsd
+
+package collector
+
+import (
+	"testing"
+)
+
+func TestBSDDiskName(t *testing.T) {
+	tests := map[string]string{
+		"/dev/ada0p2":        "ada0",
+		"/dev/ada0s1a":       "ada0",
+		"/dev/nvd0p3":        "nvd0",
+		"/dev/sd0a":          "sd0",
+		"/dev/da12":          "da12",
+		"zroot/ROOT/default": "",
+		"/dev/gpt/rootfs":    "",
+	}
+	for in, want := range tests {
+		if got := bsdDiskName(in); got != want {
+			t.Errorf("bsdDiskName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
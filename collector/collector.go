@@ -0,0 +1,232 @@
+// Package collector reads partitions and disk IO counters from the
+// operating system. It is the collection layer of check-disk-io, usable on
+// its own by programs that want the same per-platform device naming and
+// counters:
+//
+//	c := collector.Retry{Collector: collector.New(), Retries: 2, Delay: 100 * time.Millisecond}
+//	stats, err := c.IOCounters()
+package collector
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// Collector reads partitions and IO counters from the operating system.
+// Platforms whose device naming or counters differ from Linux provide their
+// own implementation behind build tags; New returns the one of the current
+// platform.
+type Collector interface {
+	Partitions(all bool) ([]disk.PartitionStat, error)
+	// IOCounters returns the counters of the devices backing the given
+	// partition device paths, or of every device when names is empty.
+	IOCounters(names ...string) (map[string]disk.IOCountersStat, error)
+	// DeviceName returns the name IOCounters reports the partition device
+	// path under, so devices can be filtered before they are read.
+	DeviceName(path string) string
+}
+
+// DeviceErrors is the error IOCounters returns along with the counters it
+// could read when only some devices failed, keyed by device name, so the
+// caller can tell a partial failure from a total one.
+type DeviceErrors map[string]error
+
+func (e DeviceErrors) Error() string {
+	names := make([]string, 0, len(e))
+	for name := range e {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		names[i] = fmt.Sprintf("%s: %v", name, e[name])
+	}
+	return "failed to get IO counters of " + strings.Join(names, ", ")
+}
+
+// sleep is time.Sleep, replaced in tests.
+var sleep = time.Sleep
+
+// inFlightPoll is how often PeakInFlight samples the IOs in flight.
+const inFlightPoll = 100 * time.Millisecond
+
+// PeakInFlight spends d reading the counters of every device each 100ms and
+// returns the highest number of IOs in flight seen per device, so a burst
+// between two samples taken d apart is not missed. Failed reads are skipped;
+// the samples themselves report their errors.
+func PeakInFlight(c Collector, d time.Duration) map[string]uint64 {
+	peaks := map[string]uint64{}
+	for d > 0 {
+		step := inFlightPoll
+		if d < step {
+			step = d
+		}
+		sleep(step)
+		d -= step
+		stats, err := c.IOCounters()
+		if err != nil {
+			continue
+		}
+		for name, s := range stats {
+			if s.IopsInProgress > peaks[name] {
+				peaks[name] = s.IopsInProgress
+			}
+		}
+	}
+	return peaks
+}
+
+// Snapshot is the IO counters of every device at Offset from the start of
+// Snapshots.
+type Snapshot struct {
+	Offset time.Duration
+	Stats  map[string]disk.IOCountersStat
+}
+
+// Snapshots spends d reading the counters of every device each every and
+// returns the samples, the last one taken at d. Offsets are nominal, the
+// time slept so far, rather than measured. Failed reads are skipped, like
+// in PeakInFlight.
+func Snapshots(c Collector, d, every time.Duration) []Snapshot {
+	var snapshots []Snapshot
+	var offset time.Duration
+	for offset < d {
+		step := every
+		if d-offset < step {
+			step = d - offset
+		}
+		sleep(step)
+		offset += step
+		stats, err := c.IOCounters()
+		if err != nil {
+			continue
+		}
+		snapshots = append(snapshots, Snapshot{Offset: offset, Stats: stats})
+	}
+	return snapshots
+}
+
+// Retry retries failed IO counter reads, which fail intermittently under
+// load on some virtualized hosts. Every failed attempt is reported on
+// stderr.
+type Retry struct {
+	Collector
+	Retries int
+	Delay   time.Duration
+}
+
+func (c Retry) IOCounters(names ...string) (map[string]disk.IOCountersStat, error) {
+	stats, err := c.Collector.IOCounters(names...)
+	for attempt := 1; err != nil && attempt <= c.Retries; attempt++ {
+		target := strings.Join(names, ", ")
+		if len(target) == 0 {
+			target = "all devices"
+		}
+		fmt.Fprintf(os.Stderr, "Failed to get IO counters of %s, retrying (%d/%d), error: %v\n", target, attempt, c.Retries, err)
+		sleep(c.Delay)
+		stats, err = c.Collector.IOCounters(names...)
+	}
+	return stats, err
+}
+
+// Context bounds every read by Ctx: a read still running when Ctx is done
+// is abandoned and fails with the error of Ctx, so a hung mount or a dying
+// disk cannot stall the caller past its deadline. The abandoned read cannot
+// be interrupted and keeps its goroutine until it returns.
+type Context struct {
+	Collector
+	Ctx context.Context
+}
+
+func (c Context) Partitions(all bool) ([]disk.PartitionStat, error) {
+	type result struct {
+		parts []disk.PartitionStat
+		err   error
+	}
+	if err := c.Ctx.Err(); err != nil {
+		return nil, err
+	}
+	done := make(chan result, 1)
+	go func() {
+		parts, err := c.Collector.Partitions(all)
+		done <- result{parts, err}
+	}()
+	select {
+	case r := <-done:
+		return r.parts, r.err
+	case <-c.Ctx.Done():
+		return nil, c.Ctx.Err()
+	}
+}
+
+func (c Context) IOCounters(names ...string) (map[string]disk.IOCountersStat, error) {
+	type result struct {
+		stats map[string]disk.IOCountersStat
+		err   error
+	}
+	if err := c.Ctx.Err(); err != nil {
+		return nil, err
+	}
+	done := make(chan result, 1)
+	go func() {
+		stats, err := c.Collector.IOCounters(names...)
+		done <- result{stats, err}
+	}()
+	select {
+	case r := <-done:
+		return r.stats, r.err
+	case <-c.Ctx.Done():
+		return nil, c.Ctx.Err()
+	}
+}
+
+// Static serves fixed partitions and counters, for tests of code built on a
+// Collector. IOCounters looks the paths up by their base name, like the
+// Linux collector.
+type Static struct {
+	Parts    []disk.PartitionStat
+	Counters map[string]disk.IOCountersStat
+}
+
+func (s Static) Partitions(all bool) ([]disk.PartitionStat, error) {
+	return s.Parts, nil
+}
+
+func (s Static) IOCounters(names ...string) (map[string]disk.IOCountersStat, error) {
+	if len(names) == 0 {
+		return s.Counters, nil
+	}
+	ret := map[string]disk.IOCountersStat{}
+	for _, path := range names {
+		if v, ok := s.Counters[s.DeviceName(path)]; ok {
+			ret[v.Name] = v
+		}
+	}
+	return ret, nil
+}
+
+func (Static) DeviceName(path string) string {
+	return filepath.Base(path)
+}
+
+// gopsutilCollector passes straight through to gopsutil, whose device
+// names match the partition device paths on Linux.
+type gopsutilCollector struct{}
+
+func (gopsutilCollector) Partitions(all bool) ([]disk.PartitionStat, error) {
+	return disk.Partitions(all)
+}
+
+func (gopsutilCollector) IOCounters(names ...string) (map[string]disk.IOCountersStat, error) {
+	return disk.IOCounters(names...)
+}
+
+func (gopsutilCollector) DeviceName(path string) string {
+	return filepath.Base(path)
+}
@@ -0,0 +1,150 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+func TestGopsutilDeviceName(t *testing.T) {
+	if got := (gopsutilCollector{}).DeviceName("/dev/nvme0n1p2"); got != "nvme0n1p2" {
+		t.Errorf("DeviceName() = %q, want nvme0n1p2", got)
+	}
+}
+
+// flakyCollector fails the first failures IO counter reads.
+type flakyCollector struct {
+	gopsutilCollector
+	failures int
+	calls    *int
+}
+
+func (c flakyCollector) IOCounters(names ...string) (map[string]disk.IOCountersStat, error) {
+	*c.calls++
+	if *c.calls <= c.failures {
+		return nil, errors.New("resource temporarily unavailable")
+	}
+	return map[string]disk.IOCountersStat{"sda": {Name: "sda"}}, nil
+}
+
+func TestRetryCollector(t *testing.T) {
+	var slept time.Duration
+	sleep = func(d time.Duration) { slept += d }
+	defer func() { sleep = time.Sleep }()
+
+	calls := 0
+	c := Retry{Collector: flakyCollector{failures: 2, calls: &calls}, Retries: 3, Delay: 100 * time.Millisecond}
+	stats, err := c.IOCounters("/dev/sda1")
+	if err != nil || len(stats) != 1 || calls != 3 || slept != 200*time.Millisecond {
+		t.Errorf("IOCounters() = %v, %v after %d calls and %s of sleep, want success after 3 calls", stats, err, calls, slept)
+	}
+
+	calls = 0
+	c = Retry{Collector: flakyCollector{failures: 5, calls: &calls}, Retries: 2, Delay: time.Millisecond}
+	if _, err := c.IOCounters("/dev/sda1"); err == nil || calls != 3 {
+		t.Errorf("IOCounters() = %v after %d calls, want an error after 3 calls", err, calls)
+	}
+}
+
+func TestDeviceErrors(t *testing.T) {
+	err := DeviceErrors{"sdc": errors.New("permission denied"), "sdb": errors.New("no such device")}
+	if got, want := err.Error(), "failed to get IO counters of sdb: no such device, sdc: permission denied"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+// burstCollector reports the IOs in flight of sda from a fixed sequence.
+type burstCollector struct {
+	gopsutilCollector
+	inFlight []uint64
+	calls    *int
+}
+
+func (c burstCollector) IOCounters(names ...string) (map[string]disk.IOCountersStat, error) {
+	i := *c.calls
+	*c.calls++
+	if i >= len(c.inFlight) {
+		return nil, errors.New("no more samples")
+	}
+	return map[string]disk.IOCountersStat{"sda": {Name: "sda", IopsInProgress: c.inFlight[i]}}, nil
+}
+
+func TestPeakInFlight(t *testing.T) {
+	var slept time.Duration
+	sleep = func(d time.Duration) { slept += d }
+	defer func() { sleep = time.Sleep }()
+
+	calls := 0
+	c := burstCollector{inFlight: []uint64{2, 40, 3}, calls: &calls}
+	peaks := PeakInFlight(c, 350*time.Millisecond)
+	if peaks["sda"] != 40 || calls != 4 || slept != 350*time.Millisecond {
+		t.Errorf("PeakInFlight = %v after %d reads and %s of sleep, want sda 40 after 4 reads and 350ms", peaks, calls, slept)
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	var slept time.Duration
+	sleep = func(d time.Duration) { slept += d }
+	defer func() { sleep = time.Sleep }()
+
+	calls := 0
+	c := burstCollector{inFlight: []uint64{2, 40, 3}, calls: &calls}
+	snapshots := Snapshots(c, 1250*time.Millisecond, 500*time.Millisecond)
+	var offsets []time.Duration
+	for _, s := range snapshots {
+		offsets = append(offsets, s.Offset)
+	}
+	want := []time.Duration{500 * time.Millisecond, time.Second, 1250 * time.Millisecond}
+	if !reflect.DeepEqual(offsets, want) || snapshots[1].Stats["sda"].IopsInProgress != 40 || slept != 1250*time.Millisecond {
+		t.Errorf("Snapshots() offsets = %v, second in flight %d after %s of sleep, want %v, 40 and 1.25s", offsets, snapshots[1].Stats["sda"].IopsInProgress, slept, want)
+	}
+}
+
+// hungCollector blocks every IO counter read until release is closed.
+type hungCollector struct {
+	Static
+	release chan struct{}
+}
+
+func (c hungCollector) IOCounters(names ...string) (map[string]disk.IOCountersStat, error) {
+	<-c.release
+	return c.Static.IOCounters(names...)
+}
+
+func TestContext(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	c := Context{Collector: hungCollector{Static: Static{Parts: []disk.PartitionStat{{Device: "/dev/sda1"}}}, release: release}, Ctx: ctx}
+	if parts, err := c.Partitions(false); err != nil || len(parts) != 1 {
+		t.Errorf("Partitions() = %v, %v, want the partition before the deadline", parts, err)
+	}
+	if _, err := c.IOCounters(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("IOCounters() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if _, err := c.Partitions(false); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Partitions() after the deadline error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestStatic(t *testing.T) {
+	c := Static{
+		Parts:    []disk.PartitionStat{{Device: "/dev/sda1", Mountpoint: "/"}},
+		Counters: map[string]disk.IOCountersStat{"sda1": {Name: "sda1", ReadCount: 1}, "sdb": {Name: "sdb"}},
+	}
+	if parts, err := c.Partitions(false); err != nil || len(parts) != 1 {
+		t.Errorf("Partitions() = %v, %v", parts, err)
+	}
+	stats, err := c.IOCounters("/dev/sda1", "/dev/sdc1")
+	if err != nil || len(stats) != 1 || stats["sda1"].ReadCount != 1 {
+		t.Errorf("IOCounters(/dev/sda1, /dev/sdc1) = %v, %v, want sda1 only", stats, err)
+	}
+	if stats, _ := c.IOCounters(); len(stats) != 2 {
+		t.Errorf("IOCounters() = %v, want every device", stats)
+	}
+}
@@ -0,0 +1,79 @@
+package collector
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// Counter is a raw IO counter and the metric group reporting it.
+type Counter struct {
+	Name    string
+	Type    string
+	Comment string
+	Value   func(disk.IOCountersStat) uint64
+}
+
+// Counters lists the raw IO counters, in the order they are reported.
+var Counters = []Counter{
+	{"disk_read_bytes", "COUNTER", "These values count the number of bytes read from or written to this block device.", func(v disk.IOCountersStat) uint64 { return v.ReadBytes }},
+	{"disk_write_bytes", "COUNTER", "These values count the number of bytes read from or written to this block device.", func(v disk.IOCountersStat) uint64 { return v.WriteBytes }},
+	{"disk_read_count", "COUNTER", "These values increment when an I/O request completes.", func(v disk.IOCountersStat) uint64 { return v.ReadCount }},
+	{"disk_write_count", "COUNTER", "These values increment when an I/O request completes.", func(v disk.IOCountersStat) uint64 { return v.WriteCount }},
+	{"disk_read_time", "COUNTER", "These values count the number of milliseconds that I/O requests have waited on this block device. If there are multiple I/O requests waiting, these values will increase at a rate greater than 1000/second; for example, if 60 read requests wait for an average of 30 ms, the read_time field will increase by 60*30 = 1800.", func(v disk.IOCountersStat) uint64 { return v.ReadTime }},
+	{"disk_write_time", "COUNTER", "These values count the number of milliseconds that I/O requests have waited on this block device. If there are multiple I/O requests waiting, these values will increase at a rate greater than 1000/second; for example, if 60 read requests wait for an average of 30 ms, the read_time field will increase by 60*30 = 1800.", func(v disk.IOCountersStat) uint64 { return v.WriteTime }},
+	{"disk_io_time", "COUNTER", "This value counts the number of milliseconds during which the device has had I/O requests queued.", func(v disk.IOCountersStat) uint64 { return v.IoTime }},
+	{"disk_weighted_io", "COUNTER", "This value counts the number of milliseconds that I/O requests have waited on this block device. If there are multiple I/O requests waiting, this value will increase as the product of the number of milliseconds times the number of requests waiting (see disk_read_time for an example).", func(v disk.IOCountersStat) uint64 { return v.WeightedIO }},
+	{"disk_iops_in_progress", "GAUGE", "This value counts the number of I/O requests that have been issued to the device driver but have not yet completed. It does not include I/O requests that are in the queue but not yet issued to the device driver.", func(v disk.IOCountersStat) uint64 { return v.IopsInProgress }},
+	{"disk_merged_read_count", "COUNTER", "Reads and writes which are adjacent to each other may be merged for efficiency. Thus, two 4K reads may become one 8K read before it is ultimately handed to the disk, and so it will be counted (and queued) as only one I/O. These fields lets you know how often this was done.", func(v disk.IOCountersStat) uint64 { return v.MergedReadCount }},
+	{"disk_merged_write_count", "COUNTER", "Reads and writes which are adjacent to each other may be merged for efficiency. Thus, two 4K reads may become one 8K read before it is ultimately handed to the disk, and so it will be counted (and queued) as only one I/O. These fields lets you know how often this was done.", func(v disk.IOCountersStat) uint64 { return v.MergedWriteCount }},
+}
+
+// Devices collects the Counters of the devices backing the mounted
+// partitions, or of every device when All is set. Each sample is tagged
+// with the device and its first mountpoint, empty for an unmounted one.
+type Devices struct {
+	Collector Collector
+	All       bool
+}
+
+// Collect returns one group per Counter. The counters of all devices are
+// read in one sweep; when only some devices failed, their DeviceErrors is
+// returned along with the groups of the others. A counter the platform
+// does not track is reported as 0.
+func (d Devices) Collect() ([]MetricGroup, error) {
+	parts, err := d.Collector.Partitions(false)
+	if err != nil {
+		return nil, err
+	}
+	mountpoints := map[string]string{}
+	for _, p := range parts {
+		name := d.Collector.DeviceName(p.Device)
+		if _, ok := mountpoints[name]; !ok {
+			mountpoints[name] = p.Mountpoint
+		}
+	}
+	stats, err := d.Collector.IOCounters()
+	var partial DeviceErrors
+	if err != nil && !errors.As(err, &partial) {
+		return nil, err
+	}
+	names := make([]string, 0, len(stats))
+	for name := range stats {
+		if _, mounted := mountpoints[name]; mounted || d.All {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	groups := make([]MetricGroup, len(Counters))
+	for i, c := range Counters {
+		groups[i] = MetricGroup{Name: c.Name, Type: c.Type, Comment: c.Comment}
+		for _, name := range names {
+			tags := map[string]string{"device": name, "mountpoint": mountpoints[name]}
+			groups[i].AddIntMetric(tags, c.Value(stats[name]))
+		}
+	}
+	return groups, err
+}
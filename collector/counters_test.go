@@ -0,0 +1,81 @@
+package collector
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+func TestDevicesCollect(t *testing.T) {
+	c := Static{
+		Parts: []disk.PartitionStat{
+			{Device: "/dev/sda1", Mountpoint: "/"},
+			{Device: "/dev/sda1", Mountpoint: "/srv"},
+		},
+		Counters: map[string]disk.IOCountersStat{
+			"sda1": {Name: "sda1", ReadBytes: 4096, IopsInProgress: 2},
+			"sdb":  {Name: "sdb", ReadBytes: 512},
+		},
+	}
+
+	groups, err := Devices{Collector: c}.Collect()
+	if err != nil || len(groups) != len(Counters) {
+		t.Fatalf("Collect() = %d groups, %v, want %d groups", len(groups), err, len(Counters))
+	}
+	want := []Metric{{Tags: map[string]string{"device": "sda1", "mountpoint": "/"}, IntValue: 4096, IsInt: true}}
+	if g := groups[0]; g.Name != "disk_read_bytes" || g.Type != "COUNTER" || !reflect.DeepEqual(g.Metrics, want) {
+		t.Errorf("Collect()[0] = %+v, want disk_read_bytes of sda1 only", g)
+	}
+	if g := groups[8]; g.Name != "disk_iops_in_progress" || g.Type != "GAUGE" || g.Metrics[0].IntValue != 2 {
+		t.Errorf("Collect()[8] = %+v, want disk_iops_in_progress gauge of 2", g)
+	}
+
+	groups, err = Devices{Collector: c, All: true}.Collect()
+	want = []Metric{
+		{Tags: map[string]string{"device": "sda1", "mountpoint": "/"}, IntValue: 4096, IsInt: true},
+		{Tags: map[string]string{"device": "sdb", "mountpoint": ""}, IntValue: 512, IsInt: true},
+	}
+	if err != nil || !reflect.DeepEqual(groups[0].Metrics, want) {
+		t.Errorf("Collect() with All = %+v, %v, want %+v", groups[0].Metrics, err, want)
+	}
+}
+
+// failingCollector fails to read the counters of sdb, or of every device
+// when err is not a DeviceErrors.
+type failingCollector struct {
+	Static
+	err error
+}
+
+func (c failingCollector) IOCounters(names ...string) (map[string]disk.IOCountersStat, error) {
+	var partial DeviceErrors
+	if !errors.As(c.err, &partial) {
+		return nil, c.err
+	}
+	stats, _ := c.Static.IOCounters(names...)
+	delete(stats, "sdb")
+	return stats, c.err
+}
+
+func TestDevicesCollectErrors(t *testing.T) {
+	counters := Static{Counters: map[string]disk.IOCountersStat{
+		"sda": {Name: "sda", WriteCount: 3},
+		"sdb": {Name: "sdb", WriteCount: 5},
+	}}
+	c := failingCollector{counters, DeviceErrors{"sdb": errors.New("no such device")}}
+	groups, err := Devices{Collector: c, All: true}.Collect()
+	var partial DeviceErrors
+	if !errors.As(err, &partial) || partial["sdb"] == nil {
+		t.Errorf("Collect() error = %v, want the DeviceErrors of sdb", err)
+	}
+	if g := groups[3]; g.Name != "disk_write_count" || len(g.Metrics) != 1 || g.Metrics[0].IntValue != 3 {
+		t.Errorf("Collect()[3] = %+v, want the disk_write_count of sda", g)
+	}
+
+	c = failingCollector{counters, errors.New("permission denied")}
+	if groups, err := (Devices{Collector: c, All: true}).Collect(); err == nil || groups != nil {
+		t.Errorf("Collect() = %v, %v, want the IO counters error", groups, err)
+	}
+}
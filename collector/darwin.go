@@ -0,0 +1,60 @@
+//go:build darwin
+// +build darwin
+
+package collector
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+func New() Collector {
+	return darwinCollector{}
+}
+
+// darwinPartition matches macOS partition device names and captures the
+// whole disk they live on: disk0s2, and APFS volumes such as disk3s1s1.
+var darwinPartition = regexp.MustCompile(`^(disk[0-9]+)(s[0-9]+)*$`)
+
+// darwinDiskName maps a partition device path to the IOKit name of its
+// disk, or returns "" when the path is not a disk partition (devfs, network
+// and disk image mounts).
+func darwinDiskName(device string) string {
+	m := darwinPartition.FindStringSubmatch(strings.TrimPrefix(device, "/dev/"))
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+// darwinCollector reads all disk statistics at once and maps partitions to
+// their disk, because IOKit only keeps statistics per disk.
+type darwinCollector struct{}
+
+func (darwinCollector) Partitions(all bool) ([]disk.PartitionStat, error) {
+	return disk.Partitions(all)
+}
+
+func (darwinCollector) IOCounters(names ...string) (map[string]disk.IOCountersStat, error) {
+	all, err := disk.IOCounters()
+	if err != nil && !cgoEnabled {
+		return all, fmt.Errorf("%v: IO counters on macOS need a build with cgo", err)
+	}
+	if len(names) == 0 || err != nil {
+		return all, err
+	}
+	ret := map[string]disk.IOCountersStat{}
+	for _, name := range names {
+		if v, ok := all[darwinDiskName(name)]; ok {
+			ret[v.Name] = v
+		}
+	}
+	return ret, nil
+}
+
+func (darwinCollector) DeviceName(path string) string {
+	return darwinDiskName(path)
+}
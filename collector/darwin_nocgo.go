@@ -0,0 +1,7 @@
+//go:build darwin && !cgo
+// +build darwin,!cgo
+
+package collector
+
+// cgoEnabled reports whether gopsutil can read IO counters through IOKit.
+const cgoEnabled = false
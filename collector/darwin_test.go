@@ -0,0 +1,23 @@
+//go:build darwin
+// +build darwin
+
+package collector
+
+import (
+	"testing"
+)
+
+func TestDarwinDiskName(t *testing.T) {
+	tests := map[string]string{
+		"/dev/disk0s2":   "disk0",
+		"/dev/disk3s1s1": "disk3",
+		"/dev/disk4":     "disk4",
+		"devfs":          "",
+		"map auto_home":  "",
+	}
+	for in, want := range tests {
+		if got := darwinDiskName(in); got != want {
+			t.Errorf("darwinDiskName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package collector
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// MetricGroup is one metric, such as disk_read_bytes, and its samples.
+type MetricGroup struct {
+	Comment string
+	Type    string
+	Name    string
+	Metrics []Metric
+}
+
+func (g *MetricGroup) AddMetric(tags map[string]string, value float64) {
+	g.Metrics = append(g.Metrics, Metric{
+		Tags:  tags,
+		Value: value,
+	})
+}
+
+// AddIntMetric adds a sample holding an exact integer. Raw counters go
+// through here because float64 cannot represent every value above 2^53.
+func (g *MetricGroup) AddIntMetric(tags map[string]string, value uint64) {
+	g.Metrics = append(g.Metrics, Metric{
+		Tags:     tags,
+		IntValue: value,
+		IsInt:    true,
+	})
+}
+
+// SetTimestamp sets the Timestamp of every sample of the group.
+func (g *MetricGroup) SetTimestamp(ts int64) {
+	for i := range g.Metrics {
+		g.Metrics[i].Timestamp = ts
+	}
+}
+
+type Metric struct {
+	Tags     map[string]string
+	Value    float64
+	IntValue uint64
+	IsInt    bool
+	// Timestamp is when the sample was collected, in unix milliseconds, or
+	// 0 to print it without a timestamp.
+	Timestamp int64
+}
+
+// FormatValue renders the sample value, keeping integer samples exact.
+func (m Metric) FormatValue() string {
+	if m.IsInt {
+		return strconv.FormatUint(m.IntValue, 10)
+	}
+	return fmt.Sprintf("%v", m.Value)
+}
@@ -0,0 +1,8 @@
+//go:build !darwin && !freebsd && !openbsd && !windows
+// +build !darwin,!freebsd,!openbsd,!windows
+
+package collector
+
+func New() Collector {
+	return gopsutilCollector{}
+}
@@ -0,0 +1,25 @@
+//go:build windows
+// +build windows
+
+package collector
+
+import (
+	"testing"
+)
+
+func TestDiskPerformanceCounters(t *testing.T) {
+	p := diskPerformance{BytesRead: 4096, ReadCount: 2, ReadTime: 25000, WriteTime: 10000000, QueueDepth: 3}
+	v := p.counters("C:")
+	if v.Name != "C:" || v.ReadBytes != 4096 || v.ReadCount != 2 || v.IopsInProgress != 3 {
+		t.Errorf("counters() = %+v", v)
+	}
+	if v.ReadTime != 2 || v.WriteTime != 1000 {
+		t.Errorf("counters() times = %d, %d ms, want 2, 1000", v.ReadTime, v.WriteTime)
+	}
+}
+
+func TestWindowsDeviceName(t *testing.T) {
+	if got := (windowsCollector{}).DeviceName(`c:\`); got != "C:" {
+		t.Errorf("DeviceName() = %q, want C:", got)
+	}
+}
@@ -0,0 +1,17 @@
+//go:build freebsd || openbsd
+// +build freebsd openbsd
+
+package main
+
+import (
+	"testing"
+)
+
+func TestBSDUnsupportedGroups(t *testing.T) {
+	if groupSupported("disk_merged_read_count") {
+		t.Errorf("merged counts are not available on the BSDs")
+	}
+	if !groupSupported("disk_read_bytes") {
+		t.Errorf("read bytes are available on the BSDs")
+	}
+}
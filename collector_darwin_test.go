@@ -0,0 +1,17 @@
+//go:build darwin
+// +build darwin
+
+package main
+
+import (
+	"testing"
+)
+
+func TestDarwinUnsupportedGroups(t *testing.T) {
+	if groupSupported("disk_io_time") || groupSupported("disk_util_percent") {
+		t.Errorf("the busy time is not available on macOS")
+	}
+	if !groupSupported("disk_read_wait_ms") {
+		t.Errorf("the read time is available on macOS")
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/jadiunr/check-disk-io/collector"
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+func TestCollectionErrors(t *testing.T) {
+	var c collectionErrors
+	c.record("/dev/sda1", nil)
+	if total, err := c.err(); total || err != nil {
+		t.Fatalf("err() = %v, %v, want false, nil", total, err)
+	}
+
+	c.record("/dev/sdb1", errors.New("no such device"))
+	if got := c.count(); got != 1 {
+		t.Errorf("count() = %d, want 1", got)
+	}
+	total, err := c.err()
+	if total || err == nil || !strings.Contains(err.Error(), "1 of 2 devices: /dev/sdb1: no such device") {
+		t.Errorf("err() after a partial failure = %v, %v", total, err)
+	}
+
+	c = collectionErrors{}
+	c.record("/dev/sda1", errors.New("permission denied"))
+	if total, err := c.err(); !total || err == nil {
+		t.Errorf("err() after every lookup failed = %v, %v, want true", total, err)
+	}
+
+	c = collectionErrors{partitions: errors.New("no /proc/mounts")}
+	if total, err := c.err(); !total || err == nil || !strings.Contains(err.Error(), "partitions") {
+		t.Errorf("err() after partitions failed = %v, %v, want true", total, err)
+	}
+	if got := c.count(); got != 1 {
+		t.Errorf("count() after partitions failed = %d, want 1", got)
+	}
+
+	c = collectionErrors{}
+	stats := map[string]disk.IOCountersStat{"sda": {Name: "sda"}, "sdc": {Name: "sdc"}}
+	c.recordSweep("all devices", stats, fmt.Errorf("read: %w", collector.DeviceErrors{"sdb": errors.New("no such device")}))
+	if total, err := c.err(); total || err == nil || !strings.Contains(err.Error(), "1 of 3 devices: sdb: no such device") {
+		t.Errorf("err() after a sweep failed on one device = %v, %v, want a partial failure", total, err)
+	}
+	c = collectionErrors{}
+	c.recordSweep("all devices", stats, errors.New("query failed"))
+	if total, err := c.err(); total || err == nil {
+		t.Errorf("err() after a sweep returned counters and an error = %v, %v, want a partial failure", total, err)
+	}
+	c = collectionErrors{}
+	c.recordSweep("all devices", nil, errors.New("no /proc/diskstats"))
+	if total, err := c.err(); !total || err == nil {
+		t.Errorf("err() after a sweep returned nothing = %v, %v, want a total failure", total, err)
+	}
+
+	c = collectionErrors{}
+	c.recordFirstSample(nil, errors.New("resource temporarily unavailable"))
+	c.recordSweep("all devices", stats, nil)
+	if total, err := c.err(); !total || err == nil || c.count() != 1 {
+		t.Errorf("err() after the first --rate sample read nothing = %v, %v, count %d, want a total failure", total, err, c.count())
+	}
+
+	c = collectionErrors{}
+	c.record("all devices", fmt.Errorf("read: %w", context.DeadlineExceeded))
+	c.record("/dev/sdb", errors.New("no such device"))
+	if c.timeouts != 1 {
+		t.Errorf("timeouts = %d after one timed out lookup, want 1", c.timeouts)
+	}
+}
+
+func TestPlatformGroups(t *testing.T) {
+	names := platformGroups()
+	if !sort.StringsAreSorted(names) {
+		t.Errorf("platformGroups() = %v, want sorted names", names)
+	}
+	listed := map[string]bool{}
+	for _, n := range names {
+		if !groupSupported(n) {
+			t.Errorf("platformGroups() lists unsupported group %s", n)
+		}
+		listed[n] = true
+	}
+	if !listed["disk_read_bytes"] || !listed["disk_io_scrape_success"] {
+		t.Errorf("platformGroups() = %v, want the byte counters and disk_io_scrape_success", names)
+	}
+}
@@ -0,0 +1,20 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"testing"
+)
+
+func TestWindowsUnsupportedGroups(t *testing.T) {
+	if groupSupported("disk_weighted_io") {
+		t.Errorf("weighted IO time is not available on windows")
+	}
+	if !groupSupported("disk_iops_in_progress") {
+		t.Errorf("the queue depth is available on windows")
+	}
+	if groupSupported("disk_inodes_used") || !groupSupported("disk_used_bytes") {
+		t.Errorf("only the space usage is available on windows")
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/sensu/sensu-plugin-sdk/sensu"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// configTags is the config file key holding the static tags as a map.
+	configTags = "tags"
+	// configThresholds is the config file key holding the per-device
+	// threshold blocks.
+	configThresholds = "thresholds"
+)
+
+// ruleOptions are the options that take per-device rules and may therefore
+// appear in the threshold blocks of the config file.
+var ruleOptions = func() map[string]bool {
+	options := map[string]bool{}
+	for _, limit := range []string{"read-bps", "write-bps", "read-iops", "write-iops", "read-await-ms", "write-await-ms", "queue-depth"} {
+		options["warn-"+limit] = true
+		options["crit-"+limit] = true
+	}
+	return options
+}()
+
+// flagConfig is the plugin config as the flags and environment variables
+// set it, before the --config file and the annotations were applied. A
+// --daemon reload starts over from it, so options removed from the file
+// return to their flag or default value.
+var flagConfig *Config
+
+// explicitOptions returns the paths of the options set on the command line
+// in args or through their environment variable, which win over the config
+// file.
+func explicitOptions(args []string, options []*sensu.PluginConfigOption) map[string]bool {
+	byArgument := map[string]string{}
+	explicit := map[string]bool{}
+	for _, opt := range options {
+		byArgument[opt.Argument] = opt.Path
+		if _, ok := os.LookupEnv(opt.Env); len(opt.Env) > 0 && ok {
+			explicit[opt.Path] = true
+		}
+	}
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "--") {
+			continue
+		}
+		name := strings.TrimPrefix(arg, "--")
+		if i := strings.IndexByte(name, '='); i >= 0 {
+			name = name[:i]
+		}
+		if p, ok := byArgument[name]; ok {
+			explicit[p] = true
+		}
+	}
+	return explicit
+}
+
+// loadConfig sets the options from the YAML --config file, leaving those in
+// explicit alone. Its keys are the option names, as for annotations, plus
+//
+//	tags:
+//	  env: prod
+//	thresholds:
+//	  nvme*:
+//	    crit-write-await-ms: 20
+//	  default:
+//	    warn-read-bps: 200MiB
+//
+// where tags is the --tag list as a map and each threshold block gives the
+// limits of the devices matching its pattern, in the order of the file.
+func loadConfig(file string, options []*sensu.PluginConfigOption, explicit map[string]bool) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var settings yaml.MapSlice
+	if err := yaml.Unmarshal(data, &settings); err != nil {
+		return err
+	}
+	byPath := map[string]*sensu.PluginConfigOption{}
+	for _, opt := range options {
+		byPath[opt.Path] = opt
+	}
+	var keys []string
+	values := map[string]interface{}{}
+	set := func(key, option string, value interface{}) error {
+		if _, ok := values[option]; ok {
+			return fmt.Errorf("%s: %s is set twice", key, option)
+		}
+		keys = append(keys, option)
+		values[option] = value
+		return nil
+	}
+	for _, item := range settings {
+		key := fmt.Sprint(item.Key)
+		switch key {
+		case configTags:
+			tags, ok := item.Value.(yaml.MapSlice)
+			if !ok {
+				return fmt.Errorf("%s: must be a map of tag names to values", key)
+			}
+			var list []interface{}
+			for _, tag := range tags {
+				list = append(list, fmt.Sprintf("%v=%v", tag.Key, tag.Value))
+			}
+			if err := set(key, "tag", list); err != nil {
+				return err
+			}
+		case configThresholds:
+			rules, err := thresholdBlocks(item.Value)
+			if err != nil {
+				return fmt.Errorf("%s: %v", key, err)
+			}
+			var names []string
+			for option := range rules {
+				names = append(names, option)
+			}
+			sort.Strings(names)
+			for _, option := range names {
+				if err := set(key, option, rules[option]); err != nil {
+					return err
+				}
+			}
+		case "config":
+			return fmt.Errorf("%s: cannot be set in the config file", key)
+		default:
+			if _, ok := byPath[key]; !ok {
+				return fmt.Errorf("%s: unknown option", key)
+			}
+			if err := set(key, key, item.Value); err != nil {
+				return err
+			}
+		}
+	}
+	for _, key := range keys {
+		if explicit[key] {
+			continue
+		}
+		if err := setConfigOption(byPath[key], values[key]); err != nil {
+			return fmt.Errorf("%s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// thresholdBlocks turns the threshold blocks of the config file into the
+// per-device rules of each option, such as "nvme*:20,default:50".
+func thresholdBlocks(value interface{}) (map[string]string, error) {
+	blocks, ok := value.(yaml.MapSlice)
+	if !ok {
+		return nil, fmt.Errorf("must be a map of device patterns to limits")
+	}
+	rules := map[string]string{}
+	for _, block := range blocks {
+		pattern := fmt.Sprint(block.Key)
+		limits, ok := block.Value.(yaml.MapSlice)
+		if !ok {
+			return nil, fmt.Errorf("%s: must be a map of threshold options to limits", pattern)
+		}
+		for _, limit := range limits {
+			option := fmt.Sprint(limit.Key)
+			if !ruleOptions[option] {
+				return nil, fmt.Errorf("%s: %s is not a per-device threshold option", pattern, option)
+			}
+			if len(rules[option]) > 0 {
+				rules[option] += ","
+			}
+			rules[option] += fmt.Sprintf("%s:%v", pattern, limit.Value)
+		}
+	}
+	return rules, nil
+}
+
+// setConfigOption sets an option from a value of the config file: strings
+// from any single value, lists from a list or a single value, key=value
+// options from a map, everything else as the YAML value decodes.
+func setConfigOption(opt *sensu.PluginConfigOption, value interface{}) error {
+	v := reflect.Indirect(reflect.ValueOf(opt.Value))
+	switch {
+	case v.Kind() == reflect.String:
+		if !isScalar(value) {
+			return fmt.Errorf("must be a single value")
+		}
+		v.SetString(fmt.Sprint(value))
+		return nil
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		list, ok := value.([]interface{})
+		if !ok {
+			list = []interface{}{value}
+		}
+		strs := []string{}
+		for _, e := range list {
+			if !isScalar(e) {
+				return fmt.Errorf("must be a list of single values")
+			}
+			strs = append(strs, fmt.Sprint(e))
+		}
+		v.Set(reflect.ValueOf(strs))
+		return nil
+	case v.Kind() == reflect.Map:
+		m, ok := value.(yaml.MapSlice)
+		if !ok {
+			return fmt.Errorf("must be a map")
+		}
+		strs := map[string]string{}
+		for _, item := range m {
+			strs[fmt.Sprint(item.Key)] = fmt.Sprint(item.Value)
+		}
+		v.Set(reflect.ValueOf(strs))
+		return nil
+	}
+	if !isScalar(value) {
+		return fmt.Errorf("must be a single value")
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, opt.Value)
+}
+
+// isScalar reports whether a decoded YAML value is a single value rather
+// than a list or a map.
+func isScalar(value interface{}) bool {
+	switch value.(type) {
+	case []interface{}, yaml.MapSlice, map[interface{}]interface{}:
+		return false
+	}
+	return value != nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sensu/sensu-plugin-sdk/sensu"
+)
+
+func TestExplicitOptions(t *testing.T) {
+	options := []*sensu.PluginConfigOption{
+		{Path: "rate", Env: "CHECK_DISK_IO_RATE", Argument: "rate"},
+		{Path: "format", Env: "CHECK_DISK_IO_FORMAT", Argument: "format"},
+		{Path: "retries", Env: "CHECK_DISK_IO_RETRIES", Argument: "retries"},
+		{Path: "tag", Env: "CHECK_DISK_IO_TAG", Argument: "tag"},
+	}
+	t.Setenv("CHECK_DISK_IO_RETRIES", "2")
+	got := explicitOptions([]string{"--rate", "--format=json", "value", "--", "--tag"}, options)
+	want := map[string]bool{"rate": true, "format": true, "retries": true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("explicitOptions() = %v, want %v", got, want)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	var (
+		format  string
+		retries int
+		rate    bool
+		tags    []string
+		fstypes []string
+		headers map[string]string
+		warn    string
+		crit    string
+	)
+	options := []*sensu.PluginConfigOption{
+		{Path: "format", Value: &format},
+		{Path: "retries", Value: &retries},
+		{Path: "rate", Value: &rate},
+		{Path: "tag", Value: &tags},
+		{Path: "fstype-include", Value: &fstypes},
+		{Path: "otlp-header", Value: &headers},
+		{Path: "warn-read-bps", Value: &warn},
+		{Path: "crit-write-await-ms", Value: &crit},
+	}
+	root := t.TempDir()
+	file := filepath.Join(root, "check-disk-io.yml")
+	writeSysFile(t, root, "check-disk-io.yml", `
+format: json
+retries: 3
+rate: true
+fstype-include: ext4
+otlp-header:
+  Authorization: Bearer x
+tags:
+  env: prod
+  team: storage
+thresholds:
+  nvme*:
+    crit-write-await-ms: 20
+    warn-read-bps: 500MiB
+  default:
+    warn-read-bps: 100MiB
+`)
+	format = "prometheus"
+	if err := loadConfig(file, options, map[string]bool{"format": true}); err != nil {
+		t.Fatal(err)
+	}
+	// The flag wins over the file.
+	if format != "prometheus" {
+		t.Errorf("format = %q, want prometheus", format)
+	}
+	if retries != 3 || !rate || !reflect.DeepEqual(fstypes, []string{"ext4"}) || headers["Authorization"] != "Bearer x" {
+		t.Errorf("retries = %d, rate = %v, fstype-include = %v, otlp-header = %v", retries, rate, fstypes, headers)
+	}
+	if !reflect.DeepEqual(tags, []string{"env=prod", "team=storage"}) {
+		t.Errorf("tag = %v", tags)
+	}
+	if warn != "nvme*:500MiB,default:100MiB" || crit != "nvme*:20" {
+		t.Errorf("warn-read-bps = %q, crit-write-await-ms = %q", warn, crit)
+	}
+
+	for config, want := range map[string]string{
+		"bogus: 1":                            "bogus: unknown option",
+		"retries: [1]":                        "retries: must be a single value",
+		"retries: many":                       "retries: json",
+		"tags: prod":                          "tags: must be a map",
+		"thresholds:\n  sda:\n    rate: true": "rate is not a per-device threshold option",
+		"warn-read-bps: 1\nthresholds:\n  sda:\n    warn-read-bps: 2": "warn-read-bps is set twice",
+		"config: other.yml": "cannot be set in the config file",
+		"format: [":         "yaml:",
+	} {
+		writeSysFile(t, root, "check-disk-io.yml", config)
+		if err := loadConfig(file, options, nil); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("loadConfig(%q) = %v, want an error containing %q", config, err, want)
+		}
+	}
+}
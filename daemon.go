@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sensu/sensu-go/types"
+	"github.com/sensu/sensu-plugin-sdk/sensu"
+)
+
+// stdout is where executeCheck writes the metrics unless --output-file or
+// --fifo is given. --daemon points it at a buffer for every sample.
+var stdout io.Writer = os.Stdout
+
+// daemonState is the state --daemon keeps in memory between its samples in
+// place of the state file. It is nil outside of --daemon.
+var daemonState *State
+
+// metricsPage holds the metrics of the latest --daemon sample and serves
+// them over HTTP.
+type metricsPage struct {
+	mu   sync.RWMutex
+	body []byte
+}
+
+func (p *metricsPage) set(body []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.body = body
+}
+
+func (p *metricsPage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.RLock()
+	body := p.body
+	p.mu.RUnlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(body)
+}
+
+// daemonMu guards the plugin config in --daemon: a sample holds it while it
+// runs, a reload while it swaps the config.
+var daemonMu sync.Mutex
+
+// reloadConfig re-reads the --config file of --daemon on SIGHUP, starting
+// over from the flags. A config that fails checkArgs is rejected and the
+// previous one kept. --listen cannot change without a restart.
+func reloadConfig(event *types.Event, ticker *time.Ticker) {
+	daemonMu.Lock()
+	defer daemonMu.Unlock()
+	if len(plugin.ConfigFile) == 0 {
+		fmt.Fprintf(os.Stderr, "Received SIGHUP without --config, nothing to reload\n")
+		return
+	}
+	old := plugin
+	plugin = *flagConfig
+	if _, err := checkArgs(event); err != nil {
+		plugin = old
+		fmt.Fprintf(os.Stderr, "Failed to reload %s, keeping the previous configuration, error: %v\n", plugin.ConfigFile, err)
+		return
+	}
+	if plugin.Listen != old.Listen {
+		fmt.Fprintf(os.Stderr, "Ignoring the new --listen %s until the next restart\n", plugin.Listen)
+		plugin.Listen = old.Listen
+	}
+	plugin.EmitRate = true
+	ticker.Reset(plugin.daemonInterval)
+	fmt.Fprintf(os.Stderr, "Reloaded %s\n", plugin.ConfigFile)
+}
+
+// runDaemon implements --daemon: it runs the check every --daemon-interval
+// with the metrics captured in memory and serves the latest ones on
+// --listen. The rates are computed against the previous sample, as with
+// --emit-rate and a state file. SIGHUP reloads the --config file. It only
+// returns when the server fails.
+func runDaemon(event *types.Event) (int, error) {
+	ln, err := net.Listen("tcp", plugin.Listen)
+	if err != nil {
+		return sensu.CheckStateCritical, fmt.Errorf("failed to listen on %s: %v", plugin.Listen, err)
+	}
+	daemonState = &State{Devices: map[string]*DeviceState{}}
+	plugin.EmitRate = true
+	page := &metricsPage{}
+	sample := func() {
+		daemonMu.Lock()
+		defer daemonMu.Unlock()
+		var buf bytes.Buffer
+		stdout = &buf
+		if status, err := executeCheck(event); err != nil {
+			fmt.Fprintf(os.Stderr, "Sample returned status %d, error: %v\n", status, err)
+		}
+		// An early failure renders nothing; keep serving the previous
+		// sample then.
+		if buf.Len() > 0 {
+			page.set(buf.Bytes())
+		}
+	}
+	sample()
+	ticker := time.NewTicker(plugin.daemonInterval)
+	go func() {
+		for range ticker.C {
+			sample()
+		}
+	}()
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			reloadConfig(event, ticker)
+		}
+	}()
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", page)
+	return sensu.CheckStateCritical, fmt.Errorf("metrics server stopped: %v", http.Serve(ln, mux))
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMetricsPage(t *testing.T) {
+	page := &metricsPage{}
+	page.set([]byte("disk_read_bytes{device=\"sda\"} 1\n"))
+	rec := httptest.NewRecorder()
+	page.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := ioutil.ReadAll(rec.Body)
+	if string(body) != "disk_read_bytes{device=\"sda\"} 1\n" {
+		t.Errorf("body = %q", body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	useDefaults(t)
+	root := t.TempDir()
+	writeSysFile(t, root, "check-disk-io.yml", "include-device: ^sd\n")
+	plugin.ConfigFile = filepath.Join(root, "check-disk-io.yml")
+	plugin.Daemon = true
+	if _, err := checkArgs(nil); err != nil {
+		t.Fatal(err)
+	}
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	writeSysFile(t, root, "check-disk-io.yml", "include-device: ^nvme\ndaemon-interval: 30s\nlisten: :9999\n")
+	reloadConfig(nil, ticker)
+	if plugin.IncludeDevice != "^nvme" || plugin.includeDevice.String() != "^nvme" || plugin.daemonInterval != 30*time.Second {
+		t.Errorf("after reload --include-device = %q, --daemon-interval = %s", plugin.IncludeDevice, plugin.daemonInterval)
+	}
+	if plugin.Listen != flagConfig.Listen || !plugin.EmitRate {
+		t.Errorf("after reload --listen = %q, --emit-rate = %v, want %q, true", plugin.Listen, plugin.EmitRate, flagConfig.Listen)
+	}
+
+	// A config failing validation is rejected.
+	writeSysFile(t, root, "check-disk-io.yml", "include-device: \"[\"\n")
+	reloadConfig(nil, ticker)
+	if plugin.IncludeDevice != "^nvme" {
+		t.Errorf("after a bad reload --include-device = %q, want ^nvme", plugin.IncludeDevice)
+	}
+
+	// An option removed from the file returns to its flag value.
+	writeSysFile(t, root, "check-disk-io.yml", "exclude-device: loop\n")
+	reloadConfig(nil, ticker)
+	if plugin.IncludeDevice != "" || plugin.includeDevice != nil || plugin.ExcludeDevice != "loop" {
+		t.Errorf("after reload --include-device = %q, --exclude-device = %q", plugin.IncludeDevice, plugin.ExcludeDevice)
+	}
+}
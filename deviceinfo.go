@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// serialNumber and deviceLabel are the metadata sources, replaceable in
+// tests.
+var (
+	serialNumber = disk.SerialNumber
+	deviceLabel  = disk.Label
+)
+
+// deviceInfo holds the metadata of a block device.
+type deviceInfo struct {
+	Serial string
+	Label  string
+}
+
+// deviceInfoCache looks up device metadata at most once per device and run,
+// since the lookups stat device nodes and read udev and sysfs files.
+type deviceInfoCache map[string]deviceInfo
+
+// lookup returns the metadata of the named device (a kernel name such as
+// sda). Lookup errors are reported on stderr and leave the field empty.
+func (c deviceInfoCache) lookup(name string) deviceInfo {
+	if info, ok := c[name]; ok {
+		return info
+	}
+	var info deviceInfo
+	var err error
+	if info.Serial, err = serialNumber(filepath.Join("/dev", name)); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to get serial number of %s, error: %v\n", name, err)
+	}
+	enrichments.record("serial", err == nil && len(info.Serial) > 0)
+	if info.Label, err = deviceLabel(name); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to get label of %s, error: %v\n", name, err)
+	}
+	enrichments.record("label", err == nil && len(info.Label) > 0)
+	c[name] = info
+	return info
+}
+
+// excluded reports whether the serial number of the named device is one of
+// serials, compared case-insensitively. A device whose serial cannot be read
+// is never excluded.
+func (c deviceInfoCache) excluded(name string, serials []string) bool {
+	serial := c.lookup(name).Serial
+	if len(serial) == 0 {
+		return false
+	}
+	for _, s := range serials {
+		if strings.EqualFold(strings.TrimSpace(s), serial) {
+			return true
+		}
+	}
+	return false
+}
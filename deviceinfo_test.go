@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDeviceInfoCache(t *testing.T) {
+	lookups := 0
+	origSerial, origLabel := serialNumber, deviceLabel
+	defer func() { serialNumber, deviceLabel = origSerial, origLabel }()
+	serialNumber = func(name string) (string, error) {
+		lookups++
+		if name == "/dev/sdb" {
+			return "", errors.New("permission denied")
+		}
+		return "WD-1234", nil
+	}
+	deviceLabel = func(name string) (string, error) {
+		return "vg-" + name, nil
+	}
+
+	orig := enrichments
+	defer func() { enrichments = orig }()
+	enrichments = enrichmentStatus{}
+
+	c := deviceInfoCache{}
+	if got := c.lookup("sda"); got.Serial != "WD-1234" || got.Label != "vg-sda" {
+		t.Errorf("lookup(sda) = %+v", got)
+	}
+	c.lookup("sda")
+	if lookups != 1 {
+		t.Errorf("serial looked up %d times, want 1", lookups)
+	}
+	if got := c.lookup("sdb"); got.Serial != "" || got.Label != "vg-sdb" {
+		t.Errorf("lookup(sdb) = %+v, want empty serial on error", got)
+	}
+	if !enrichments["serial"] || !enrichments["label"] {
+		t.Errorf("enrichments = %v, want serial and label available", enrichments)
+	}
+}
+
+func TestDeviceInfoCacheExcluded(t *testing.T) {
+	origSerial, origLabel := serialNumber, deviceLabel
+	defer func() { serialNumber, deviceLabel = origSerial, origLabel }()
+	serialNumber = func(name string) (string, error) {
+		switch name {
+		case "/dev/sda":
+			return "WD-WCC4E1234567", nil
+		case "/dev/sdb":
+			return "S3Z9NB0K123456", nil
+		}
+		return "", errors.New("no serial")
+	}
+	deviceLabel = func(name string) (string, error) { return "", nil }
+
+	c := deviceInfoCache{}
+	serials := []string{"wd-wcc4e1234567", " ZA1234 "}
+	if !c.excluded("sda", serials) {
+		t.Errorf("sda with a listed serial is not excluded")
+	}
+	if c.excluded("sdb", serials) {
+		t.Errorf("sdb with another serial is excluded")
+	}
+	if c.excluded("sdc", serials) {
+		t.Errorf("sdc without a readable serial is excluded")
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// hostRun joins parts onto the /run root, honouring HOST_RUN the same way
+// gopsutil does for the udev database.
+func hostRun(parts ...string) string {
+	root := os.Getenv("HOST_RUN")
+	if len(root) == 0 {
+		root = "/run"
+	}
+	return filepath.Join(append([]string{root}, parts...)...)
+}
+
+// deviceMetadata holds the --device-metadata tags of a block device. Empty
+// fields are unknown and left out.
+type deviceMetadata struct {
+	Model      string
+	Serial     string
+	WWN        string
+	Rotational string
+}
+
+// tags adds the known fields to tags.
+func (m deviceMetadata) tags(tags map[string]string) {
+	for k, v := range map[string]string{"model": m.Model, "serial": m.Serial, "wwn": m.WWN, "rotational": m.Rotational} {
+		if len(v) > 0 {
+			tags[k] = v
+		}
+	}
+}
+
+// udevProperties returns the E: properties of a block device in the udev
+// database, such as ID_MODEL, or nil when udev has no entry for it.
+func udevProperties(device string) map[string]string {
+	dev, err := readSysString(hostSys("class", "block", device, "dev"))
+	if err != nil {
+		return nil
+	}
+	f, err := os.Open(hostRun("udev", "data", "b"+dev))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	props := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if kv := strings.TrimPrefix(scanner.Text(), "E:"); kv != scanner.Text() {
+			if i := strings.IndexByte(kv, '='); i > 0 {
+				props[kv[:i]] = kv[i+1:]
+			}
+		}
+	}
+	return props
+}
+
+// readDeviceMetadata reads the model, serial number, WWN and rotational
+// flag of a block device. Partitions report those of their disk. sysfs is
+// preferred, udev fills in what the driver does not expose there, such as
+// the serial number of SATA disks. ok is false when nothing was found.
+func readDeviceMetadata(device string) (m deviceMetadata, ok bool) {
+	parent := parentDevice(device)
+	sysfs := func(parts ...string) string {
+		v, _ := readSysString(hostSys(append([]string{"class", "block", parent}, parts...)...))
+		return v
+	}
+	m.Model = sysfs("device", "model")
+	m.Serial = sysfs("device", "serial")
+	m.WWN = sysfs("device", "wwid")
+	switch sysfs("queue", "rotational") {
+	case "0":
+		m.Rotational = "false"
+	case "1":
+		m.Rotational = "true"
+	}
+	if len(m.Model) == 0 || len(m.Serial) == 0 || len(m.WWN) == 0 {
+		props := udevProperties(parent)
+		for _, f := range []struct {
+			field *string
+			keys  []string
+		}{
+			{&m.Model, []string{"ID_MODEL"}},
+			{&m.Serial, []string{"ID_SERIAL_SHORT", "ID_SERIAL"}},
+			{&m.WWN, []string{"ID_WWN_WITH_EXTENSION", "ID_WWN"}},
+		} {
+			for _, k := range f.keys {
+				if len(*f.field) == 0 {
+					*f.field = props[k]
+				}
+			}
+		}
+	}
+	return m, m != deviceMetadata{}
+}
+
+// deviceMetadataCache holds the metadata looked up in this run, since the
+// tags of a device are built for every sample.
+var deviceMetadataCache map[string]deviceMetadata
+
+// lookupDeviceMetadata returns the metadata of a device, reading it on the
+// first lookup of the run.
+func lookupDeviceMetadata(device string) deviceMetadata {
+	if m, ok := deviceMetadataCache[device]; ok {
+		return m
+	}
+	m, ok := readDeviceMetadata(device)
+	enrichments.record("device_metadata", ok)
+	deviceMetadataCache[device] = m
+	return m
+}
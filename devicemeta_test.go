@@ -0,0 +1,41 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReadDeviceMetadata(t *testing.T) {
+	sys, run := t.TempDir(), t.TempDir()
+	t.Setenv("HOST_SYS", sys)
+	t.Setenv("HOST_RUN", run)
+	// An NVMe drive exposes everything in sysfs, a SATA disk leaves the
+	// serial number and WWN to udev.
+	writeSysFile(t, sys, "class/block/nvme0n1/device/model", "Samsung SSD 970 EVO Plus 1TB            \n")
+	writeSysFile(t, sys, "class/block/nvme0n1/device/serial", "S4EWNX0R123456\n")
+	writeSysFile(t, sys, "class/block/nvme0n1/device/wwid", "eui.0025385b01234567\n")
+	writeSysFile(t, sys, "class/block/nvme0n1/queue/rotational", "0\n")
+	writeSysFile(t, sys, "class/block/sda/dev", "8:0\n")
+	writeSysFile(t, sys, "class/block/sda/device/model", "ST4000NM0035-1V4\n")
+	writeSysFile(t, sys, "class/block/sda/queue/rotational", "1\n")
+	writeSysFile(t, run, "udev/data/b8:0", "S:disk/by-id/wwn-0x5000c500a1b2c3d4\nE:ID_MODEL=ST4000NM0035-1V4\nE:ID_SERIAL=ST4000NM0035-1V4_ZC1ABCDE\nE:ID_SERIAL_SHORT=ZC1ABCDE\nE:ID_WWN=0x5000c500a1b2c3d4\n")
+
+	tests := map[string]deviceMetadata{
+		"nvme0n1": {Model: "Samsung SSD 970 EVO Plus 1TB", Serial: "S4EWNX0R123456", WWN: "eui.0025385b01234567", Rotational: "false"},
+		"sda":     {Model: "ST4000NM0035-1V4", Serial: "ZC1ABCDE", WWN: "0x5000c500a1b2c3d4", Rotational: "true"},
+	}
+	for device, want := range tests {
+		if got, ok := readDeviceMetadata(device); !ok || !reflect.DeepEqual(got, want) {
+			t.Errorf("readDeviceMetadata(%s) = %+v, %v, want %+v", device, got, ok, want)
+		}
+	}
+	if got, ok := readDeviceMetadata("sdz"); ok {
+		t.Errorf("readDeviceMetadata(sdz) = %+v, want nothing found", got)
+	}
+
+	tags := map[string]string{"device": "sda"}
+	deviceMetadata{Model: "m", Rotational: "true"}.tags(tags)
+	if want := map[string]string{"device": "sda", "model": "m", "rotational": "true"}; !reflect.DeepEqual(tags, want) {
+		t.Errorf("tags() = %v, want %v", tags, want)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Values accepted by --unexpected-devices.
+const (
+	unexpectedDrop = "drop"
+	unexpectedWarn = "warn"
+)
+
+// loadDeviceSet reads a --fixed-device-set file: one device per line, given
+// like a --device value. Blank lines and lines starting with # are ignored,
+// as is anything after a # on a line.
+func loadDeviceSet(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var devices []string
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if i := strings.Index(text, "#"); i >= 0 {
+			text = text[:i]
+		}
+		text = strings.TrimSpace(text)
+		if len(text) == 0 {
+			continue
+		}
+		if strings.ContainsAny(text, " \t") {
+			return nil, fmt.Errorf("%s:%d: expected a single device, got %q", path, line, text)
+		}
+		devices = append(devices, text)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(devices) == 0 {
+		return nil, fmt.Errorf("%s: no devices listed", path)
+	}
+	return devices, nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadDeviceSet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devices")
+	content := "# data disks\nsda\n\n  sdb  # spare\n/dev/disk/by-id/wwn-0x5000\n"
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := loadDeviceSet(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"sda", "sdb", "/dev/disk/by-id/wwn-0x5000"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("loadDeviceSet = %q, want %q", got, want)
+	}
+}
+
+func TestLoadDeviceSetInvalid(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"empty":    "# nothing here\n",
+		"two-cols": "sda sdb\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadDeviceSet(path); err == nil {
+			t.Errorf("loadDeviceSet(%s) expected error", name)
+		}
+	}
+	if _, err := loadDeviceSet(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("loadDeviceSet of a missing file expected error")
+	}
+}
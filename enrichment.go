@@ -0,0 +1,34 @@
+package main
+
+// enrichmentStatus records which optional metadata sources (sysfs, udev,
+// cloud metadata) could be read during a run. Enrichment never fails the
+// check; a source that is restricted by AppArmor or SELinux, or missing in
+// a container, is only reported as unavailable.
+type enrichmentStatus map[string]bool
+
+// record notes an attempt to read source. A source counts as available
+// when at least one attempt in the run succeeded.
+func (e enrichmentStatus) record(source string, ok bool) {
+	e[source] = e[source] || ok
+}
+
+// group returns the disk_io_enrichment_available metric group, with one
+// sample per attempted source.
+func (e enrichmentStatus) group() *MetricGroup {
+	g := &MetricGroup{
+		Name:    "disk_io_enrichment_available",
+		Type:    "GAUGE",
+		Comment: "This value is 1 when the enrichment source could be read for at least one device in this run, 0 when every attempt failed.",
+	}
+	for _, source := range sortedKeys(e) {
+		v := 0.0
+		if e[source] {
+			v = 1
+		}
+		g.AddMetric(map[string]string{"source": source}, v)
+	}
+	return g
+}
+
+// enrichments is the status of the current run.
+var enrichments = enrichmentStatus{}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestEnrichmentStatus(t *testing.T) {
+	e := enrichmentStatus{}
+	e.record("serial", false)
+	e.record("serial", true)
+	e.record("serial", false)
+	e.record("cloud", false)
+
+	g := e.group()
+	if len(g.Metrics) != 2 {
+		t.Fatalf("got %d samples, want 2", len(g.Metrics))
+	}
+	for _, m := range g.Metrics {
+		want := map[string]float64{"cloud": 0, "serial": 1}[m.Tags["source"]]
+		if m.Value != want {
+			t.Errorf("source %s = %v, want %v", m.Tags["source"], m.Value, want)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+// openFIFO opens the named pipe at path for writing. Opening a FIFO blocks
+// until a reader shows up, so it is opened non-blocking and retried until
+// timeout expires instead. The returned file has its write deadline set to
+// the same point in time, so a reader that stops reading cannot hang the
+// check either.
+func openFIFO(path string, timeout time.Duration) (*os.File, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if fi.Mode()&os.ModeNamedPipe == 0 {
+		return nil, fmt.Errorf("%s is not a named pipe", path)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		f, err := os.OpenFile(path, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+		if err == nil {
+			_ = f.SetWriteDeadline(deadline)
+			return f, nil
+		}
+		if !errors.Is(err, syscall.ENXIO) {
+			return nil, err
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("no reader attached to %s after %v", path, timeout)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
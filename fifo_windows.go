@@ -0,0 +1,13 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// openFIFO is not supported on Windows, which has no named pipes in the
+// filesystem namespace.
+func openFIFO(path string, timeout time.Duration) (*os.File, error) {
+	return nil, errors.New("--fifo is not supported on windows")
+}
@@ -6,6 +6,8 @@ require (
 	github.com/sensu/sensu-go/types v0.3.0
 	github.com/sensu/sensu-plugin-sdk v0.14.0
 	github.com/shirou/gopsutil/v3 v3.22.1
+	golang.org/x/sys v0.0.0-20220111092808-5a964db01320
+	gopkg.in/yaml.v2 v2.3.0
 )
 
 require (
@@ -42,11 +44,9 @@ require (
 	github.com/subosito/gotenv v1.2.0 // indirect
 	github.com/yusufpapurcu/wmi v1.2.2 // indirect
 	golang.org/x/net v0.0.0-20190620200207-3b0461eec859 // indirect
-	golang.org/x/sys v0.0.0-20220111092808-5a964db01320 // indirect
 	golang.org/x/text v0.3.2 // indirect
 	google.golang.org/genproto v0.0.0-20191108220845-16a3f7862a1a // indirect
 	google.golang.org/grpc v1.24.0 // indirect
 	gopkg.in/ini.v1 v1.51.0 // indirect
 	gopkg.in/sourcemap.v1 v1.0.5 // indirect
-	gopkg.in/yaml.v2 v2.3.0 // indirect
 )
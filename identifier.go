@@ -0,0 +1,70 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Values accepted by --device-identifier.
+const (
+	identifierKernel = "kernel"
+	identifierByPath = "by-path"
+	identifierByID   = "by-id"
+)
+
+// hostDev joins parts onto the /dev root, honouring HOST_DEV the same way
+// gopsutil does.
+func hostDev(parts ...string) string {
+	root := os.Getenv("HOST_DEV")
+	if len(root) == 0 {
+		root = "/dev"
+	}
+	return filepath.Join(append([]string{root}, parts...)...)
+}
+
+// stableNames maps kernel device names to their udev name in
+// /dev/disk/<kind> (by-path or by-id), such as
+// pci-0000:00:1f.2-ata-1 or wwn-0x5000c500a1b2c3d4. udev often creates
+// several names for one device; the alphabetically first one is used so the
+// choice is the same on every run.
+func stableNames(kind string) (map[string]string, error) {
+	dir := hostDev("disk", kind)
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+
+	stable := map[string]string{}
+	for _, name := range names {
+		target, err := filepath.EvalSymlinks(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		kernel := filepath.Base(target)
+		if _, ok := stable[kernel]; !ok {
+			stable[kernel] = name
+		}
+	}
+	return stable, nil
+}
+
+// deviceIdentifiers holds the stable names looked up once per run for
+// --device-identifier.
+var deviceIdentifiers map[string]string
+
+// deviceIdentifier returns the value of the device tag for a kernel device
+// name: its stable name when --device-identifier selects one and udev
+// created it, the kernel name otherwise.
+func deviceIdentifier(device string) string {
+	if name, ok := deviceIdentifiers[device]; ok {
+		return name
+	}
+	return device
+}
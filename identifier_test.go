@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStableNames(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("HOST_DEV", root)
+
+	writeSysFile(t, root, "sda", "")
+	writeSysFile(t, root, "sda1", "")
+	writeSysFile(t, root, "nvme0n1", "")
+	dir := filepath.Join(root, "disk", "by-id")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for link, target := range map[string]string{
+		"wwn-0x5000c500a1b2c3d4":       "../../sda",
+		"ata-ST4000_Z1Z0ABCD":          "../../sda",
+		"ata-ST4000_Z1Z0ABCD-part1":    "../../sda1",
+		"nvme-Samsung_SSD_S4EWNX0N123": "../../nvme0n1",
+		"dangling":                     "../../sdz",
+	} {
+		if err := os.Symlink(target, filepath.Join(dir, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := stableNames(identifierByID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"sda":     "ata-ST4000_Z1Z0ABCD",
+		"sda1":    "ata-ST4000_Z1Z0ABCD-part1",
+		"nvme0n1": "nvme-Samsung_SSD_S4EWNX0N123",
+	}
+	if len(got) != len(want) {
+		t.Errorf("stableNames = %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("stableNames[%s] = %q, want %q", k, got[k], v)
+		}
+	}
+
+	if _, err := stableNames(identifierByPath); err == nil {
+		t.Errorf("stableNames without a by-path directory expected error")
+	}
+}
+
+func TestDeviceIdentifier(t *testing.T) {
+	orig := deviceIdentifiers
+	defer func() { deviceIdentifiers = orig }()
+	deviceIdentifiers = map[string]string{"sda": "pci-0000:00:1f.2-ata-1"}
+
+	if got := deviceIdentifier("sda"); got != "pci-0000:00:1f.2-ata-1" {
+		t.Errorf("deviceIdentifier(sda) = %q", got)
+	}
+	if got := deviceIdentifier("sdb"); got != "sdb" {
+		t.Errorf("deviceIdentifier(sdb) = %q, want the kernel name", got)
+	}
+}
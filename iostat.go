@@ -0,0 +1,44 @@
+package main
+
+import (
+	"github.com/jadiunr/check-disk-io/thresholds"
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// iostatValues computes the values of `iostat -x` from two samples of a
+// device taken elapsedMs apart, keyed by metric group:
+//
+//   - disk_util_percent: share of the interval the device was busy (%util)
+//   - disk_read_await_ms, disk_write_await_ms: average time per read and
+//     write, queueing included (r_await, w_await)
+//   - disk_avg_request_bytes: average size of the completed requests
+//     (avgrq-sz, in bytes rather than sectors)
+//   - disk_avg_queue_size: average number of requests in flight (avgqu-sz)
+//
+// The averages per request are left out when no request of that kind
+// completed in the interval. ok is false when a counter went backwards.
+func iostatValues(prev, cur disk.IOCountersStat, elapsedMs float64) (values map[string]float64, ok bool) {
+	if elapsedMs <= 0 || cur.IoTime < prev.IoTime || cur.WeightedIO < prev.WeightedIO ||
+		cur.ReadBytes < prev.ReadBytes || cur.WriteBytes < prev.WriteBytes ||
+		cur.ReadCount < prev.ReadCount || cur.WriteCount < prev.WriteCount {
+		return nil, false
+	}
+	util := float64(cur.IoTime-prev.IoTime) / elapsedMs * 100
+	if util > 100 {
+		util = 100
+	}
+	values = map[string]float64{
+		"disk_util_percent":   util,
+		"disk_avg_queue_size": float64(cur.WeightedIO-prev.WeightedIO) / elapsedMs,
+	}
+	if l, ok := thresholds.AverageLatency(prev.ReadTime, cur.ReadTime, prev.ReadCount, cur.ReadCount); ok {
+		values["disk_read_await_ms"] = l
+	}
+	if l, ok := thresholds.AverageLatency(prev.WriteTime, cur.WriteTime, prev.WriteCount, cur.WriteCount); ok {
+		values["disk_write_await_ms"] = l
+	}
+	if count := (cur.ReadCount - prev.ReadCount) + (cur.WriteCount - prev.WriteCount); count > 0 {
+		values["disk_avg_request_bytes"] = float64((cur.ReadBytes-prev.ReadBytes)+(cur.WriteBytes-prev.WriteBytes)) / float64(count)
+	}
+	return values, true
+}
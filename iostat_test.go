@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+func TestIostatValues(t *testing.T) {
+	prev := disk.IOCountersStat{ReadCount: 100, WriteCount: 100, ReadBytes: 1 << 20, WriteBytes: 1 << 20, ReadTime: 500, WriteTime: 500, IoTime: 1000, WeightedIO: 2000}
+	cur := disk.IOCountersStat{ReadCount: 200, WriteCount: 100, ReadBytes: 1<<20 + 409600, WriteBytes: 1 << 20, ReadTime: 700, WriteTime: 500, IoTime: 1500, WeightedIO: 4000}
+
+	values, ok := iostatValues(prev, cur, 1000)
+	if !ok {
+		t.Fatal("iostatValues returned not ok")
+	}
+	want := map[string]float64{
+		"disk_util_percent":      50,
+		"disk_read_await_ms":     2,
+		"disk_avg_request_bytes": 4096,
+		"disk_avg_queue_size":    2,
+	}
+	if len(values) != len(want) {
+		t.Errorf("values = %v, want %v", values, want)
+	}
+	for name, v := range want {
+		if values[name] != v {
+			t.Errorf("%s = %v, want %v", name, values[name], v)
+		}
+	}
+
+	if values, _ := iostatValues(prev, disk.IOCountersStat{ReadCount: 100, WriteCount: 100, ReadBytes: 1 << 20, WriteBytes: 1 << 20, ReadTime: 500, WriteTime: 500, IoTime: 9000, WeightedIO: 2000}, 1000); values["disk_util_percent"] != 100 {
+		t.Errorf("disk_util_percent = %v, want it capped at 100", values["disk_util_percent"])
+	}
+	if _, ok := iostatValues(cur, prev, 1000); ok {
+		t.Error("iostatValues accepted counters that went backwards")
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"math"
+	"sort"
+
+	"github.com/jadiunr/check-disk-io/thresholds"
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// averageWait returns the average time in milliseconds spent per IO since
+// boot, or 0 when no IO completed yet.
+func averageWait(totalMs, count uint64) float64 {
+	if count == 0 {
+		return 0
+	}
+	return float64(totalMs) / float64(count)
+}
+
+// appendWindow appends v to history, dropping the oldest entries so that at
+// most size values are kept.
+func appendWindow(history []float64, v float64, size int) []float64 {
+	history = append(history, v)
+	if len(history) > size {
+		history = history[len(history)-size:]
+	}
+	return history
+}
+
+// percentile returns the p-th percentile (0-100) of values using the
+// nearest-rank method.
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// updateLatencyHistory records the average read and write latency observed
+// since the previous run in the device state.
+func updateLatencyHistory(ds *DeviceState, cur disk.IOCountersStat, window int) {
+	prev := ds.Counters
+	if l, ok := thresholds.AverageLatency(prev.ReadTime, cur.ReadTime, prev.ReadCount, cur.ReadCount); ok {
+		ds.ReadLatency = appendWindow(ds.ReadLatency, l, window)
+	}
+	if l, ok := thresholds.AverageLatency(prev.WriteTime, cur.WriteTime, prev.WriteCount, cur.WriteCount); ok {
+		ds.WriteLatency = appendWindow(ds.WriteLatency, l, window)
+	}
+}
+
+// breachesLatencySLO reports whether the average latency of all IOs, reads
+// and writes together, completed between two samples exceeds sloMs.
+func breachesLatencySLO(prev, cur disk.IOCountersStat, sloMs int) bool {
+	l, ok := thresholds.AverageLatency(prev.ReadTime+prev.WriteTime, cur.ReadTime+cur.WriteTime, prev.ReadCount+prev.WriteCount, cur.ReadCount+cur.WriteCount)
+	return ok && l > float64(sloMs)
+}
+
+// iowaitContribution estimates how many milliseconds of CPU iowait a device
+// caused between two samples of its weighted IO time. Every millisecond a
+// request spends in flight can keep at most one idle CPU in iowait, so the
+// weighted IO delta is used as is, capped at the CPU time available in the
+// interval (cpus * elapsedMs). ok is false when the counter went backwards.
+func iowaitContribution(prevWeighted, curWeighted uint64, elapsedMs float64, cpus int) (ms float64, ok bool) {
+	if curWeighted < prevWeighted || elapsedMs <= 0 {
+		return 0, false
+	}
+	ms = float64(curWeighted - prevWeighted)
+	if max := elapsedMs * float64(cpus); ms > max {
+		ms = max
+	}
+	return ms, true
+}
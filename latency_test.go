@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+func TestPercentile(t *testing.T) {
+	values := []float64{5, 1, 4, 2, 3, 10, 6, 9, 7, 8}
+	if got := percentile(values, 50); got != 5 {
+		t.Errorf("p50 = %v, want 5", got)
+	}
+	if got := percentile(values, 95); got != 10 {
+		t.Errorf("p95 = %v, want 10", got)
+	}
+	if values[0] != 5 {
+		t.Errorf("percentile must not reorder its input")
+	}
+}
+
+func TestAppendWindow(t *testing.T) {
+	var h []float64
+	for i := 1; i <= 5; i++ {
+		h = appendWindow(h, float64(i), 3)
+	}
+	if len(h) != 3 || h[0] != 3 || h[2] != 5 {
+		t.Errorf("appendWindow kept %v, want [3 4 5]", h)
+	}
+}
+
+func TestAverageWait(t *testing.T) {
+	if got := averageWait(500, 200); got != 2.5 {
+		t.Errorf("averageWait(500, 200) = %v, want 2.5", got)
+	}
+	if got := averageWait(0, 0); got != 0 {
+		t.Errorf("averageWait(0, 0) = %v, want 0", got)
+	}
+}
+
+func TestIowaitContribution(t *testing.T) {
+	if ms, ok := iowaitContribution(1000, 1500, 60000, 4); !ok || ms != 500 {
+		t.Errorf("iowaitContribution = %v, %v, want 500, true", ms, ok)
+	}
+	// A deep queue on a small host cannot cause more iowait than there
+	// is CPU time.
+	if ms, ok := iowaitContribution(0, 500000, 60000, 2); !ok || ms != 120000 {
+		t.Errorf("capped iowaitContribution = %v, %v, want 120000, true", ms, ok)
+	}
+	if _, ok := iowaitContribution(1500, 1000, 60000, 4); ok {
+		t.Errorf("iowaitContribution with reset counters should not be ok")
+	}
+}
+
+func TestBreachesLatencySLO(t *testing.T) {
+	prev := disk.IOCountersStat{ReadCount: 100, ReadTime: 1000, WriteCount: 100, WriteTime: 1000}
+	// 10 reads in 100ms and 10 writes in 300ms: 20ms on average.
+	cur := disk.IOCountersStat{ReadCount: 110, ReadTime: 1100, WriteCount: 110, WriteTime: 1300}
+	if !breachesLatencySLO(prev, cur, 15) {
+		t.Errorf("20ms average should breach a 15ms SLO")
+	}
+	if breachesLatencySLO(prev, cur, 20) {
+		t.Errorf("20ms average should not breach a 20ms SLO")
+	}
+	if breachesLatencySLO(prev, prev, 1) {
+		t.Errorf("no completed IO should not breach")
+	}
+}
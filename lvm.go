@@ -0,0 +1,67 @@
+package main
+
+import (
+	"io/ioutil"
+	"strings"
+)
+
+// dmNames maps the kernel names of the device-mapper devices, such as dm-0,
+// to their device-mapper name from /sys/class/block/<dev>/dm/name, such as
+// vg0-root, for --resolve-dm-names.
+func dmNames() (map[string]string, error) {
+	entries, err := ioutil.ReadDir(hostSys("class", "block"))
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]string{}
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), "dm-") {
+			continue
+		}
+		if name, err := readSysString(hostSys("class", "block", e.Name(), "dm", "name")); err == nil && len(name) > 0 {
+			names[e.Name()] = name
+		}
+	}
+	return names, nil
+}
+
+// splitLVMName splits the device-mapper name LVM gives a logical volume,
+// vg-lv, into the volume group and logical volume names. LVM doubles the
+// dashes inside both names, so the first single dash separates them; a
+// further single dash starts the suffix of an internal layer, such as the
+// tpool of a thin pool, which is dropped.
+func splitLVMName(name string) (vg, lv string, ok bool) {
+	var parts []string
+	start := 0
+	for i := 0; i < len(name); i++ {
+		if name[i] != '-' {
+			continue
+		}
+		if i+1 < len(name) && name[i+1] == '-' {
+			i++
+			continue
+		}
+		parts = append(parts, name[start:i])
+		start = i + 1
+	}
+	parts = append(parts, name[start:])
+	if len(parts) < 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+		return "", "", false
+	}
+	return strings.ReplaceAll(parts[0], "--", "-"), strings.ReplaceAll(parts[1], "--", "-"), true
+}
+
+// lvmNames returns the volume group and logical volume of a device, or ok
+// false when it is not an LVM logical volume, which device-mapper marks
+// with an LVM- prefix in dm/uuid.
+func lvmNames(device string) (vg, lv string, ok bool) {
+	uuid, err := readSysString(hostSys("class", "block", device, "dm", "uuid"))
+	if err != nil || !strings.HasPrefix(uuid, "LVM-") {
+		return "", "", false
+	}
+	name, err := readSysString(hostSys("class", "block", device, "dm", "name"))
+	if err != nil {
+		return "", "", false
+	}
+	return splitLVMName(name)
+}
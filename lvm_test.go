@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSplitLVMName(t *testing.T) {
+	tests := []struct {
+		in     string
+		vg, lv string
+		ok     bool
+	}{
+		{"vg0-root", "vg0", "root", true},
+		{"my--vg-data--01", "my-vg", "data-01", true},
+		{"vg0-pool-tpool", "vg0", "pool", true},
+		{"cryptroot", "", "", false},
+		{"-root", "", "", false},
+	}
+	for _, tt := range tests {
+		vg, lv, ok := splitLVMName(tt.in)
+		if vg != tt.vg || lv != tt.lv || ok != tt.ok {
+			t.Errorf("splitLVMName(%q) = %q, %q, %v, want %q, %q, %v", tt.in, vg, lv, ok, tt.vg, tt.lv, tt.ok)
+		}
+	}
+}
+
+func TestLVMNames(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("HOST_SYS", root)
+	writeSysFile(t, root, "class/block/dm-0/dm/name", "vg0-root\n")
+	writeSysFile(t, root, "class/block/dm-0/dm/uuid", "LVM-abcdef\n")
+	writeSysFile(t, root, "class/block/dm-1/dm/name", "cryptdata\n")
+	writeSysFile(t, root, "class/block/dm-1/dm/uuid", "CRYPT-LUKS2-1234-cryptdata\n")
+	writeSysFile(t, root, "class/block/sda/size", "100\n")
+
+	names, err := dmNames()
+	if err != nil || len(names) != 2 || names["dm-0"] != "vg0-root" || names["dm-1"] != "cryptdata" {
+		t.Errorf("dmNames() = %v, %v", names, err)
+	}
+	if vg, lv, ok := lvmNames("dm-0"); !ok || vg != "vg0" || lv != "root" {
+		t.Errorf("lvmNames(dm-0) = %q, %q, %v", vg, lv, ok)
+	}
+	if _, _, ok := lvmNames("dm-1"); ok {
+		t.Errorf("lvmNames(dm-1) accepted a dm-crypt device")
+	}
+	if _, _, ok := lvmNames("sda"); ok {
+		t.Errorf("lvmNames(sda) accepted a disk")
+	}
+}
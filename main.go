@@ -2,8 +2,16 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/jadiunr/check-disk-io/collector"
+	"github.com/jadiunr/check-disk-io/output"
+	"github.com/jadiunr/check-disk-io/thresholds"
 	"github.com/sensu/sensu-go/types"
 	"github.com/sensu/sensu-plugin-sdk/sensu"
 	"github.com/shirou/gopsutil/v3/disk"
@@ -12,47 +20,157 @@ import (
 // Config represents the check plugin config.
 type Config struct {
 	sensu.PluginConfig
+	StateFile              string
+	HostProc               string
+	HostSys                string
+	WithLatencyPercentiles bool
+	LatencySLOMs           int
+	LatencyWindow          int
+	AnomalyFactor          float64
+	AnomalyWindow          int
+	FIFO                   string
+	OutputFile             string
+	FIFOTimeout            string
+	OutputBufferSize       int
+	fifoTimeout            time.Duration
+	ConfigFile             string
+	ReadEvent              bool
+	Daemon                 bool
+	Listen                 string
+	DaemonInterval         string
+	daemonInterval         time.Duration
+	Devices                []string
+	RootOnly               bool
+	AllDevices             bool
+	IncludeDevice          string
+	ExcludeDevice          string
+	includeDevice          *regexp.Regexp
+	excludeDevice          *regexp.Regexp
+	DeviceIdentifier       string
+	ExcludeSerials         []string
+	EmitZeroForMissing     bool
+	FixedDeviceSet         string
+	UnexpectedDevices      string
+	WithCacheRole          bool
+	DeviceMetadata         bool
+	WithFstype             bool
+	WithLVMTags            bool
+	WithMdArrays           bool
+	MdRollup               bool
+	Smart                  bool
+	Cgroups                bool
+	ZFS                    bool
+	ZpoolCommand           string
+	ResolveDMNames         bool
+	MultiMountPolicy       string
+	FstypeInclude          []string
+	FstypeExclude          []string
+	DedupDevice            bool
+	WholeDeviceOnly        bool
+	FailState              string
+	IgnoreCollectionErrors bool
+	Retries                int
+	Concurrency            int
+	RetryDelay             string
+	retryDelay             time.Duration
+	Timeout                string
+	timeout                time.Duration
+	failState              int
+	WithDeviceInfo         bool
+	BaselineFile           string
+	SetBaseline            bool
+	Format                 string
+	outputs                []outputSink
+	NoTimestamp            bool
+	LegacyOutput           bool
+	ListMetrics            bool
+	GraphitePrefix         string
+	InfluxMeasurement      string
+	InfluxFieldsMode       string
+	LabelsTag              string
+	DetectStuck            bool
+	StuckThreshold         int
+	OTLPEndpoint           string
+	OTLPHeaders            map[string]string
+	OTLPInsecure           bool
+	StatsDAddr             string
+	StatsDOnly             bool
+	Namespace              string
+	NamingScheme           string
+	TimeUnit               string
+	SizeUnit               string
+	Metrics                []string
+	metrics                map[string]bool
+	disabledMetrics        map[string]bool
+	TypeOverrides          map[string]string
+	typeOverrides          map[string]string
+	MaskLabelValues        []string
+	MaskMethod             string
+	MaskSalt               string
+	StaticTags             []string
+	Hostname               string
+	NoHostname             bool
+	staticTags             map[string]string
+	Instance               string
+	Job                    string
+	SkipSwap               bool
+	SkipIdle               bool
+	WithCloudTags          bool
+	Cloud                  string
+	DeviceSizeMin          string
+	DeviceSizeMax          string
+	DropUnknownSize        bool
+	deviceSizeMin          uint64
+	deviceSizeMax          uint64
+	RateWindow             string
+	EmitDelta              bool
+	EmitRate               bool
+	Rate                   bool
+	Interval               string
+	interval               time.Duration
+	SubSampleInterval      string
+	subSampleInterval      time.Duration
+	AbsentRetention        string
+	absentRetention        time.Duration
+	DeviceThresholds       []string
+	IopsWarning            int
+	IopsCritical           int
+	deviceThresholds       map[string]thresholds.ByteRateLimits
+	WarnReadBps            string
+	CritReadBps            string
+	WarnWriteBps           string
+	CritWriteBps           string
+	WarnReadIops           string
+	CritReadIops           string
+	WarnWriteIops          string
+	CritWriteIops          string
+	WarnReadAwaitMs        string
+	CritReadAwaitMs        string
+	WarnWriteAwaitMs       string
+	CritWriteAwaitMs       string
+	WarnQueueDepth         string
+	CritQueueDepth         string
+	rateThresholds         thresholds.Rates
+	SuggestThresholds      bool
+	ThroughputHistory      int
+	SummaryTop             int
+	WithPerQueue           bool
+	WithIowait             bool
+	WithIostat             bool
+	WithMergeRatio         bool
+	WithUsage              bool
+	WithSelfMetrics        bool
+	Totals                 bool
+	MaxQueues              int
+	rateWindow             time.Duration
 }
 
-type MetricGroup struct {
-	Comment string
-	Type 	string
-	Name 	string
-	Metrics []Metric
-}
-
-func (g *MetricGroup) AddMetric(tags map[string]string, value float64) {
-	g.Metrics = append(g.Metrics, Metric{
-		Tags:	tags,
-		Value: 	value,
-	})
-}
-
-func (g *MetricGroup) Output() {
-	var output string
-	fmt.Printf("# HELP %s [%s] %s\n", g.Name, g.Type, g.Comment)
-	fmt.Printf("# TYPE %s %s\n", g.Name, g.Type)
-	for _, m := range g.Metrics {
-		tagStr := ""
-		for tag, tvalue := range m.Tags {
-			if len(tagStr) > 0 {
-				tagStr = tagStr + ","
-			}
-			tagStr = tagStr + tag + "=\"" + tvalue + "\""
-		}
-		if len(tagStr) > 0 {
-			tagStr = "{" + tagStr + "}"
-		}
-		output = strings.Join([]string{g.Name + tagStr, fmt.Sprintf("%v", m.Value)}, " ")
-		fmt.Println(output)
-	}
-	fmt.Println("")
-}
-
-type Metric struct {
-	Tags 	map[string]string
-	Value 	float64
-}
+// MetricGroup and Metric are the collector types, under the names the rest
+// of the check uses.
+type (
+	MetricGroup = collector.MetricGroup
+	Metric      = collector.Metric
+)
 
 var (
 	plugin = Config{
@@ -62,105 +180,1544 @@ var (
 			Keyspace: "sensu.io/plugins/check-disk-io/config",
 		},
 	}
-)
-
-func main() {
-	check := sensu.NewGoCheck(&plugin.PluginConfig, nil, checkArgs, executeCheck, false)
-	check.Execute()
-}
-
-func checkArgs(event *types.Event) (int, error) {
-	return sensu.CheckStateOK, nil
-}
-
-func executeCheck(event *types.Event) (int, error) {
-	parts, err := disk.Partitions(false)
-	if err != nil {
-		fmt.Printf("Failed to get partitions, error: %v", err)
-	}
 
-	metricGroups := map[string]*MetricGroup{
-		"disk_read_bytes": {
-			Name: "disk_read_bytes",
-			Type: "COUNTER",
-			Comment: "These values count the number of bytes read from or written to this block device.",
+	options = []*sensu.PluginConfigOption{
+		{
+			Path:     "with-self-metrics",
+			Env:      "CHECK_DISK_IO_WITH_SELF_METRICS",
+			Argument: "with-self-metrics",
+			Default:  false,
+			Usage:    "Emit the resource usage, duration, device counts and version of the check itself",
+			Value:    &plugin.WithSelfMetrics,
+		},
+		{
+			Path:     "with-merge-ratio",
+			Env:      "CHECK_DISK_IO_WITH_MERGE_RATIO",
+			Argument: "with-merge-ratio",
+			Default:  false,
+			Usage:    "Emit disk_read_merge_ratio and disk_write_merge_ratio, the share of requests merged before reaching the device",
+			Value:    &plugin.WithMergeRatio,
+		},
+		{
+			Path:     "with-usage",
+			Env:      "CHECK_DISK_IO_WITH_USAGE",
+			Argument: "with-usage",
+			Default:  false,
+			Usage:    "Also emit the space and inode usage of the filesystem at each reported mountpoint, such as disk_used_bytes and disk_inodes_used",
+			Value:    &plugin.WithUsage,
+		},
+		{
+			Path:     "with-iowait",
+			Env:      "CHECK_DISK_IO_WITH_IOWAIT",
+			Argument: "with-iowait",
+			Default:  false,
+			Usage:    "Emit disk_iowait_contribution_ms, an estimate of the CPU iowait each device caused since the previous run (uses --state-file)",
+			Value:    &plugin.WithIowait,
+		},
+		{
+			Path:     "with-iostat",
+			Env:      "CHECK_DISK_IO_WITH_IOSTAT",
+			Argument: "with-iostat",
+			Default:  false,
+			Usage:    "Emit the iostat -x values %util, r_await, w_await, avgrq-sz and avgqu-sz of each device since the previous run (uses --state-file)",
+			Value:    &plugin.WithIostat,
+		},
+		{
+			Path:     "with-per-queue",
+			Env:      "CHECK_DISK_IO_WITH_PER_QUEUE",
+			Argument: "with-per-queue",
+			Default:  false,
+			Usage:    "Emit issue and completion counters per blk-mq hardware queue (Linux multiqueue devices such as NVMe)",
+			Value:    &plugin.WithPerQueue,
+		},
+		{
+			Path:     "max-queues",
+			Env:      "CHECK_DISK_IO_MAX_QUEUES",
+			Argument: "max-queues",
+			Default:  16,
+			Usage:    "Maximum number of hardware queues reported per device with --with-per-queue",
+			Value:    &plugin.MaxQueues,
+		},
+		{
+			Path:     "iops-warning",
+			Env:      "CHECK_DISK_IO_IOPS_WARNING",
+			Argument: "iops-warning",
+			Default:  0,
+			Usage:    "Warn when a device has more IOs in flight than this, 0 to disable; with --rate the peak between the two samples counts",
+			Value:    &plugin.IopsWarning,
+		},
+		{
+			Path:     "iops-critical",
+			Env:      "CHECK_DISK_IO_IOPS_CRITICAL",
+			Argument: "iops-critical",
+			Default:  0,
+			Usage:    "Go critical when a device has more IOs in flight than this, 0 to disable; with --rate the peak between the two samples counts",
+			Value:    &plugin.IopsCritical,
+		},
+		{
+			Path:     "warn-read-bps",
+			Env:      "CHECK_DISK_IO_WARN_READ_BPS",
+			Argument: "warn-read-bps",
+			Default:  "",
+			Usage:    "Warn when a device reads more bytes per second than this since the previous run, e.g. 100MiB, or per device as <pattern>:<limit>,...,default:<limit> (uses --state-file)",
+			Value:    &plugin.WarnReadBps,
+		},
+		{
+			Path:     "crit-read-bps",
+			Env:      "CHECK_DISK_IO_CRIT_READ_BPS",
+			Argument: "crit-read-bps",
+			Default:  "",
+			Usage:    "Go critical when a device reads more bytes per second than this since the previous run, e.g. 100MiB, or per device as <pattern>:<limit>,...,default:<limit> (uses --state-file)",
+			Value:    &plugin.CritReadBps,
+		},
+		{
+			Path:     "warn-write-bps",
+			Env:      "CHECK_DISK_IO_WARN_WRITE_BPS",
+			Argument: "warn-write-bps",
+			Default:  "",
+			Usage:    "Warn when a device writes more bytes per second than this since the previous run, e.g. 100MiB, or per device as <pattern>:<limit>,...,default:<limit> (uses --state-file)",
+			Value:    &plugin.WarnWriteBps,
+		},
+		{
+			Path:     "crit-write-bps",
+			Env:      "CHECK_DISK_IO_CRIT_WRITE_BPS",
+			Argument: "crit-write-bps",
+			Default:  "",
+			Usage:    "Go critical when a device writes more bytes per second than this since the previous run, e.g. 100MiB, or per device as <pattern>:<limit>,...,default:<limit> (uses --state-file)",
+			Value:    &plugin.CritWriteBps,
+		},
+		{
+			Path:     "warn-read-iops",
+			Env:      "CHECK_DISK_IO_WARN_READ_IOPS",
+			Argument: "warn-read-iops",
+			Default:  "",
+			Usage:    "Warn when a device completes more reads per second than this since the previous run, or per device as <pattern>:<limit>,...,default:<limit> (uses --state-file)",
+			Value:    &plugin.WarnReadIops,
+		},
+		{
+			Path:     "crit-read-iops",
+			Env:      "CHECK_DISK_IO_CRIT_READ_IOPS",
+			Argument: "crit-read-iops",
+			Default:  "",
+			Usage:    "Go critical when a device completes more reads per second than this since the previous run, or per device as <pattern>:<limit>,...,default:<limit> (uses --state-file)",
+			Value:    &plugin.CritReadIops,
+		},
+		{
+			Path:     "warn-write-iops",
+			Env:      "CHECK_DISK_IO_WARN_WRITE_IOPS",
+			Argument: "warn-write-iops",
+			Default:  "",
+			Usage:    "Warn when a device completes more writes per second than this since the previous run, or per device as <pattern>:<limit>,...,default:<limit> (uses --state-file)",
+			Value:    &plugin.WarnWriteIops,
+		},
+		{
+			Path:     "crit-write-iops",
+			Env:      "CHECK_DISK_IO_CRIT_WRITE_IOPS",
+			Argument: "crit-write-iops",
+			Default:  "",
+			Usage:    "Go critical when a device completes more writes per second than this since the previous run, or per device as <pattern>:<limit>,...,default:<limit> (uses --state-file)",
+			Value:    &plugin.CritWriteIops,
+		},
+		{
+			Path:     "warn-read-await-ms",
+			Env:      "CHECK_DISK_IO_WARN_READ_AWAIT_MS",
+			Argument: "warn-read-await-ms",
+			Default:  "",
+			Usage:    "Warn when the reads a device completed since the previous run took longer than this many milliseconds on average, or per device as <pattern>:<limit>,...,default:<limit> (uses --state-file)",
+			Value:    &plugin.WarnReadAwaitMs,
+		},
+		{
+			Path:     "crit-read-await-ms",
+			Env:      "CHECK_DISK_IO_CRIT_READ_AWAIT_MS",
+			Argument: "crit-read-await-ms",
+			Default:  "",
+			Usage:    "Go critical when the reads a device completed since the previous run took longer than this many milliseconds on average, or per device as <pattern>:<limit>,...,default:<limit> (uses --state-file)",
+			Value:    &plugin.CritReadAwaitMs,
+		},
+		{
+			Path:     "warn-write-await-ms",
+			Env:      "CHECK_DISK_IO_WARN_WRITE_AWAIT_MS",
+			Argument: "warn-write-await-ms",
+			Default:  "",
+			Usage:    "Warn when the writes a device completed since the previous run took longer than this many milliseconds on average, or per device as <pattern>:<limit>,...,default:<limit> (uses --state-file)",
+			Value:    &plugin.WarnWriteAwaitMs,
+		},
+		{
+			Path:     "crit-write-await-ms",
+			Env:      "CHECK_DISK_IO_CRIT_WRITE_AWAIT_MS",
+			Argument: "crit-write-await-ms",
+			Default:  "",
+			Usage:    "Go critical when the writes a device completed since the previous run took longer than this many milliseconds on average, or per device as <pattern>:<limit>,...,default:<limit> (uses --state-file)",
+			Value:    &plugin.CritWriteAwaitMs,
+		},
+		{
+			Path:     "warn-queue-depth",
+			Env:      "CHECK_DISK_IO_WARN_QUEUE_DEPTH",
+			Argument: "warn-queue-depth",
+			Default:  "",
+			Usage:    "Warn when the average number of IOs queued on a device since the previous run, from the growth of weighted_io, is above this, or per device as <pattern>:<limit>,...,default:<limit> (uses --state-file)",
+			Value:    &plugin.WarnQueueDepth,
+		},
+		{
+			Path:     "crit-queue-depth",
+			Env:      "CHECK_DISK_IO_CRIT_QUEUE_DEPTH",
+			Argument: "crit-queue-depth",
+			Default:  "",
+			Usage:    "Go critical when the average number of IOs queued on a device since the previous run, from the growth of weighted_io, is above this, or per device as <pattern>:<limit>,...,default:<limit> (uses --state-file)",
+			Value:    &plugin.CritQueueDepth,
+		},
+		{
+			Path:     "device-threshold",
+			Env:      "CHECK_DISK_IO_DEVICE_THRESHOLD",
+			Argument: "device-threshold",
+			Default:  []string{},
+			Usage:    "Per-device throughput limits such as sda:write-crit=100MiB,read-warn=50MiB, repeatable (uses --state-file)",
+			Value:    &plugin.DeviceThresholds,
+		},
+		{
+			Path:     "suggest-thresholds",
+			Env:      "CHECK_DISK_IO_SUGGEST_THRESHOLDS",
+			Argument: "suggest-thresholds",
+			Default:  false,
+			Usage:    "Print --device-threshold suggestions derived from the observed throughput to stderr instead of alerting (uses --state-file)",
+			Value:    &plugin.SuggestThresholds,
+		},
+		{
+			Path:     "throughput-history",
+			Env:      "CHECK_DISK_IO_THROUGHPUT_HISTORY",
+			Argument: "throughput-history",
+			Default:  100,
+			Usage:    "Number of runs of per-device throughput history kept for --suggest-thresholds",
+			Value:    &plugin.ThroughputHistory,
+		},
+		{
+			Path:     "summary-top",
+			Env:      "CHECK_DISK_IO_SUMMARY_TOP",
+			Argument: "summary-top",
+			Default:  3,
+			Usage:    "When a threshold is exceeded, first write a one-line summary listing up to this many violations and the busiest devices by utilization, 0 to disable",
+			Value:    &plugin.SummaryTop,
+		},
+		{
+			Path:     "emit-delta",
+			Env:      "CHECK_DISK_IO_EMIT_DELTA",
+			Argument: "emit-delta",
+			Default:  false,
+			Usage:    "Emit the increase of every counter since the previous run as *_delta (uses --state-file)",
+			Value:    &plugin.EmitDelta,
+		},
+		{
+			Path:     "emit-rate",
+			Env:      "CHECK_DISK_IO_EMIT_RATE",
+			Argument: "emit-rate",
+			Default:  false,
+			Usage:    "Emit the per-second rate of every counter since the previous run as *_per_sec (uses --state-file)",
+			Value:    &plugin.EmitRate,
+		},
+		{
+			Path:     "rate",
+			Env:      "CHECK_DISK_IO_RATE",
+			Argument: "rate",
+			Default:  false,
+			Usage:    "Sample the counters twice, --interval apart, and report the per-second rate of every counter instead of its raw value",
+			Value:    &plugin.Rate,
+		},
+		{
+			Path:     "interval",
+			Env:      "CHECK_DISK_IO_INTERVAL",
+			Argument: "interval",
+			Default:  "1s",
+			Usage:    "Time between the two samples taken with --rate",
+			Value:    &plugin.Interval,
+		},
+		{
+			Path:     "sub-sample-interval",
+			Env:      "CHECK_DISK_IO_SUB_SAMPLE_INTERVAL",
+			Argument: "sub-sample-interval",
+			Default:  "",
+			Usage:    "With --rate, also sample the counters this often within --interval and emit the min, max and p95 of the utilization and await of the sub-intervals, and a histogram of their await",
+			Value:    &plugin.SubSampleInterval,
+		},
+		{
+			Path:     "rate-window",
+			Env:      "CHECK_DISK_IO_RATE_WINDOW",
+			Argument: "rate-window",
+			Default:  "",
+			Usage:    "Emit per-second rates of the counters averaged over this window, e.g. 5m (uses --state-file)",
+			Value:    &plugin.RateWindow,
+		},
+		{
+			Path:     "detect-stuck",
+			Env:      "CHECK_DISK_IO_DETECT_STUCK",
+			Argument: "detect-stuck",
+			Default:  false,
+			Usage:    "Emit disk_io_stuck=1 for devices whose counters stop moving while IOs are in flight (uses --state-file)",
+			Value:    &plugin.DetectStuck,
+		},
+		{
+			Path:     "stuck-threshold",
+			Env:      "CHECK_DISK_IO_STUCK_THRESHOLD",
+			Argument: "stuck-threshold",
+			Default:  5,
+			Usage:    "Number of consecutive unchanged runs after which --detect-stuck reports a device as stuck",
+			Value:    &plugin.StuckThreshold,
+		},
+		{
+			Path:     "host-proc",
+			Env:      "CHECK_DISK_IO_HOST_PROC",
+			Argument: "host-proc",
+			Default:  "",
+			Usage:    "Read procfs from this path, where the host's /proc is mounted in a container (sets HOST_PROC)",
+			Value:    &plugin.HostProc,
+		},
+		{
+			Path:     "host-sys",
+			Env:      "CHECK_DISK_IO_HOST_SYS",
+			Argument: "host-sys",
+			Default:  "",
+			Usage:    "Read sysfs from this path, where the host's /sys is mounted in a container (sets HOST_SYS)",
+			Value:    &plugin.HostSys,
+		},
+		{
+			Path:     "device",
+			Env:      "CHECK_DISK_IO_DEVICE",
+			Argument: "device",
+			Default:  []string{},
+			Usage:    "Only report these devices (kernel names such as sda or /dev/disk/by-id paths, repeatable), even when they have no mounted partition",
+			Value:    &plugin.Devices,
+		},
+		{
+			Path:     "root-only",
+			Env:      "CHECK_DISK_IO_ROOT_ONLY",
+			Argument: "root-only",
+			Default:  false,
+			Usage:    "Only report the device backing the / mountpoint",
+			Value:    &plugin.RootOnly,
+		},
+		{
+			Path:     "all-devices",
+			Env:      "CHECK_DISK_IO_ALL_DEVICES",
+			Argument: "all-devices",
+			Default:  false,
+			Usage:    "Report every block device the kernel knows about instead of only those with a mounted partition",
+			Value:    &plugin.AllDevices,
+		},
+		{
+			Path:     "include-device",
+			Env:      "CHECK_DISK_IO_INCLUDE_DEVICE",
+			Argument: "include-device",
+			Default:  "",
+			Usage:    "Only report devices whose kernel name matches this regular expression",
+			Value:    &plugin.IncludeDevice,
+		},
+		{
+			Path:     "exclude-device",
+			Env:      "CHECK_DISK_IO_EXCLUDE_DEVICE",
+			Argument: "exclude-device",
+			Default:  "",
+			Usage:    "Do not report devices whose kernel name matches this regular expression",
+			Value:    &plugin.ExcludeDevice,
+		},
+		{
+			Path:     "exclude-serial",
+			Env:      "CHECK_DISK_IO_EXCLUDE_SERIAL",
+			Argument: "exclude-serial",
+			Default:  []string{},
+			Usage:    "Do not report devices with these serial numbers (repeatable)",
+			Value:    &plugin.ExcludeSerials,
+		},
+		{
+			Path:     "device-identifier",
+			Env:      "CHECK_DISK_IO_DEVICE_IDENTIFIER",
+			Argument: "device-identifier",
+			Default:  identifierKernel,
+			Usage:    "Name used in the device tag: kernel (sda), by-path or by-id (the udev name in /dev/disk/by-path or /dev/disk/by-id)",
+			Value:    &plugin.DeviceIdentifier,
+		},
+		{
+			Path:     "emit-zero-for-missing",
+			Env:      "CHECK_DISK_IO_EMIT_ZERO_FOR_MISSING",
+			Argument: "emit-zero-for-missing",
+			Default:  false,
+			Usage:    "Emit zero-valued samples and disk_io_up=0 for --device entries that are not present",
+			Value:    &plugin.EmitZeroForMissing,
+		},
+		{
+			Path:     "fixed-device-set",
+			Env:      "CHECK_DISK_IO_FIXED_DEVICE_SET",
+			Argument: "fixed-device-set",
+			Default:  "",
+			Usage:    "File listing the devices that are always reported, one per line; absent ones are emitted as zeros with disk_io_up=0",
+			Value:    &plugin.FixedDeviceSet,
+		},
+		{
+			Path:     "unexpected-devices",
+			Env:      "CHECK_DISK_IO_UNEXPECTED_DEVICES",
+			Argument: "unexpected-devices",
+			Default:  unexpectedDrop,
+			Usage:    "What to do with devices not in --fixed-device-set: drop or warn (report them and log a warning)",
+			Value:    &plugin.UnexpectedDevices,
+		},
+		{
+			Path:     "state-file",
+			Env:      "CHECK_DISK_IO_STATE_FILE",
+			Argument: "state-file",
+			Default:  "/var/cache/check-disk-io/state.json",
+			Usage:    "Path of the file used to persist samples between runs for state-based features",
+			Value:    &plugin.StateFile,
+		},
+		{
+			Path:     "latency-slo-ms",
+			Env:      "CHECK_DISK_IO_LATENCY_SLO_MS",
+			Argument: "latency-slo-ms",
+			Default:  0,
+			Usage:    "Count the runs in which any device's average IO latency since the previous run exceeds this many milliseconds in disk_latency_slo_breaches_total (uses --state-file)",
+			Value:    &plugin.LatencySLOMs,
+		},
+		{
+			Path:     "absent-retention",
+			Env:      "CHECK_DISK_IO_ABSENT_RETENTION",
+			Argument: "absent-retention",
+			Default:  "24h",
+			Usage:    "How long a device that disappeared is remembered in --state-file, to detect its reappearance",
+			Value:    &plugin.AbsentRetention,
+		},
+		{
+			Path:     "with-latency-percentiles",
+			Env:      "CHECK_DISK_IO_WITH_LATENCY_PERCENTILES",
+			Argument: "with-latency-percentiles",
+			Default:  false,
+			Usage:    "Emit p50/p95 read and write latency over the last --latency-window runs (uses --state-file)",
+			Value:    &plugin.WithLatencyPercentiles,
+		},
+		{
+			Path:     "latency-window",
+			Env:      "CHECK_DISK_IO_LATENCY_WINDOW",
+			Argument: "latency-window",
+			Default:  30,
+			Usage:    "Number of runs of per-device latency history kept for --with-latency-percentiles",
+			Value:    &plugin.LatencyWindow,
 		},
-		"disk_write_bytes": {
-			Name: "disk_write_bytes",
-			Type: "COUNTER",
-			Comment: "These values count the number of bytes read from or written to this block device.",
+		{
+			Path:     "anomaly-factor",
+			Env:      "CHECK_DISK_IO_ANOMALY_FACTOR",
+			Argument: "anomaly-factor",
+			Default:  0.0,
+			Usage:    "Warn when the throughput or await of a device since the previous run exceeds this many times its median over the last --anomaly-window runs, 0 to disable (uses --state-file)",
+			Value:    &plugin.AnomalyFactor,
 		},
-		"disk_read_count": {
-			Name: "disk_read_count",
-			Type: "COUNTER",
-			Comment: "These values increment when an I/O request completes.",
+		{
+			Path:     "anomaly-window",
+			Env:      "CHECK_DISK_IO_ANOMALY_WINDOW",
+			Argument: "anomaly-window",
+			Default:  30,
+			Usage:    "Number of runs of per-device throughput and await history kept for --anomaly-factor",
+			Value:    &plugin.AnomalyWindow,
 		},
-		"disk_write_count": {
-			Name: "disk_write_count",
-			Type: "COUNTER",
-			Comment: "These values increment when an I/O request completes.",
+		{
+			Path:     "skip-idle",
+			Env:      "CHECK_DISK_IO_SKIP_IDLE",
+			Argument: "skip-idle",
+			Default:  false,
+			Usage:    "Do not report devices that have not read or written anything since boot",
+			Value:    &plugin.SkipIdle,
 		},
-		"disk_read_time": {
-			Name: "disk_read_time",
-			Type: "COUNTER",
-			Comment: "These values count the number of milliseconds that I/O requests have waited on this block device. If there are multiple I/O requests waiting, these values will increase at a rate greater than 1000/second; for example, if 60 read requests wait for an average of 30 ms, the read_time field will increase by 60*30 = 1800.",
+		{
+			Path:     "skip-swap",
+			Env:      "CHECK_DISK_IO_SKIP_SWAP",
+			Argument: "skip-swap",
+			Default:  false,
+			Usage:    "Do not report zram devices and swap partitions listed in /proc/swaps",
+			Value:    &plugin.SkipSwap,
 		},
-		"disk_write_time": {
-			Name: "disk_write_time",
-			Type: "COUNTER",
-			Comment: "These values count the number of milliseconds that I/O requests have waited on this block device. If there are multiple I/O requests waiting, these values will increase at a rate greater than 1000/second; for example, if 60 read requests wait for an average of 30 ms, the read_time field will increase by 60*30 = 1800.",
+		{
+			Path:     "device-size-min",
+			Env:      "CHECK_DISK_IO_DEVICE_SIZE_MIN",
+			Argument: "device-size-min",
+			Default:  "",
+			Usage:    "Only report devices at least this large, e.g. 1TiB",
+			Value:    &plugin.DeviceSizeMin,
 		},
-		"disk_io_time": {
-			Name: "disk_io_time",
-			Type: "COUNTER",
-			Comment: "This value counts the number of milliseconds during which the device has had I/O requests queued.",
+		{
+			Path:     "device-size-max",
+			Env:      "CHECK_DISK_IO_DEVICE_SIZE_MAX",
+			Argument: "device-size-max",
+			Default:  "",
+			Usage:    "Only report devices at most this large, e.g. 500GB",
+			Value:    &plugin.DeviceSizeMax,
 		},
-		"disk_weighted_io": {
-			Name: "disk_weighted_io",
-			Type: "COUNTER",
-			Comment: "This value counts the number of milliseconds that I/O requests have waited on this block device. If there are multiple I/O requests waiting, this value will increase as the product of the number of milliseconds times the number of requests waiting (see disk_read_time for an example).",
+		{
+			Path:     "drop-unknown-size",
+			Env:      "CHECK_DISK_IO_DROP_UNKNOWN_SIZE",
+			Argument: "drop-unknown-size",
+			Default:  false,
+			Usage:    "Drop devices whose size cannot be determined when a size range is set",
+			Value:    &plugin.DropUnknownSize,
 		},
-		"disk_iops_in_progress": {
-			Name: "disk_iops_in_progress",
-			Type: "GAUGE",
-			Comment: "This value counts the number of I/O requests that have been issued to the device driver but have not yet completed. It does not include I/O requests that are in the queue but not yet issued to the device driver.",
+		{
+			Path:     "multi-mount-policy",
+			Env:      "CHECK_DISK_IO_MULTI_MOUNT_POLICY",
+			Argument: "multi-mount-policy",
+			Default:  multiMountDuplicate,
+			Usage:    "How to report a device mounted at several places: duplicate, primary (counters on the first mountpoint, zero elsewhere) or dedup (first mountpoint only)",
+			Value:    &plugin.MultiMountPolicy,
 		},
-		"disk_merged_read_count": {
-			Name: "disk_merged_read_count",
-			Type: "COUNTER",
-			Comment: "Reads and writes which are adjacent to each other may be merged for efficiency. Thus, two 4K reads may become one 8K read before it is ultimately handed to the disk, and so it will be counted (and queued) as only one I/O. These fields lets you know how often this was done.",
+		{
+			Path:     "fstype-include",
+			Env:      "CHECK_DISK_IO_FSTYPE_INCLUDE",
+			Argument: "fstype-include",
+			Default:  []string{},
+			Usage:    "Only report partitions with these filesystem types (comma-separated); takes precedence over --fstype-exclude",
+			Value:    &plugin.FstypeInclude,
 		},
-		"disk_merged_write_count": {
-			Name: "disk_merged_write_count",
-			Type: "COUNTER",
-			Comment: "Reads and writes which are adjacent to each other may be merged for efficiency. Thus, two 4K reads may become one 8K read before it is ultimately handed to the disk, and so it will be counted (and queued) as only one I/O. These fields lets you know how often this was done.",
+		{
+			Path:     "fstype-exclude",
+			Env:      "CHECK_DISK_IO_FSTYPE_EXCLUDE",
+			Argument: "fstype-exclude",
+			Default:  defaultFstypeExclude,
+			Usage:    "Do not report partitions with these filesystem types (comma-separated)",
+			Value:    &plugin.FstypeExclude,
+		},
+		{
+			Path:     "dedup-device",
+			Env:      "CHECK_DISK_IO_DEDUP_DEVICE",
+			Argument: "dedup-device",
+			Default:  false,
+			Usage:    "Report a device mounted at several places once, with its first mountpoint (same as --multi-mount-policy dedup)",
+			Value:    &plugin.DedupDevice,
+		},
+		{
+			Path:     "whole-device-only",
+			Env:      "CHECK_DISK_IO_WHOLE_DEVICE_ONLY",
+			Argument: "whole-device-only",
+			Default:  false,
+			Usage:    "Report the parent device of partitions instead of the partitions, once per device with its first mountpoint (Linux only)",
+			Value:    &plugin.WholeDeviceOnly,
+		},
+		{
+			Path:     "concurrency",
+			Env:      "CHECK_DISK_IO_CONCURRENCY",
+			Argument: "concurrency",
+			Default:  0,
+			Usage:    "Deprecated and ignored: the IO counters of all devices are now read at once (kept so existing check definitions keep working)",
+			Value:    &plugin.Concurrency,
+		},
+		{
+			Path:     "retries",
+			Env:      "CHECK_DISK_IO_RETRIES",
+			Argument: "retries",
+			Default:  0,
+			Usage:    "Number of times a failed IO counter read is retried",
+			Value:    &plugin.Retries,
+		},
+		{
+			Path:     "retry-delay",
+			Env:      "CHECK_DISK_IO_RETRY_DELAY",
+			Argument: "retry-delay",
+			Default:  "100ms",
+			Usage:    "Time to wait before each of the --retries",
+			Value:    &plugin.RetryDelay,
+		},
+		{
+			Path:     "timeout",
+			Env:      "CHECK_DISK_IO_TIMEOUT",
+			Argument: "timeout",
+			Default:  "",
+			Usage:    "Give up on partition and IO counter reads still running after this long, including the --interval of --rate, and report what was collected with a warning",
+			Value:    &plugin.Timeout,
+		},
+		{
+			Path:     "fail-state",
+			Env:      "CHECK_DISK_IO_FAIL_STATE",
+			Argument: "fail-state",
+			Default:  failStateCritical,
+			Usage:    "Check state when no IO counters could be collected: warning or critical",
+			Value:    &plugin.FailState,
+		},
+		{
+			Path:     "ignore-collection-errors",
+			Env:      "CHECK_DISK_IO_IGNORE_COLLECTION_ERRORS",
+			Argument: "ignore-collection-errors",
+			Default:  false,
+			Usage:    "Do not change the check state when partitions or IO counters cannot be read; the errors are still written to stderr",
+			Value:    &plugin.IgnoreCollectionErrors,
+		},
+		{
+			Path:     "with-cache-role",
+			Env:      "CHECK_DISK_IO_WITH_CACHE_ROLE",
+			Argument: "with-cache-role",
+			Default:  false,
+			Usage:    "Add a cache_role tag (cache, backing or none) for bcache and dm-cache members (Linux only)",
+			Value:    &plugin.WithCacheRole,
+		},
+		{
+			Path:     "device-metadata",
+			Env:      "CHECK_DISK_IO_DEVICE_METADATA",
+			Argument: "device-metadata",
+			Default:  false,
+			Usage:    "Add model, serial, wwn and rotational (true or false) tags from sysfs and udev to the samples of each device (Linux only)",
+			Value:    &plugin.DeviceMetadata,
+		},
+		{
+			Path:     "with-fstype",
+			Env:      "CHECK_DISK_IO_WITH_FSTYPE",
+			Argument: "with-fstype",
+			Default:  false,
+			Usage:    "Add an fstype tag with the filesystem type of the mountpoint",
+			Value:    &plugin.WithFstype,
+		},
+		{
+			Path:     "with-lvm-tags",
+			Env:      "CHECK_DISK_IO_WITH_LVM_TAGS",
+			Argument: "with-lvm-tags",
+			Default:  false,
+			Usage:    "Add vg_name and lv_name tags to LVM logical volumes (Linux only)",
+			Value:    &plugin.WithLVMTags,
+		},
+		{
+			Path:     "resolve-dm-names",
+			Env:      "CHECK_DISK_IO_RESOLVE_DM_NAMES",
+			Argument: "resolve-dm-names",
+			Default:  false,
+			Usage:    "Use the device-mapper name, such as vg0-root, in the device tag of dm devices instead of dm-0 (Linux only)",
+			Value:    &plugin.ResolveDMNames,
+		},
+		{
+			Path:     "with-md-arrays",
+			Env:      "CHECK_DISK_IO_WITH_MD_ARRAYS",
+			Argument: "with-md-arrays",
+			Default:  false,
+			Usage:    "Add an array tag, such as md0, to the members of md RAID arrays listed in /proc/mdstat (Linux only)",
+			Value:    &plugin.WithMdArrays,
+		},
+		{
+			Path:     "md-rollup",
+			Env:      "CHECK_DISK_IO_MD_ROLLUP",
+			Argument: "md-rollup",
+			Default:  false,
+			Usage:    "Emit the lowest and highest average read and write wait among the members of each md array, to spot a slow member (Linux only)",
+			Value:    &plugin.MdRollup,
+		},
+		{
+			Path:     "smart",
+			Env:      "CHECK_DISK_IO_SMART",
+			Argument: "smart",
+			Default:  false,
+			Usage:    "Emit the NVMe health log and the ATA SMART attributes of each disk (Linux only, needs root or CAP_SYS_ADMIN)",
+			Value:    &plugin.Smart,
+		},
+		{
+			Path:     "cgroups",
+			Env:      "CHECK_DISK_IO_CGROUPS",
+			Argument: "cgroups",
+			Default:  false,
+			Usage:    "Emit the bytes and IOs of every cgroup per device from the io (v2) or blkio (v1) controller, tagged with cgroup and container_id (Linux only)",
+			Value:    &plugin.Cgroups,
+		},
+		{
+			Path:     "zfs",
+			Env:      "CHECK_DISK_IO_ZFS",
+			Argument: "zfs",
+			Default:  false,
+			Usage:    "Emit the operations and bandwidth of every ZFS pool and vdev and their latency histograms, from zpool iostat",
+			Value:    &plugin.ZFS,
+		},
+		{
+			Path:     "zpool-command",
+			Env:      "CHECK_DISK_IO_ZPOOL_COMMAND",
+			Argument: "zpool-command",
+			Default:  "zpool",
+			Usage:    "The zpool command run by --zfs",
+			Value:    &plugin.ZpoolCommand,
+		},
+		{
+			Path:     "with-cloud-tags",
+			Env:      "CHECK_DISK_IO_WITH_CLOUD_TAGS",
+			Argument: "with-cloud-tags",
+			Default:  false,
+			Usage:    "Add instance_id, region and zone tags from the cloud instance metadata service",
+			Value:    &plugin.WithCloudTags,
+		},
+		{
+			Path:     "cloud",
+			Env:      "CHECK_DISK_IO_CLOUD",
+			Argument: "cloud",
+			Default:  "auto",
+			Usage:    "Cloud provider queried by --with-cloud-tags: auto, aws, gcp or azure",
+			Value:    &plugin.Cloud,
+		},
+		{
+			Path:     "with-device-info",
+			Env:      "CHECK_DISK_IO_WITH_DEVICE_INFO",
+			Argument: "with-device-info",
+			Default:  false,
+			Usage:    "Emit a disk_io_device_info info metric carrying the serial number and label of each device",
+			Value:    &plugin.WithDeviceInfo,
+		},
+		{
+			Path:     "baseline-file",
+			Env:      "CHECK_DISK_IO_BASELINE_FILE",
+			Argument: "baseline-file",
+			Default:  "",
+			Usage:    "Emit *_since_baseline counters relative to the snapshot stored in this file",
+			Value:    &plugin.BaselineFile,
+		},
+		{
+			Path:     "set-baseline",
+			Env:      "CHECK_DISK_IO_SET_BASELINE",
+			Argument: "set-baseline",
+			Default:  false,
+			Usage:    "Store the current counters in --baseline-file instead of reporting deltas",
+			Value:    &plugin.SetBaseline,
+		},
+		{
+			Path:     "format",
+			Env:      "CHECK_DISK_IO_FORMAT",
+			Argument: "format",
+			Default:  formatPrometheus,
+			Usage:    "Output format, or a comma-separated list of them each with its --output-file but one: prometheus, json for one JSON object per sample and line, json-document for a single JSON document with one object per device, influxdb for InfluxDB line protocol, graphite for Graphite plaintext, env for NAME=value lines a shell can source, or labels to list the distinct values of --labels-tag",
+			Value:    &plugin.Format,
+		},
+		{
+			Path:     "no-timestamp",
+			Env:      "CHECK_DISK_IO_NO_TIMESTAMP",
+			Argument: "no-timestamp",
+			Default:  false,
+			Usage:    "Do not append the collection time in milliseconds to each prometheus sample",
+			Value:    &plugin.NoTimestamp,
+		},
+		{
+			Path:     "legacy-output",
+			Env:      "CHECK_DISK_IO_LEGACY_OUTPUT",
+			Argument: "legacy-output",
+			Default:  false,
+			Usage:    "Write the prometheus format of earlier releases, with upper-case types and unescaped tag values",
+			Value:    &plugin.LegacyOutput,
+		},
+		{
+			Path:     "list-metrics",
+			Env:      "CHECK_DISK_IO_LIST_METRICS",
+			Argument: "list-metrics",
+			Default:  false,
+			Usage:    "Print the metric groups this platform can emit, one per line, and exit without collecting",
+			Value:    &plugin.ListMetrics,
+		},
+		{
+			Path:     "totals",
+			Env:      "CHECK_DISK_IO_TOTALS",
+			Argument: "totals",
+			Default:  false,
+			Usage:    "Also emit the read and write bytes, counts and times summed across all reported devices, tagged device=\"all\"",
+			Value:    &plugin.Totals,
+		},
+		{
+			Path:     "graphite-prefix",
+			Env:      "CHECK_DISK_IO_GRAPHITE_PREFIX",
+			Argument: "graphite-prefix",
+			Default:  "servers",
+			Usage:    "First segments of every metric path written by --format graphite, followed by the host tag",
+			Value:    &plugin.GraphitePrefix,
+		},
+		{
+			Path:     "influx-measurement",
+			Env:      "CHECK_DISK_IO_INFLUX_MEASUREMENT",
+			Argument: "influx-measurement",
+			Default:  "disk_io",
+			Usage:    "Measurement of the lines written by --format influxdb, or the prefix of their measurements with --influx-fields-mode per-metric-measurement",
+			Value:    &plugin.InfluxMeasurement,
+		},
+		{
+			Path:     "influx-fields-mode",
+			Env:      "CHECK_DISK_IO_INFLUX_FIELDS_MODE",
+			Argument: "influx-fields-mode",
+			Default:  output.InfluxMultiField,
+			Usage:    "Schema of --format influxdb: single-measurement-multi-field for one line per device with every metric as a field, or per-metric-measurement for one line per sample with a measurement per metric",
+			Value:    &plugin.InfluxFieldsMode,
+		},
+		{
+			Path:     "labels-tag",
+			Env:      "CHECK_DISK_IO_LABELS_TAG",
+			Argument: "labels-tag",
+			Default:  "device",
+			Usage:    "Tag whose values are listed by --format labels",
+			Value:    &plugin.LabelsTag,
+		},
+		{
+			Path:     "otlp-endpoint",
+			Env:      "CHECK_DISK_IO_OTLP_ENDPOINT",
+			Argument: "otlp-endpoint",
+			Default:  "",
+			Usage:    "Also export the metrics to this OTLP/HTTP metrics URL (e.g. http://localhost:4318/v1/metrics)",
+			Value:    &plugin.OTLPEndpoint,
+		},
+		{
+			Path:     "otlp-header",
+			Env:      "CHECK_DISK_IO_OTLP_HEADER",
+			Argument: "otlp-header",
+			Default:  map[string]string{},
+			Usage:    "HTTP header sent with the OTLP export, as key=value (repeatable)",
+			Value:    &plugin.OTLPHeaders,
+			Secret:   true,
+		},
+		{
+			Path:     "otlp-insecure",
+			Env:      "CHECK_DISK_IO_OTLP_INSECURE",
+			Argument: "otlp-insecure",
+			Default:  false,
+			Usage:    "Skip TLS certificate verification for the OTLP export",
+			Value:    &plugin.OTLPInsecure,
+		},
+		{
+			Path:     "statsd-addr",
+			Env:      "CHECK_DISK_IO_STATSD_ADDR",
+			Argument: "statsd-addr",
+			Default:  "",
+			Usage:    "Also send the metrics in DogStatsD format over UDP to this host:port",
+			Value:    &plugin.StatsDAddr,
+		},
+		{
+			Path:     "statsd-only",
+			Env:      "CHECK_DISK_IO_STATSD_ONLY",
+			Argument: "statsd-only",
+			Default:  false,
+			Usage:    "Send the metrics to --statsd-addr only and write nothing to stdout",
+			Value:    &plugin.StatsDOnly,
+		},
+		{
+			Path:     "namespace",
+			Env:      "CHECK_DISK_IO_NAMESPACE",
+			Argument: "namespace",
+			Default:  "",
+			Usage:    "Prefix every metric name with this namespace and an underscore, e.g. node for node_disk_read_bytes",
+			Value:    &plugin.Namespace,
+		},
+		{
+			Path:     "naming-scheme",
+			Env:      "CHECK_DISK_IO_NAMING_SCHEME",
+			Argument: "naming-scheme",
+			Default:  namingLegacy,
+			Usage:    "Names of the raw counter groups: legacy (disk_read_bytes) or node-exporter (node_disk_read_bytes_total, times in seconds)",
+			Value:    &plugin.NamingScheme,
+		},
+		{
+			Path:     "time-unit",
+			Env:      "CHECK_DISK_IO_TIME_UNIT",
+			Argument: "time-unit",
+			Default:  timeUnitMs,
+			Usage:    "Unit of the times output in milliseconds: ms, or s to convert them and name the groups after seconds, e.g. disk_read_time_seconds_total",
+			Value:    &plugin.TimeUnit,
+		},
+		{
+			Path:     "size-unit",
+			Env:      "CHECK_DISK_IO_SIZE_UNIT",
+			Argument: "size-unit",
+			Default:  sizeUnitBytes,
+			Usage:    "Unit of the sizes output in bytes: bytes, kib or mib to convert them and name the groups after that unit, e.g. disk_read_mebibytes_total",
+			Value:    &plugin.SizeUnit,
+		},
+		{
+			Path:     "metrics",
+			Env:      "CHECK_DISK_IO_METRICS",
+			Argument: "metrics",
+			Default:  []string{},
+			Usage:    "Only output these metric groups (comma-separated), all of them when empty",
+			Value:    &plugin.Metrics,
+		},
+		{
+			Path:     "type-override",
+			Env:      "CHECK_DISK_IO_TYPE_OVERRIDE",
+			Argument: "type-override",
+			Default:  map[string]string{},
+			Usage:    "Emit a metric group with another type, as group=type with type counter, gauge or untyped (repeatable)",
+			Value:    &plugin.TypeOverrides,
+		},
+		{
+			Path:     "mask-label-values",
+			Env:      "CHECK_DISK_IO_MASK_LABEL_VALUES",
+			Argument: "mask-label-values",
+			Default:  []string{},
+			Usage:    "Tag keys whose values are masked before they are emitted, e.g. mountpoint,label",
+			Value:    &plugin.MaskLabelValues,
+		},
+		{
+			Path:     "mask-method",
+			Env:      "CHECK_DISK_IO_MASK_METHOD",
+			Argument: "mask-method",
+			Default:  maskHash,
+			Usage:    "How --mask-label-values masks a value: hash (salted SHA-256 prefix, keeps values distinct) or placeholder",
+			Value:    &plugin.MaskMethod,
+		},
+		{
+			Path:     "mask-salt",
+			Env:      "CHECK_DISK_IO_MASK_SALT",
+			Argument: "mask-salt",
+			Default:  "",
+			Usage:    "Secret prepended to values hashed by --mask-label-values",
+			Value:    &plugin.MaskSalt,
+			Secret:   true,
+		},
+		{
+			Path:     "tag",
+			Env:      "CHECK_DISK_IO_TAG",
+			Argument: "tag",
+			Default:  []string{},
+			Usage:    "Add this key=value tag to every sample (repeatable); tags set by the check take precedence",
+			Value:    &plugin.StaticTags,
+		},
+		{
+			Path:     "hostname",
+			Env:      "CHECK_DISK_IO_HOSTNAME",
+			Argument: "hostname",
+			Default:  "",
+			Usage:    "Value of the host tag added to every sample, instead of the detected hostname",
+			Value:    &plugin.Hostname,
+		},
+		{
+			Path:     "no-hostname",
+			Env:      "CHECK_DISK_IO_NO_HOSTNAME",
+			Argument: "no-hostname",
+			Default:  false,
+			Usage:    "Do not add a host tag to every sample",
+			Value:    &plugin.NoHostname,
+		},
+		{
+			Path:     "instance",
+			Env:      "CHECK_DISK_IO_INSTANCE",
+			Argument: "instance",
+			Default:  "",
+			Usage:    "Add an instance tag with this value to every sample, for central collection from several targets",
+			Value:    &plugin.Instance,
+		},
+		{
+			Path:     "job",
+			Env:      "CHECK_DISK_IO_JOB",
+			Argument: "job",
+			Default:  "",
+			Usage:    "Add a job tag with this value to every sample",
+			Value:    &plugin.Job,
+		},
+		{
+			Path:     "output-buffer-size",
+			Env:      "CHECK_DISK_IO_OUTPUT_BUFFER_SIZE",
+			Argument: "output-buffer-size",
+			Default:  65536,
+			Usage:    "Size in bytes of the buffer the output is written through, 0 to write every line directly",
+			Value:    &plugin.OutputBufferSize,
+		},
+		{
+			Path:     "output-file",
+			Env:      "CHECK_DISK_IO_OUTPUT_FILE",
+			Argument: "output-file",
+			Default:  "",
+			Usage:    "Write the metrics to this file, replaced atomically, instead of stdout, or per format as <format>=<path>,...",
+			Value:    &plugin.OutputFile,
+		},
+		{
+			Path:     "fifo",
+			Env:      "CHECK_DISK_IO_FIFO",
+			Argument: "fifo",
+			Default:  "",
+			Usage:    "Write the metrics to this named pipe instead of stdout",
+			Value:    &plugin.FIFO,
+		},
+		{
+			Path:     "fifo-timeout",
+			Env:      "CHECK_DISK_IO_FIFO_TIMEOUT",
+			Argument: "fifo-timeout",
+			Default:  "5s",
+			Usage:    "How long to wait for a reader on --fifo before giving up",
+			Value:    &plugin.FIFOTimeout,
+		},
+		{
+			Path:     "config",
+			Env:      "CHECK_DISK_IO_CONFIG",
+			Argument: "config",
+			Default:  "",
+			Usage:    "Read the options not set by flag or environment variable from this YAML file, e.g. /etc/sensu/check-disk-io.yml",
+			Value:    &plugin.ConfigFile,
+		},
+		{
+			Path:     "read-event",
+			Env:      "CHECK_DISK_IO_READ_EVENT",
+			Argument: "read-event",
+			Default:  false,
+			Usage:    "Read the Sensu event from stdin (check stdin: true) and apply the option overrides in its check and entity annotations",
+			Value:    &plugin.ReadEvent,
+		},
+		{
+			Path:     "daemon",
+			Env:      "CHECK_DISK_IO_DAEMON",
+			Argument: "daemon",
+			Default:  false,
+			Usage:    "Run continuously, sampling every --daemon-interval, and serve the latest metrics with their rates over HTTP on --listen",
+			Value:    &plugin.Daemon,
+		},
+		{
+			Path:     "listen",
+			Env:      "CHECK_DISK_IO_LISTEN",
+			Argument: "listen",
+			Default:  ":9555",
+			Usage:    "Address on which --daemon serves /metrics",
+			Value:    &plugin.Listen,
+		},
+		{
+			Path:     "daemon-interval",
+			Env:      "CHECK_DISK_IO_DAEMON_INTERVAL",
+			Argument: "daemon-interval",
+			Default:  "15s",
+			Usage:    "Time between the samples taken by --daemon",
+			Value:    &plugin.DaemonInterval,
 		},
 	}
+)
+
+func main() {
+	check := sensu.NewGoCheck(&plugin.PluginConfig, options, checkArgs, executeCheck, false)
+	check.Execute()
+}
 
-	for _, p := range parts {
-		diskio, err := disk.IOCounters(p.Device)
+func checkArgs(event *types.Event) (int, error) {
+	if flagConfig == nil {
+		c := plugin
+		flagConfig = &c
+	}
+	if len(plugin.ConfigFile) > 0 {
+		if err := loadConfig(plugin.ConfigFile, options, explicitOptions(os.Args[1:], options)); err != nil {
+			return sensu.CheckStateWarning, fmt.Errorf("invalid --config %s: %v", plugin.ConfigFile, err)
+		}
+	}
+	if plugin.ReadEvent {
+		if stdinEvent == nil {
+			e, err := readEvent(os.Stdin)
+			if err != nil {
+				return sensu.CheckStateWarning, fmt.Errorf("failed to read the event from stdin: %v", err)
+			}
+			stdinEvent = e
+		}
+		if err := applyAnnotations(plugin.Keyspace, options, stdinEvent); err != nil {
+			return sensu.CheckStateWarning, err
+		}
+	}
+	if plugin.DedupDevice {
+		if plugin.MultiMountPolicy != multiMountDuplicate && plugin.MultiMountPolicy != multiMountDedup {
+			return sensu.CheckStateWarning, fmt.Errorf("--dedup-device cannot be combined with --multi-mount-policy %s", plugin.MultiMountPolicy)
+		}
+		plugin.MultiMountPolicy = multiMountDedup
+	}
+	if plugin.WholeDeviceOnly {
+		if plugin.MultiMountPolicy != multiMountDuplicate && plugin.MultiMountPolicy != multiMountDedup {
+			return sensu.CheckStateWarning, fmt.Errorf("--whole-device-only cannot be combined with --multi-mount-policy %s", plugin.MultiMountPolicy)
+		}
+		plugin.MultiMountPolicy = multiMountDedup
+	}
+	switch plugin.MultiMountPolicy {
+	case multiMountDuplicate, multiMountPrimary, multiMountDedup:
+	default:
+		return sensu.CheckStateWarning, fmt.Errorf("invalid --multi-mount-policy %q, must be one of duplicate, primary or dedup", plugin.MultiMountPolicy)
+	}
+	if plugin.Concurrency != 0 {
+		fmt.Fprintf(os.Stderr, "Ignoring --concurrency, which is deprecated: the IO counters of all devices are read at once\n")
+	}
+	if plugin.Retries < 0 {
+		return sensu.CheckStateWarning, fmt.Errorf("--retries must not be negative")
+	}
+	retryDelay, err := time.ParseDuration(plugin.RetryDelay)
+	if err != nil || retryDelay <= 0 {
+		return sensu.CheckStateWarning, fmt.Errorf("invalid --retry-delay %q, must be a positive duration", plugin.RetryDelay)
+	}
+	if plugin.Retries > int(maxRetryTime/retryDelay) {
+		return sensu.CheckStateWarning, fmt.Errorf("--retries %d with --retry-delay %s would wait longer than %s per read", plugin.Retries, plugin.RetryDelay, maxRetryTime)
+	}
+	plugin.retryDelay = retryDelay
+	switch plugin.FailState {
+	case failStateWarning:
+		plugin.failState = sensu.CheckStateWarning
+	case failStateCritical:
+		plugin.failState = sensu.CheckStateCritical
+	default:
+		return sensu.CheckStateWarning, fmt.Errorf("invalid --fail-state %q, must be %s or %s", plugin.FailState, failStateWarning, failStateCritical)
+	}
+	if plugin.outputs, err = parseOutputs(plugin.Format, plugin.OutputFile); err != nil {
+		return sensu.CheckStateWarning, err
+	}
+	if len(strings.TrimSpace(plugin.InfluxMeasurement)) == 0 {
+		return sensu.CheckStateWarning, fmt.Errorf("--influx-measurement must not be empty")
+	}
+	switch plugin.InfluxFieldsMode {
+	case output.InfluxMultiField, output.InfluxPerMetric:
+	default:
+		return sensu.CheckStateWarning, fmt.Errorf("invalid --influx-fields-mode %q, must be single-measurement-multi-field or per-metric-measurement", plugin.InfluxFieldsMode)
+	}
+	if _, ok := cloudLookups[plugin.Cloud]; !ok && plugin.Cloud != "auto" {
+		return sensu.CheckStateWarning, fmt.Errorf("invalid --cloud %q, must be one of auto, aws, gcp or azure", plugin.Cloud)
+	}
+	if len(plugin.DeviceSizeMin) > 0 {
+		size, err := thresholds.ParseSize(plugin.DeviceSizeMin)
+		if err != nil {
+			return sensu.CheckStateWarning, fmt.Errorf("invalid --device-size-min: %v", err)
+		}
+		plugin.deviceSizeMin = size
+	}
+	if len(plugin.DeviceSizeMax) > 0 {
+		size, err := thresholds.ParseSize(plugin.DeviceSizeMax)
+		if err != nil {
+			return sensu.CheckStateWarning, fmt.Errorf("invalid --device-size-max: %v", err)
+		}
+		if size < plugin.deviceSizeMin {
+			return sensu.CheckStateWarning, fmt.Errorf("--device-size-max %s is smaller than --device-size-min %s", plugin.DeviceSizeMax, plugin.DeviceSizeMin)
+		}
+		plugin.deviceSizeMax = size
+	}
+	if plugin.SetBaseline && len(plugin.BaselineFile) == 0 {
+		return sensu.CheckStateWarning, fmt.Errorf("--set-baseline requires --baseline-file")
+	}
+	switch plugin.DeviceIdentifier {
+	case identifierKernel, identifierByPath, identifierByID:
+	default:
+		return sensu.CheckStateWarning, fmt.Errorf("invalid --device-identifier %q, must be %s, %s or %s", plugin.DeviceIdentifier, identifierKernel, identifierByPath, identifierByID)
+	}
+	overrides, err := parseTypeOverrides(plugin.TypeOverrides)
+	if err != nil {
+		return sensu.CheckStateWarning, fmt.Errorf("invalid --type-override: %v", err)
+	}
+	plugin.typeOverrides = overrides
+	switch plugin.NamingScheme {
+	case namingLegacy:
+	case namingNodeExporter:
+		if plugin.Rate {
+			return sensu.CheckStateWarning, fmt.Errorf("--naming-scheme %s cannot be combined with --rate, its names are those of counters", namingNodeExporter)
+		}
+		if len(plugin.Namespace) == 0 {
+			plugin.Namespace = "node"
+		}
+	default:
+		return sensu.CheckStateWarning, fmt.Errorf("invalid --naming-scheme %q, must be %s or %s", plugin.NamingScheme, namingLegacy, namingNodeExporter)
+	}
+	if plugin.TimeUnit != timeUnitMs && plugin.TimeUnit != timeUnitS {
+		return sensu.CheckStateWarning, fmt.Errorf("invalid --time-unit %q, must be %s or %s", plugin.TimeUnit, timeUnitMs, timeUnitS)
+	}
+	if _, ok := sizeUnitNames[plugin.SizeUnit]; !ok && plugin.SizeUnit != sizeUnitBytes {
+		return sensu.CheckStateWarning, fmt.Errorf("invalid --size-unit %q, must be %s, %s or %s", plugin.SizeUnit, sizeUnitBytes, sizeUnitKiB, sizeUnitMiB)
+	}
+	if plugin.NamingScheme == namingNodeExporter && (plugin.TimeUnit != timeUnitMs || plugin.SizeUnit != sizeUnitBytes) {
+		return sensu.CheckStateWarning, fmt.Errorf("--naming-scheme %s already uses seconds and bytes, it cannot be combined with --time-unit or --size-unit", namingNodeExporter)
+	}
+	if len(plugin.Namespace) > 0 && !validMetricName(plugin.Namespace+"_disk") {
+		return sensu.CheckStateWarning, fmt.Errorf("invalid --namespace %q, must only contain letters, digits, underscores and colons and not start with a digit", plugin.Namespace)
+	}
+	metrics, err := parseMetricsAllowlist(plugin.Metrics)
+	if err != nil {
+		return sensu.CheckStateWarning, fmt.Errorf("invalid --metrics: %v", err)
+	}
+	plugin.disabledMetrics = nil
+	if plugin.ReadEvent {
+		// The metric annotations add to and take from what --metrics
+		// selects, rather than replacing it.
+		toggles, err := metricToggles(plugin.Keyspace, stdinEvent)
+		if err != nil {
+			return sensu.CheckStateWarning, err
+		}
+		for name, on := range toggles {
+			switch {
+			case !on:
+				if plugin.disabledMetrics == nil {
+					plugin.disabledMetrics = map[string]bool{}
+				}
+				plugin.disabledMetrics[name] = true
+			case len(metrics) > 0:
+				metrics[name] = true
+			}
+		}
+	}
+	plugin.metrics = metrics
+	staticTags, err := parseStaticTags(plugin.StaticTags)
+	if err != nil {
+		return sensu.CheckStateWarning, fmt.Errorf("invalid --tag %v", err)
+	}
+	plugin.staticTags = staticTags
+	switch plugin.MaskMethod {
+	case maskHash, maskPlaceholder:
+	default:
+		return sensu.CheckStateWarning, fmt.Errorf("invalid --mask-method %q, must be %s or %s", plugin.MaskMethod, maskHash, maskPlaceholder)
+	}
+	switch plugin.UnexpectedDevices {
+	case unexpectedDrop, unexpectedWarn:
+	default:
+		return sensu.CheckStateWarning, fmt.Errorf("invalid --unexpected-devices %q, must be %s or %s", plugin.UnexpectedDevices, unexpectedDrop, unexpectedWarn)
+	}
+	if len(plugin.FixedDeviceSet) > 0 {
+		devices, err := loadDeviceSet(plugin.FixedDeviceSet)
+		if err != nil {
+			return sensu.CheckStateWarning, fmt.Errorf("invalid --fixed-device-set: %v", err)
+		}
+		plugin.Devices = append(plugin.Devices, devices...)
+		plugin.EmitZeroForMissing = true
+	}
+	if len(plugin.IncludeDevice) > 0 {
+		re, err := regexp.Compile(plugin.IncludeDevice)
+		if err != nil {
+			return sensu.CheckStateWarning, fmt.Errorf("invalid --include-device %q: %v", plugin.IncludeDevice, err)
+		}
+		plugin.includeDevice = re
+	}
+	if len(plugin.ExcludeDevice) > 0 {
+		re, err := regexp.Compile(plugin.ExcludeDevice)
+		if err != nil {
+			return sensu.CheckStateWarning, fmt.Errorf("invalid --exclude-device %q: %v", plugin.ExcludeDevice, err)
+		}
+		plugin.excludeDevice = re
+	}
+	for _, root := range []struct{ flag, path string }{{"--host-proc", plugin.HostProc}, {"--host-sys", plugin.HostSys}} {
+		if len(root.path) == 0 {
+			continue
+		}
+		if info, err := os.Stat(root.path); err != nil || !info.IsDir() {
+			return sensu.CheckStateWarning, fmt.Errorf("invalid %s %q, must be the directory the host's filesystem is mounted at", root.flag, root.path)
+		}
+	}
+	if plugin.RootOnly && plugin.AllDevices {
+		return sensu.CheckStateWarning, fmt.Errorf("--root-only cannot be combined with --all-devices")
+	}
+	if plugin.RootOnly && len(plugin.Devices) > 0 {
+		return sensu.CheckStateWarning, fmt.Errorf("--root-only cannot be combined with --device or --fixed-device-set")
+	}
+	if plugin.EmitZeroForMissing && len(plugin.Devices) == 0 {
+		return sensu.CheckStateWarning, fmt.Errorf("--emit-zero-for-missing requires --device")
+	}
+	if plugin.OutputBufferSize < 0 {
+		return sensu.CheckStateWarning, fmt.Errorf("--output-buffer-size must not be negative")
+	}
+	if plugin.MaxQueues < 1 {
+		return sensu.CheckStateWarning, fmt.Errorf("invalid --max-queues %d, must be at least 1", plugin.MaxQueues)
+	}
+	if plugin.Rate {
+		d, err := time.ParseDuration(plugin.Interval)
+		if err != nil || d <= 0 {
+			return sensu.CheckStateWarning, fmt.Errorf("invalid --interval %q, must be a positive duration", plugin.Interval)
+		}
+		plugin.interval = d
+	}
+	plugin.subSampleInterval = 0
+	if len(plugin.SubSampleInterval) > 0 {
+		if !plugin.Rate {
+			return sensu.CheckStateWarning, fmt.Errorf("--sub-sample-interval requires --rate")
+		}
+		d, err := time.ParseDuration(plugin.SubSampleInterval)
+		if err != nil || d < 10*time.Millisecond || d >= plugin.interval {
+			return sensu.CheckStateWarning, fmt.Errorf("invalid --sub-sample-interval %q, must be a duration of at least 10ms and shorter than --interval %s", plugin.SubSampleInterval, plugin.Interval)
+		}
+		plugin.subSampleInterval = d
+	}
+	plugin.timeout = 0
+	if len(plugin.Timeout) > 0 {
+		d, err := time.ParseDuration(plugin.Timeout)
+		if err != nil || d <= 0 {
+			return sensu.CheckStateWarning, fmt.Errorf("invalid --timeout %q, must be a positive duration", plugin.Timeout)
+		}
+		if plugin.Rate && d <= plugin.interval {
+			return sensu.CheckStateWarning, fmt.Errorf("--timeout %s must be longer than the --interval %s it includes", plugin.Timeout, plugin.Interval)
+		}
+		plugin.timeout = d
+	}
+	if len(plugin.RateWindow) > 0 {
+		d, err := time.ParseDuration(plugin.RateWindow)
+		if err != nil || d < time.Second {
+			return sensu.CheckStateWarning, fmt.Errorf("invalid --rate-window %q, must be a duration of at least 1s", plugin.RateWindow)
+		}
+		plugin.rateWindow = d
+	}
+	if plugin.IopsWarning < 0 || plugin.IopsCritical < 0 {
+		return sensu.CheckStateWarning, fmt.Errorf("--iops-warning and --iops-critical must not be negative")
+	}
+	if plugin.IopsWarning > 0 && plugin.IopsCritical > 0 && plugin.IopsWarning > plugin.IopsCritical {
+		return sensu.CheckStateWarning, fmt.Errorf("--iops-warning %d is above --iops-critical %d", plugin.IopsWarning, plugin.IopsCritical)
+	}
+	t := &plugin.rateThresholds
+	for _, pair := range []struct {
+		warnFlag, warnValue string
+		critFlag, critValue string
+		warn, crit          *thresholds.Rules
+		parse               func(string) (float64, error)
+	}{
+		{"warn-read-bps", plugin.WarnReadBps, "crit-read-bps", plugin.CritReadBps, &t.ReadBpsWarn, &t.ReadBpsCrit, thresholds.SizeLimit},
+		{"warn-write-bps", plugin.WarnWriteBps, "crit-write-bps", plugin.CritWriteBps, &t.WriteBpsWarn, &t.WriteBpsCrit, thresholds.SizeLimit},
+		{"warn-read-iops", plugin.WarnReadIops, "crit-read-iops", plugin.CritReadIops, &t.ReadIopsWarn, &t.ReadIopsCrit, thresholds.CountLimit},
+		{"warn-write-iops", plugin.WarnWriteIops, "crit-write-iops", plugin.CritWriteIops, &t.WriteIopsWarn, &t.WriteIopsCrit, thresholds.CountLimit},
+		{"warn-read-await-ms", plugin.WarnReadAwaitMs, "crit-read-await-ms", plugin.CritReadAwaitMs, &t.ReadAwaitWarn, &t.ReadAwaitCrit, thresholds.ParseLimit},
+		{"warn-write-await-ms", plugin.WarnWriteAwaitMs, "crit-write-await-ms", plugin.CritWriteAwaitMs, &t.WriteAwaitWarn, &t.WriteAwaitCrit, thresholds.ParseLimit},
+		{"warn-queue-depth", plugin.WarnQueueDepth, "crit-queue-depth", plugin.CritQueueDepth, &t.QueueDepthWarn, &t.QueueDepthCrit, thresholds.ParseLimit},
+	} {
+		var err error
+		if *pair.warn, err = thresholds.ParseRules(pair.warnFlag, pair.warnValue, pair.parse); err != nil {
+			return sensu.CheckStateWarning, fmt.Errorf("invalid --%s %v", pair.warnFlag, err)
+		}
+		if *pair.crit, err = thresholds.ParseRules(pair.critFlag, pair.critValue, pair.parse); err != nil {
+			return sensu.CheckStateWarning, fmt.Errorf("invalid --%s %v", pair.critFlag, err)
+		}
+		if err := thresholds.CheckRuleOrder(*pair.warn, *pair.crit); err != nil {
+			return sensu.CheckStateWarning, err
+		}
+	}
+	plugin.deviceThresholds = map[string]thresholds.ByteRateLimits{}
+	for _, entry := range joinThresholdEntries(plugin.DeviceThresholds) {
+		device, limits, err := parseDeviceThreshold(entry)
 		if err != nil {
-			fmt.Printf("Failed to get IO counters, error: %v", err)
+			return sensu.CheckStateWarning, fmt.Errorf("invalid --device-threshold %v", err)
 		}
-		for _, v := range diskio {
-			tags := map[string]string{"device": v.Name, "mountpoint": p.Mountpoint}
-			metricGroups["disk_read_bytes"].AddMetric(tags, float64(v.ReadBytes))
-			metricGroups["disk_write_bytes"].AddMetric(tags, float64(v.WriteBytes))
-			metricGroups["disk_read_count"].AddMetric(tags, float64(v.ReadCount))
-			metricGroups["disk_write_count"].AddMetric(tags, float64(v.WriteCount))
-			metricGroups["disk_read_time"].AddMetric(tags, float64(v.ReadTime))
-			metricGroups["disk_write_time"].AddMetric(tags, float64(v.WriteTime))
-			metricGroups["disk_io_time"].AddMetric(tags, float64(v.IoTime))
-			metricGroups["disk_weighted_io"].AddMetric(tags, float64(v.WeightedIO))
-			metricGroups["disk_iops_in_progress"].AddMetric(tags, float64(v.IopsInProgress))
-			metricGroups["disk_merged_read_count"].AddMetric(tags, float64(v.MergedReadCount))
-			metricGroups["disk_merged_write_count"].AddMetric(tags, float64(v.MergedWriteCount))
+		if _, dup := plugin.deviceThresholds[device]; dup {
+			return sensu.CheckStateWarning, fmt.Errorf("invalid --device-threshold %q, %s already has limits", entry, device)
 		}
+		plugin.deviceThresholds[device] = limits
 	}
+	retention, err := time.ParseDuration(plugin.AbsentRetention)
+	if err != nil || retention < 0 {
+		return sensu.CheckStateWarning, fmt.Errorf("invalid --absent-retention %q, must be a non-negative duration", plugin.AbsentRetention)
+	}
+	plugin.absentRetention = retention
+	if plugin.SummaryTop < 0 {
+		return sensu.CheckStateWarning, fmt.Errorf("--summary-top must not be negative")
+	}
+	if plugin.SuggestThresholds && plugin.ThroughputHistory < suggestMinSamples {
+		return sensu.CheckStateWarning, fmt.Errorf("--throughput-history must be at least %d", suggestMinSamples)
+	}
+	if plugin.LatencySLOMs < 0 {
+		return sensu.CheckStateWarning, fmt.Errorf("--latency-slo-ms must not be negative")
+	}
+	if useState() && len(plugin.StateFile) == 0 {
+		return sensu.CheckStateWarning, fmt.Errorf("--state-file must not be empty")
+	}
+	if plugin.DetectStuck && plugin.StuckThreshold < 1 {
+		return sensu.CheckStateWarning, fmt.Errorf("--stuck-threshold must be at least 1")
+	}
+	if plugin.WithLatencyPercentiles {
+		if plugin.LatencyWindow < 1 {
+			return sensu.CheckStateWarning, fmt.Errorf("--latency-window must be at least 1")
+		}
+	}
+	if plugin.AnomalyFactor < 0 || plugin.AnomalyFactor > 0 && plugin.AnomalyFactor <= 1 {
+		return sensu.CheckStateWarning, fmt.Errorf("invalid --anomaly-factor %s, must be above 1 or 0 to disable", thresholds.FormatLimit(plugin.AnomalyFactor))
+	}
+	if plugin.AnomalyFactor > 0 && plugin.AnomalyWindow < anomalyMinSamples {
+		return sensu.CheckStateWarning, fmt.Errorf("--anomaly-window must be at least %d", anomalyMinSamples)
+	}
+	if len(plugin.FIFO) > 0 && stdoutSink(plugin.outputs) == nil {
+		return sensu.CheckStateWarning, fmt.Errorf("--fifo needs a --format without an --output-file")
+	}
+	if len(plugin.FIFO) > 0 {
+		d, err := time.ParseDuration(plugin.FIFOTimeout)
+		if err != nil {
+			return sensu.CheckStateWarning, fmt.Errorf("invalid --fifo-timeout %q: %v", plugin.FIFOTimeout, err)
+		}
+		plugin.fifoTimeout = d
+	}
+	if plugin.StatsDOnly && len(plugin.StatsDAddr) == 0 {
+		return sensu.CheckStateWarning, fmt.Errorf("--statsd-only requires --statsd-addr")
+	}
+	if plugin.Daemon {
+		if len(plugin.outputs) > 1 || plugin.outputs[0].Format != formatPrometheus {
+			return sensu.CheckStateWarning, fmt.Errorf("--daemon only serves --format prometheus")
+		}
+		if len(plugin.OutputFile) > 0 || len(plugin.FIFO) > 0 {
+			return sensu.CheckStateWarning, fmt.Errorf("--daemon cannot be combined with --output-file or --fifo")
+		}
+		d, err := time.ParseDuration(plugin.DaemonInterval)
+		if err != nil || d <= 0 {
+			return sensu.CheckStateWarning, fmt.Errorf("invalid --daemon-interval %q, must be a positive duration", plugin.DaemonInterval)
+		}
+		plugin.daemonInterval = d
+	}
+	return sensu.CheckStateOK, nil
+}
 
-	for _, v := range metricGroups {
-		v.Output()
+// nameMatches reports whether a device passes --include-device and
+// --exclude-device. A nil pattern does not filter anything.
+func nameMatches(name string, include, exclude *regexp.Regexp) bool {
+	if include != nil && !include.MatchString(name) {
+		return false
 	}
+	return exclude == nil || !exclude.MatchString(name)
+}
 
-	return sensu.CheckStateOK, nil
+// idle reports whether a device has neither read nor written anything, as
+// with a drive that has not been touched since boot.
+func idle(v disk.IOCountersStat) bool {
+	return v.ReadBytes == 0 && v.WriteBytes == 0 && v.ReadCount == 0 && v.WriteCount == 0
+}
+
+// parseSuspectMinIOs is the number of completed IOs after which time counters
+// that are still zero can no longer be explained by millisecond rounding.
+const parseSuspectMinIOs = 1000
+
+// parseSuspect reports whether the counters look like a /proc/diskstats line
+// that was not parsed correctly. A device that completed many IOs must have
+// spent some time doing so, so large counts with every time field at zero
+// point at columns being read from the wrong position.
+func parseSuspect(v disk.IOCountersStat) bool {
+	if v.ReadCount+v.WriteCount < parseSuspectMinIOs {
+		return false
+	}
+	return v.ReadTime == 0 && v.WriteTime == 0 && v.IoTime == 0 && v.WeightedIO == 0
+}
+
+// mergeRatio returns the share of requests that were merged into another
+// one before reaching the device: merged / (completed + merged). It is 0
+// while no request was seen at all.
+func mergeRatio(merged, completed uint64) float64 {
+	if merged+completed == 0 {
+		return 0
+	}
+	return float64(merged) / float64(merged+completed)
+}
+
+// cloudTags holds the instance metadata tags looked up once per run by
+// --with-cloud-tags.
+var cloudTags map[string]string
+
+// mountFstypes maps every mountpoint to its filesystem type, for
+// --with-fstype.
+var mountFstypes map[string]string
+
+// resolveDevice turns a --device value into the kernel device name used by
+// the IO counters. Stable udev paths such as /dev/disk/by-id/wwn-... are
+// symlinks to the kernel device node and are resolved first; if that fails
+// the last path element is used as given.
+func resolveDevice(device string) string {
+	if strings.Contains(device, "/") {
+		if resolved, err := filepath.EvalSymlinks(device); err == nil {
+			device = resolved
+		}
+	}
+	return filepath.Base(device)
+}
+
+// deviceTags builds the tags attached to every metric of a device.
+func deviceTags(device, mountpoint string) map[string]string {
+	tags := map[string]string{"device": deviceIdentifier(device), "mountpoint": mountpoint}
+	for k, v := range cloudTags {
+		tags[k] = v
+	}
+	if plugin.WithFstype {
+		tags["fstype"] = mountFstypes[mountpoint]
+	}
+	if array, ok := mdMemberArrays[device]; ok && plugin.WithMdArrays {
+		tags["array"] = array
+	}
+	if plugin.WithLVMTags {
+		if vg, lv, ok := lvmNames(device); ok {
+			tags["vg_name"] = vg
+			tags["lv_name"] = lv
+		}
+	}
+	if plugin.WithCacheRole {
+		tags["cache_role"] = cacheRole(device)
+		enrichments.record("cache_role", pathExists(hostSys("class", "block", device)))
+	}
+	if plugin.DeviceMetadata {
+		lookupDeviceMetadata(device).tags(tags)
+	}
+	return tags
+}
+
+// countSamples returns the number of samples across all groups.
+func countSamples(groups map[string]*MetricGroup) int {
+	n := 0
+	for _, g := range groups {
+		n += len(g.Metrics)
+	}
+	return n
+}
+
+// totalGroups are the groups --totals sums across devices.
+var totalGroups = []string{
+	"disk_read_bytes",
+	"disk_write_bytes",
+	"disk_read_count",
+	"disk_write_count",
+	"disk_read_time",
+	"disk_write_time",
+}
+
+// totalDevice is the device tag of the --totals samples.
+const totalDevice = "all"
+
+// addTotals adds a sample tagged device="all" to each of the totalGroups,
+// holding the sum of the group's samples with one sample counted per
+// device, so a device reported at several mountpoints is not counted twice.
+func addTotals(groups map[string]*MetricGroup) {
+	for _, name := range totalGroups {
+		g, ok := groups[name]
+		if !ok || len(g.Metrics) == 0 {
+			continue
+		}
+		counted := map[string]bool{}
+		var sum uint64
+		var fsum float64
+		exact := true
+		for _, m := range g.Metrics {
+			device := m.Tags["device"]
+			if counted[device] {
+				continue
+			}
+			counted[device] = true
+			if m.IsInt {
+				sum += m.IntValue
+			} else {
+				fsum += m.Value
+				exact = false
+			}
+		}
+		tags := map[string]string{"device": totalDevice}
+		if exact {
+			g.AddIntMetric(tags, sum)
+		} else {
+			g.AddMetric(tags, fsum+float64(sum))
+		}
+	}
+}
+
+// sortedKeys returns the keys of m in sorted order.
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// useState reports whether any enabled feature needs the state file. With
+// --rate the thresholds and --with-iostat compare the two samples instead.
+func useState() bool {
+	if !plugin.Rate && (len(plugin.DeviceThresholds) > 0 || !plugin.rateThresholds.Empty() || plugin.WithIostat) {
+		return true
+	}
+	return plugin.WithLatencyPercentiles || plugin.DetectStuck || len(plugin.RateWindow) > 0 || plugin.WithIowait || plugin.SuggestThresholds || plugin.LatencySLOMs > 0 ||
+		plugin.EmitDelta || plugin.EmitRate || plugin.AnomalyFactor > 0
+}
+
+// newCollector returns the collector of the current platform, replaceable
+// in tests.
+var newCollector = collector.New
+
+func executeCheck(event *types.Event) (int, error) {
+	if plugin.ListMetrics {
+		for _, name := range platformGroups() {
+			fmt.Println(name)
+		}
+		return sensu.CheckStateOK, nil
+	}
+	if plugin.Daemon && daemonState == nil {
+		return runDaemon(event)
+	}
+	check := &diskCheck{start: time.Now()}
+	groups, err := check.Collect()
+	if err != nil {
+		return sensu.CheckStateWarning, err
+	}
+	status := check.evaluate()
+	metricGroups, success := check.finish(groups)
+	if err := check.write(metricGroups, success); err != nil {
+		return sensu.CheckStateWarning, err
+	}
+	return check.result(status)
 }
@@ -1,8 +1,437 @@
 package main
 
 import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/jadiunr/check-disk-io/collector"
+	"github.com/sensu/sensu-go/types"
+	"github.com/sensu/sensu-plugin-sdk/sensu"
+	"github.com/shirou/gopsutil/v3/disk"
 )
 
 func TestMain(t *testing.T) {
 }
+
+// useDefaults sets the plugin config to the option defaults, as the plugin
+// SDK does before it parses the flags, and restores it when the test ends.
+func useDefaults(t *testing.T) {
+	t.Helper()
+	saved, savedFlags, savedEvent := plugin, flagConfig, stdinEvent
+	t.Cleanup(func() { plugin, flagConfig, stdinEvent = saved, savedFlags, savedEvent })
+	plugin = Config{PluginConfig: saved.PluginConfig}
+	flagConfig, stdinEvent = nil, nil
+	for _, opt := range options {
+		if opt.Default == nil {
+			continue
+		}
+		v := reflect.ValueOf(opt.Value).Elem()
+		v.Set(reflect.ValueOf(opt.Default).Convert(v.Type()))
+	}
+}
+
+func TestParseSuspect(t *testing.T) {
+	tests := []struct {
+		name string
+		in   disk.IOCountersStat
+		want bool
+	}{
+		{"idle", disk.IOCountersStat{}, false},
+		{"healthy", disk.IOCountersStat{ReadCount: 10, ReadTime: 4, IoTime: 3, WeightedIO: 4}, false},
+		{"few fast IOs", disk.IOCountersStat{ReadCount: 6, ReadBytes: 4096}, false},
+		{"zeroed times", disk.IOCountersStat{ReadCount: 1000, WriteCount: 5, ReadBytes: 4096}, true},
+	}
+	for _, tt := range tests {
+		if got := parseSuspect(tt.in); got != tt.want {
+			t.Errorf("%s: parseSuspect() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestIdle(t *testing.T) {
+	if !idle(disk.IOCountersStat{Name: "sdb", IoTime: 3}) {
+		t.Errorf("a device without reads or writes should be idle")
+	}
+	if idle(disk.IOCountersStat{Name: "sda", ReadCount: 1, ReadBytes: 4096}) {
+		t.Errorf("a device that read something should not be idle")
+	}
+}
+
+func TestAddTotals(t *testing.T) {
+	groups := map[string]*MetricGroup{
+		"disk_read_bytes":  {Name: "disk_read_bytes"},
+		"disk_write_bytes": {Name: "disk_write_bytes"},
+		"disk_io_time":     {Name: "disk_io_time"},
+	}
+	groups["disk_read_bytes"].AddIntMetric(map[string]string{"device": "sda", "mountpoint": "/"}, 100)
+	groups["disk_read_bytes"].AddIntMetric(map[string]string{"device": "sda", "mountpoint": "/home"}, 100)
+	groups["disk_read_bytes"].AddIntMetric(map[string]string{"device": "sdb", "mountpoint": "/data"}, 50)
+	groups["disk_write_bytes"].AddMetric(map[string]string{"device": "sda"}, 1.5)
+	groups["disk_write_bytes"].AddMetric(map[string]string{"device": "sdb"}, 2)
+	groups["disk_io_time"].AddIntMetric(map[string]string{"device": "sda"}, 10)
+	addTotals(groups)
+
+	read := groups["disk_read_bytes"].Metrics
+	if total := read[len(read)-1]; total.Tags["device"] != "all" || !total.IsInt || total.IntValue != 150 {
+		t.Errorf("read bytes total = %+v, want 150 counting sda once", total)
+	}
+	write := groups["disk_write_bytes"].Metrics
+	if total := write[len(write)-1]; total.Tags["device"] != "all" || total.Value != 3.5 {
+		t.Errorf("write bytes total = %+v, want 3.5", total)
+	}
+	if n := len(groups["disk_io_time"].Metrics); n != 1 {
+		t.Errorf("disk_io_time got a total")
+	}
+}
+
+func TestResolveDevice(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "sdc"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "by-id"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "by-id", "wwn-0x5000c500a1b2c3d4")
+	if err := os.Symlink("../sdc", link); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		link:                          "sdc",
+		"sda":                         "sda",
+		"/dev/nvme0n1":                "nvme0n1",
+		filepath.Join(dir, "missing"): "missing",
+	}
+	for in, want := range tests {
+		if got := resolveDevice(in); got != want {
+			t.Errorf("resolveDevice(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestMergeRatio(t *testing.T) {
+	if got := mergeRatio(25, 75); got != 0.25 {
+		t.Errorf("mergeRatio(25, 75) = %v, want 0.25", got)
+	}
+	if got := mergeRatio(0, 0); got != 0 {
+		t.Errorf("mergeRatio(0, 0) = %v, want 0", got)
+	}
+}
+
+func TestNameMatches(t *testing.T) {
+	include := regexp.MustCompile(`^(sd|nvme)`)
+	exclude := regexp.MustCompile(`^nvme1`)
+	tests := map[string]bool{
+		"sda":     true,
+		"nvme0n1": true,
+		"nvme1n1": false,
+		"loop0":   false,
+	}
+	for name, want := range tests {
+		if got := nameMatches(name, include, exclude); got != want {
+			t.Errorf("nameMatches(%q) = %v, want %v", name, got, want)
+		}
+	}
+	if !nameMatches("loop0", nil, nil) {
+		t.Errorf("nameMatches without patterns should not filter")
+	}
+}
+
+// sequenceCollector serves its counter samples in turn, repeating the last
+// one, failing the reads of nil samples, and fails the lookups of the
+// devices in fail. A read of every device
+// returns the others with a collector.DeviceErrors, like the Windows
+// collector.
+type sequenceCollector struct {
+	collector.Static
+	samples []map[string]disk.IOCountersStat
+	calls   *int
+	fail    map[string]bool
+}
+
+func (c sequenceCollector) IOCounters(names ...string) (map[string]disk.IOCountersStat, error) {
+	i := *c.calls
+	if i >= len(c.samples) {
+		i = len(c.samples) - 1
+	}
+	*c.calls++
+	if c.samples[i] == nil {
+		return nil, errors.New("resource temporarily unavailable")
+	}
+	c.Static.Counters = c.samples[i]
+	if len(names) == 0 && len(c.fail) > 0 {
+		stats := map[string]disk.IOCountersStat{}
+		failed := collector.DeviceErrors{}
+		for name, v := range c.Static.Counters {
+			if c.fail[name] {
+				failed[name] = errors.New("no such device")
+				continue
+			}
+			stats[name] = v
+		}
+		return stats, failed
+	}
+	for _, name := range names {
+		if c.fail[c.DeviceName(name)] {
+			return nil, errors.New("no such device")
+		}
+	}
+	return c.Static.IOCounters(names...)
+}
+
+// runCheck runs executeCheck against c with the plugin config as the test
+// set it, and returns the state, the metrics written and the error.
+func runCheck(t *testing.T, c collector.Collector) (int, string, error) {
+	t.Helper()
+	saved, savedOut := newCollector, stdout
+	defer func() { newCollector, stdout = saved, savedOut }()
+	newCollector = func() collector.Collector { return c }
+	var buf bytes.Buffer
+	stdout = &buf
+	if _, err := checkArgs(nil); err != nil {
+		t.Fatal(err)
+	}
+	state, err := executeCheck(nil)
+	return state, buf.String(), err
+}
+
+// sampleValue returns the value of the sample of metric for device in the
+// prometheus output out, and whether there is one.
+func sampleValue(out, metric, device string) (string, bool) {
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, metric+"{") && strings.Contains(line, `device="`+device+`"`) {
+			fields := strings.Fields(line)
+			return fields[len(fields)-1], true
+		}
+	}
+	return "", false
+}
+
+func TestExecuteCheckPartialFailure(t *testing.T) {
+	useDefaults(t)
+	plugin.Devices = []string{"sda", "sdb"}
+	plugin.NoTimestamp, plugin.NoHostname = true, true
+	calls := 0
+	c := sequenceCollector{
+		samples: []map[string]disk.IOCountersStat{{"sda": {Name: "sda", ReadBytes: 4096}, "sdb": {Name: "sdb"}}},
+		calls:   &calls,
+		fail:    map[string]bool{"sdb": true},
+	}
+	state, out, err := runCheck(t, c)
+	if state != sensu.CheckStateWarning || err == nil || !strings.Contains(err.Error(), "1 of 2 devices: sdb") {
+		t.Errorf("executeCheck() = %d, %v after one of two lookups failed, want WARNING naming sdb", state, err)
+	}
+	if v, ok := sampleValue(out, "disk_read_bytes", "sda"); !ok || v != "4096" {
+		t.Errorf("disk_read_bytes of sda = %q, %v, want 4096", v, ok)
+	}
+	for _, want := range []string{"disk_io_collect_errors 1", "disk_io_scrape_success 0"} {
+		if !strings.Contains(out, "\n"+want+"\n") {
+			t.Errorf("output lacks %s:\n%s", want, out)
+		}
+	}
+}
+
+func TestExecuteCheckPartialSweep(t *testing.T) {
+	useDefaults(t)
+	plugin.NoTimestamp, plugin.NoHostname = true, true
+	calls := 0
+	c := sequenceCollector{
+		Static: collector.Static{Parts: []disk.PartitionStat{
+			{Device: "/dev/sda1", Mountpoint: "/", Fstype: "ext4"},
+			{Device: "/dev/sdb1", Mountpoint: "/data", Fstype: "ext4"},
+		}},
+		samples: []map[string]disk.IOCountersStat{{"sda1": {Name: "sda1", ReadBytes: 4096}, "sdb1": {Name: "sdb1"}}},
+		calls:   &calls,
+		fail:    map[string]bool{"sdb1": true},
+	}
+	state, out, err := runCheck(t, c)
+	if state != sensu.CheckStateWarning || err == nil || !strings.Contains(err.Error(), "1 of 2 devices: sdb1: no such device") {
+		t.Errorf("executeCheck() = %d, %v after the sweep failed on one of two devices, want WARNING naming sdb1", state, err)
+	}
+	if v, ok := sampleValue(out, "disk_read_bytes", "sda1"); !ok || v != "4096" {
+		t.Errorf("disk_read_bytes of sda1 = %q, %v, want 4096", v, ok)
+	}
+	if !strings.Contains(out, "\ndisk_io_collect_errors 1\n") {
+		t.Errorf("output lacks disk_io_collect_errors 1:\n%s", out)
+	}
+}
+
+func TestExecuteCheckRate(t *testing.T) {
+	useDefaults(t)
+	plugin.Rate = true
+	plugin.Interval = "10ms"
+	plugin.NoTimestamp = true
+	calls := 0
+	c := sequenceCollector{
+		Static: collector.Static{Parts: []disk.PartitionStat{{Device: "/dev/sda1", Mountpoint: "/", Fstype: "ext4"}}},
+		samples: []map[string]disk.IOCountersStat{
+			{"sda1": {Name: "sda1", ReadBytes: 1000, WriteCount: 10}},
+			{"sda1": {Name: "sda1", ReadBytes: 3000, WriteCount: 15}},
+		},
+		calls: &calls,
+	}
+	state, out, err := runCheck(t, c)
+	if state != sensu.CheckStateOK || err != nil {
+		t.Errorf("executeCheck() = %d, %v, want OK", state, err)
+	}
+	// 2000 bytes and 5 writes in 10ms.
+	for metric, want := range map[string]string{"disk_read_bytes": "200000", "disk_write_count": "500"} {
+		if v, ok := sampleValue(out, metric, "sda1"); !ok || v != want {
+			t.Errorf("%s of sda1 = %q, %v, want %s", metric, v, ok, want)
+		}
+	}
+	if !strings.Contains(out, "# TYPE disk_read_bytes gauge") {
+		t.Errorf("disk_read_bytes is not a gauge with --rate:\n%s", out)
+	}
+}
+
+func TestExecuteCheckRateFirstSampleFailed(t *testing.T) {
+	useDefaults(t)
+	plugin.Rate = true
+	plugin.Interval = "10ms"
+	plugin.NoTimestamp, plugin.NoHostname = true, true
+	calls := 0
+	c := sequenceCollector{
+		Static: collector.Static{Parts: []disk.PartitionStat{
+			{Device: "/dev/sda1", Mountpoint: "/", Fstype: "ext4"},
+			{Device: "/dev/sdb1", Mountpoint: "/data", Fstype: "ext4"},
+		}},
+		samples: []map[string]disk.IOCountersStat{nil, {"sda1": {Name: "sda1"}, "sdb1": {Name: "sdb1"}}},
+		calls:   &calls,
+	}
+	state, out, err := runCheck(t, c)
+	if state != sensu.CheckStateCritical || err == nil || !strings.Contains(err.Error(), "first --rate sample") {
+		t.Errorf("executeCheck() = %d, %v after the first sample failed, want the --fail-state CRITICAL", state, err)
+	}
+	if !strings.Contains(out, "\ndisk_io_collect_errors 1\n") {
+		t.Errorf("output lacks disk_io_collect_errors 1:\n%s", out)
+	}
+}
+
+func TestExecuteCheckCounterReset(t *testing.T) {
+	useDefaults(t)
+	plugin.StateFile = filepath.Join(t.TempDir(), "state.json")
+	plugin.EmitDelta = true
+	plugin.NoTimestamp = true
+	parts := []disk.PartitionStat{{Device: "/dev/sda1", Mountpoint: "/", Fstype: "ext4"}}
+	run := func(readBytes uint64) string {
+		t.Helper()
+		// The state is keyed by the time of the run in milliseconds.
+		time.Sleep(2 * time.Millisecond)
+		calls := 0
+		c := sequenceCollector{
+			Static:  collector.Static{Parts: parts},
+			samples: []map[string]disk.IOCountersStat{{"sda1": {Name: "sda1", ReadBytes: readBytes}}},
+			calls:   &calls,
+		}
+		_, out, err := runCheck(t, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	run(10000)
+	if v, _ := sampleValue(run(15000), "disk_read_bytes_delta", "sda1"); v != "5000" {
+		t.Errorf("delta after 5000 bytes = %q, want 5000", v)
+	}
+	// The counters went backwards: the device starts over from this sample.
+	out := run(2000)
+	if v, _ := sampleValue(out, "disk_read_bytes_delta", "sda1"); v != "0" {
+		t.Errorf("delta after a reset = %q, want 0", v)
+	}
+	if v, _ := sampleValue(out, "disk_io_counter_resets_total", "sda1"); v != "1" {
+		t.Errorf("disk_io_counter_resets_total after a reset = %q, want 1", v)
+	}
+	out = run(2500)
+	if v, _ := sampleValue(out, "disk_read_bytes_delta", "sda1"); v != "500" {
+		t.Errorf("delta after the re-baseline = %q, want 500", v)
+	}
+	if v, _ := sampleValue(out, "disk_io_counter_resets_total", "sda1"); v != "1" {
+		t.Errorf("disk_io_counter_resets_total after the re-baseline = %q, want 1", v)
+	}
+}
+
+func TestExecuteCheckScrapeSuccessLast(t *testing.T) {
+	// Every format but labels, which lists tag values rather than samples.
+	for format, want := range map[string]string{
+		formatPrometheus: "disk_io_scrape_success 1",
+		formatJSON:       `{"name":"disk_io_scrape_success","type":"GAUGE","tags":{},"value":1}`,
+		formatGraphite:   "disk.io_scrape_success 1 ",
+		formatInfluxDB:   "disk_io io_scrape_success=1i",
+		formatEnv:        "DISK_IO_SCRAPE_SUCCESS=1",
+		formatDocument:   `{"tags":{},"metrics":{"disk_io_scrape_success":1}}]}`,
+	} {
+		useDefaults(t)
+		plugin.Format = format
+		plugin.NoTimestamp, plugin.NoHostname = true, true
+		calls := 0
+		c := sequenceCollector{
+			Static:  collector.Static{Parts: []disk.PartitionStat{{Device: "/dev/sda1", Mountpoint: "/", Fstype: "ext4"}}},
+			samples: []map[string]disk.IOCountersStat{{"sda1": {Name: "sda1", ReadBytes: 4096}}},
+			calls:   &calls,
+		}
+		_, out, err := runCheck(t, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSpace(out), "\n")
+		if last := lines[len(lines)-1]; !strings.Contains(last, want) {
+			t.Errorf("--format %s ends with %q, want the scrape success %q", format, last, want)
+		}
+	}
+}
+
+func TestExecuteCheckMetricAnnotations(t *testing.T) {
+	useDefaults(t)
+	plugin.ReadEvent = true
+	plugin.Metrics = []string{"disk_read_bytes", "disk_write_bytes"}
+	plugin.NoTimestamp, plugin.NoHostname = true, true
+	stdinEvent = &types.Event{
+		Check: &types.Check{ObjectMeta: types.ObjectMeta{Annotations: map[string]string{
+			"sensu.io/plugins/check-disk-io/config/metrics/disk_write_bytes": "false",
+		}}},
+		Entity: &types.Entity{ObjectMeta: types.ObjectMeta{Annotations: map[string]string{
+			"sensu.io/plugins/check-disk-io/config/metrics/disk_io_time":     "true",
+			"sensu.io/plugins/check-disk-io/config/metrics/disk_write_bytes": "true",
+		}}},
+	}
+	calls := 0
+	c := sequenceCollector{
+		Static:  collector.Static{Parts: []disk.PartitionStat{{Device: "/dev/sda1", Mountpoint: "/", Fstype: "ext4"}}},
+		samples: []map[string]disk.IOCountersStat{{"sda1": {Name: "sda1", ReadBytes: 4096, WriteBytes: 512, IoTime: 7}}},
+		calls:   &calls,
+	}
+	_, out, err := runCheck(t, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// --metrics selects read and write bytes, the entity adds the IO time
+	// and the check takes the write bytes away again.
+	for metric, want := range map[string]bool{"disk_read_bytes": true, "disk_io_time": true, "disk_write_bytes": false, "disk_read_count": false} {
+		if _, ok := sampleValue(out, metric, "sda1"); ok != want {
+			t.Errorf("%s emitted = %v, want %v", metric, ok, want)
+		}
+	}
+
+	// Without --metrics every group is emitted but the disabled ones.
+	plugin.Metrics = nil
+	_, out, err = runCheck(t, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for metric, want := range map[string]bool{"disk_read_count": true, "disk_write_bytes": false} {
+		if _, ok := sampleValue(out, metric, "sda1"); ok != want {
+			t.Errorf("without --metrics %s emitted = %v, want %v", metric, ok, want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/jadiunr/check-disk-io/thresholds"
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// mdMemberArrays maps the member devices of the md arrays to their array,
+// read once per run for --with-md-arrays and --md-rollup.
+var mdMemberArrays map[string]string
+
+// mdMembers reads /proc/mdstat and maps every active member device of an md
+// array, such as sda1, to the array, such as md0. Spares (S) and failed
+// members (F) are left out, since they take no part in the array's IO.
+func mdMembers() (map[string]string, error) {
+	data, err := ioutil.ReadFile(hostProc("mdstat"))
+	if err != nil {
+		return nil, err
+	}
+	members := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		// md0 : active raid1 sdb1[1] sda1[0]
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[1] != ":" || !strings.HasPrefix(fields[0], "md") {
+			continue
+		}
+		for _, f := range fields[2:] {
+			i := strings.IndexByte(f, '[')
+			if i <= 0 || strings.HasSuffix(f, "(S)") || strings.HasSuffix(f, "(F)") {
+				continue
+			}
+			members[f[:i]] = fields[0]
+		}
+	}
+	return members, scanner.Err()
+}
+
+// mdWaitRange is the lowest and highest average read and write wait of the
+// members of one array.
+type mdWaitRange struct {
+	ReadMin, ReadMax   float64
+	WriteMin, WriteMax float64
+	reads, writes      int
+}
+
+// add includes the wait of one member in the range.
+func (r *mdWaitRange) add(read, write float64, readOK, writeOK bool) {
+	if readOK {
+		if r.reads == 0 || read < r.ReadMin {
+			r.ReadMin = read
+		}
+		if r.reads == 0 || read > r.ReadMax {
+			r.ReadMax = read
+		}
+		r.reads++
+	}
+	if writeOK {
+		if r.writes == 0 || write < r.WriteMin {
+			r.WriteMin = write
+		}
+		if r.writes == 0 || write > r.WriteMax {
+			r.WriteMax = write
+		}
+		r.writes++
+	}
+}
+
+// mdWaitRanges returns the range of the average wait per IO of the members
+// of every array in members, from the counters in cur. With a previous
+// sample the wait is that of the IOs completed since, and a member without
+// completed IOs is left out; without one it is the wait since boot.
+func mdWaitRanges(members map[string]string, cur, prev map[string]disk.IOCountersStat) map[string]*mdWaitRange {
+	ranges := map[string]*mdWaitRange{}
+	names := make([]string, 0, len(members))
+	for name := range members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		v, ok := cur[name]
+		if !ok {
+			continue
+		}
+		array := members[name]
+		if ranges[array] == nil {
+			ranges[array] = &mdWaitRange{}
+		}
+		if prev == nil {
+			ranges[array].add(averageWait(v.ReadTime, v.ReadCount), averageWait(v.WriteTime, v.WriteCount), v.ReadCount > 0, v.WriteCount > 0)
+			continue
+		}
+		p, ok := prev[name]
+		if !ok {
+			continue
+		}
+		read, readOK := thresholds.AverageLatency(p.ReadTime, v.ReadTime, p.ReadCount, v.ReadCount)
+		write, writeOK := thresholds.AverageLatency(p.WriteTime, v.WriteTime, p.WriteCount, v.WriteCount)
+		ranges[array].add(read, write, readOK, writeOK)
+	}
+	return ranges
+}
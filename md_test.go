@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+func TestMdMembers(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("HOST_PROC", root)
+	writeSysFile(t, root, "mdstat", `Personalities : [raid1] [raid6] [raid5] [raid4]
+md1 : active raid5 sdc[0] sdd[1] sde[3](S) sdf[2](F)
+      3906764800 blocks super 1.2 level 5, 512k chunk, algorithm 2 [3/2] [UU_]
+
+md0 : active raid1 sdb1[1] sda1[0]
+      1047552 blocks super 1.2 [2/2] [UU]
+
+unused devices: <none>
+`)
+
+	members, err := mdMembers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"sda1": "md0", "sdb1": "md0", "sdc": "md1", "sdd": "md1"}
+	if len(members) != len(want) {
+		t.Errorf("mdMembers() = %v, want %v", members, want)
+	}
+	for k, v := range want {
+		if members[k] != v {
+			t.Errorf("mdMembers()[%s] = %q, want %q", k, members[k], v)
+		}
+	}
+}
+
+func TestMdWaitRanges(t *testing.T) {
+	members := map[string]string{"sda1": "md0", "sdb1": "md0"}
+	cur := map[string]disk.IOCountersStat{
+		"sda1": {ReadCount: 100, ReadTime: 200, WriteCount: 10, WriteTime: 30},
+		"sdb1": {ReadCount: 100, ReadTime: 1200},
+	}
+	r := mdWaitRanges(members, cur, nil)["md0"]
+	if r == nil || r.ReadMin != 2 || r.ReadMax != 12 || r.WriteMin != 3 || r.WriteMax != 3 {
+		t.Errorf("mdWaitRanges() since boot = %+v, want reads 2-12 and writes 3", r)
+	}
+
+	prev := map[string]disk.IOCountersStat{
+		"sda1": {ReadCount: 50, ReadTime: 150, WriteCount: 10, WriteTime: 30},
+		"sdb1": {ReadCount: 90, ReadTime: 200},
+	}
+	r = mdWaitRanges(members, cur, prev)["md0"]
+	if r == nil || r.ReadMin != 1 || r.ReadMax != 100 || r.writes != 0 {
+		t.Errorf("mdWaitRanges() since prev = %+v, want reads 1-100 and no writes", r)
+	}
+}
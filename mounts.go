@@ -0,0 +1,168 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// Policies for devices that back more than one mountpoint.
+const (
+	multiMountDuplicate = "duplicate"
+	multiMountPrimary   = "primary"
+	multiMountDedup     = "dedup"
+)
+
+// mountSample pairs the counters of a device with one of its mountpoints.
+type mountSample struct {
+	Counters   disk.IOCountersStat
+	Mountpoint string
+}
+
+// firstMountpoints maps the name of every mounted device, as deviceName
+// returns it for the partition's device path, to the first of its
+// mountpoints.
+func firstMountpoints(parts []disk.PartitionStat, deviceName func(string) string) map[string]string {
+	mountpoints := map[string]string{}
+	for _, p := range parts {
+		name := deviceName(p.Device)
+		if _, ok := mountpoints[name]; !ok {
+			mountpoints[name] = p.Mountpoint
+		}
+	}
+	return mountpoints
+}
+
+// mountIndex maps the names of the mounted devices to their mountpoints,
+// so the counters of all devices can be read at once and matched to the
+// partitions afterwards.
+type mountIndex struct {
+	// names holds the devices in the order the partitions list them.
+	names       []string
+	mountpoints map[string][]string
+}
+
+// add records that device name is mounted at mountpoint. A mountpoint
+// listed twice for the same device, as after mounting over it, is kept once
+// so it does not yield two identical series.
+func (m *mountIndex) add(name, mountpoint string) {
+	if m.mountpoints == nil {
+		m.mountpoints = map[string][]string{}
+	}
+	mps, ok := m.mountpoints[name]
+	if !ok {
+		m.names = append(m.names, name)
+	}
+	for _, mp := range mps {
+		if mp == mountpoint {
+			return
+		}
+	}
+	m.mountpoints[name] = append(mps, mountpoint)
+}
+
+// samples pairs the counters of every indexed device with each of its
+// mountpoints, in partition order. Devices missing from counters are left
+// out.
+func (m mountIndex) samples(counters map[string]disk.IOCountersStat) []mountSample {
+	var samples []mountSample
+	for _, name := range m.names {
+		v, ok := counters[name]
+		if !ok {
+			continue
+		}
+		for _, mp := range m.mountpoints[name] {
+			samples = append(samples, mountSample{Counters: v, Mountpoint: mp})
+		}
+	}
+	return samples
+}
+
+// applyMultiMountPolicy decides what to report for devices that show up
+// with several mountpoints (bind mounts, btrfs subvolumes). The kernel
+// only counts IO per device, so the counters cannot be split between
+// mounts. The first mountpoint seen for a device is its primary one:
+//
+//   - duplicate reports the full counters for every mountpoint
+//   - primary reports the full counters for the primary mountpoint and
+//     zero for the others, so sums across mountpoints stay correct
+//   - dedup reports the device once, with its primary mountpoint
+func applyMultiMountPolicy(samples []mountSample, policy string) []mountSample {
+	if policy == multiMountDuplicate {
+		return samples
+	}
+	seen := map[string]bool{}
+	result := make([]mountSample, 0, len(samples))
+	for _, s := range samples {
+		name := s.Counters.Name
+		if !seen[name] {
+			seen[name] = true
+			result = append(result, s)
+			continue
+		}
+		if policy == multiMountPrimary {
+			result = append(result, mountSample{
+				Counters:   disk.IOCountersStat{Name: name},
+				Mountpoint: s.Mountpoint,
+			})
+		}
+	}
+	return result
+}
+
+// hasRootMount reports whether a block device is mounted at /. It is not
+// when the root filesystem is an overlay (containers) or tmpfs (live
+// systems), which the partition list leaves out.
+func hasRootMount(parts []disk.PartitionStat) bool {
+	for _, p := range parts {
+		if p.Mountpoint == "/" {
+			return true
+		}
+	}
+	return false
+}
+
+// rootSamples keeps only the samples of the device backing the / mountpoint,
+// including its other mountpoints. It returns nothing when the root device
+// was filtered out.
+func rootSamples(samples []mountSample) []mountSample {
+	root := ""
+	for _, s := range samples {
+		if s.Mountpoint == "/" {
+			root = s.Counters.Name
+			break
+		}
+	}
+	var result []mountSample
+	for _, s := range samples {
+		if len(root) > 0 && s.Counters.Name == root {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// defaultFstypeExclude lists the pseudo and image filesystems that carry no
+// meaningful IO counters of their own.
+var defaultFstypeExclude = []string{"tmpfs", "overlay", "squashfs", "devtmpfs"}
+
+// fstypeAllowed reports whether a partition with the given filesystem type
+// is reported under --fstype-include and --fstype-exclude. Matching is exact
+// and case-insensitive. When an include list is given it wins: only the
+// listed types are reported, even if they are excluded too.
+func fstypeAllowed(fstype string, include, exclude []string) bool {
+	if len(include) > 0 {
+		return containsFold(include, fstype)
+	}
+	return !containsFold(exclude, fstype)
+}
+
+// containsFold reports whether list contains s, ignoring case.
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(strings.TrimSpace(v), s) {
+			return true
+		}
+	}
+	return false
+}
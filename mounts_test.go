@@ -0,0 +1,128 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+func multiMountSamples() []mountSample {
+	sda := disk.IOCountersStat{Name: "sda", ReadBytes: 100}
+	sdb := disk.IOCountersStat{Name: "sdb", ReadBytes: 50}
+	return []mountSample{
+		{Counters: sda, Mountpoint: "/"},
+		{Counters: sdb, Mountpoint: "/data"},
+		{Counters: sda, Mountpoint: "/srv/bind"},
+	}
+}
+
+func TestMultiMountPolicyDuplicate(t *testing.T) {
+	got := applyMultiMountPolicy(multiMountSamples(), multiMountDuplicate)
+	if len(got) != 3 {
+		t.Fatalf("got %d samples, want 3", len(got))
+	}
+	if got[2].Counters.ReadBytes != 100 {
+		t.Errorf("duplicate mount read bytes = %d, want 100", got[2].Counters.ReadBytes)
+	}
+}
+
+func TestMultiMountPolicyPrimary(t *testing.T) {
+	got := applyMultiMountPolicy(multiMountSamples(), multiMountPrimary)
+	if len(got) != 3 {
+		t.Fatalf("got %d samples, want 3", len(got))
+	}
+	if got[0].Mountpoint != "/" || got[0].Counters.ReadBytes != 100 {
+		t.Errorf("primary mount = %+v, want / with full counters", got[0])
+	}
+	if got[2].Mountpoint != "/srv/bind" || got[2].Counters.ReadBytes != 0 || got[2].Counters.Name != "sda" {
+		t.Errorf("secondary mount = %+v, want /srv/bind with zero counters", got[2])
+	}
+}
+
+func TestMultiMountPolicyDedup(t *testing.T) {
+	got := applyMultiMountPolicy(multiMountSamples(), multiMountDedup)
+	if len(got) != 2 {
+		t.Fatalf("got %d samples, want 2", len(got))
+	}
+	if got[0].Mountpoint != "/" || got[1].Mountpoint != "/data" {
+		t.Errorf("dedup kept %q and %q, want / and /data", got[0].Mountpoint, got[1].Mountpoint)
+	}
+}
+
+func TestRootSamples(t *testing.T) {
+	got := rootSamples(multiMountSamples())
+	if len(got) != 2 || got[0].Mountpoint != "/" || got[1].Mountpoint != "/srv/bind" {
+		t.Errorf("rootSamples = %+v, want both sda mountpoints", got)
+	}
+	if got := rootSamples(multiMountSamples()[1:2]); len(got) != 0 {
+		t.Errorf("rootSamples without / = %+v, want none", got)
+	}
+}
+
+func TestHasRootMount(t *testing.T) {
+	if !hasRootMount([]disk.PartitionStat{{Device: "/dev/sda1", Mountpoint: "/"}}) {
+		t.Errorf("root on /dev/sda1 not found")
+	}
+	if hasRootMount([]disk.PartitionStat{{Device: "/dev/sdb1", Mountpoint: "/data"}}) {
+		t.Errorf("root found without a / mount")
+	}
+}
+
+func TestFstypeAllowed(t *testing.T) {
+	tests := []struct {
+		fstype           string
+		include, exclude []string
+		want             bool
+	}{
+		{"ext4", nil, defaultFstypeExclude, true},
+		{"tmpfs", nil, defaultFstypeExclude, false},
+		{"OverlayFS", nil, []string{"overlayfs"}, false},
+		{"overlay", nil, []string{"overlayfs"}, true},
+		{"xfs", []string{"ext4", "XFS"}, defaultFstypeExclude, true},
+		{"btrfs", []string{"ext4", "xfs"}, nil, false},
+		// Both lists name squashfs: the include list wins.
+		{"squashfs", []string{"squashfs"}, defaultFstypeExclude, true},
+		{"tmpfs", []string{"squashfs"}, defaultFstypeExclude, false},
+	}
+	for _, tt := range tests {
+		if got := fstypeAllowed(tt.fstype, tt.include, tt.exclude); got != tt.want {
+			t.Errorf("fstypeAllowed(%q, %v, %v) = %v, want %v", tt.fstype, tt.include, tt.exclude, got, tt.want)
+		}
+	}
+}
+
+func TestFirstMountpoints(t *testing.T) {
+	parts := []disk.PartitionStat{
+		{Device: "/dev/sda1", Mountpoint: "/"},
+		{Device: "/dev/sdb", Mountpoint: "/data"},
+		{Device: "/dev/sda1", Mountpoint: "/var/lib/docker"},
+	}
+	got := firstMountpoints(parts, filepath.Base)
+	if len(got) != 2 || got["sda1"] != "/" || got["sdb"] != "/data" {
+		t.Errorf("firstMountpoints = %v", got)
+	}
+}
+
+func TestMountIndex(t *testing.T) {
+	var m mountIndex
+	m.add("sda1", "/")
+	m.add("sdb", "/data")
+	m.add("sda1", "/var/lib/docker")
+	m.add("sda1", "/")
+	m.add("sdc", "/backup")
+	counters := map[string]disk.IOCountersStat{
+		"sda1": {Name: "sda1", ReadBytes: 1},
+		"sdb":  {Name: "sdb", ReadBytes: 2},
+	}
+	got := m.samples(counters)
+	want := []struct{ name, mountpoint string }{{"sda1", "/"}, {"sda1", "/var/lib/docker"}, {"sdb", "/data"}}
+	if len(got) != len(want) {
+		t.Fatalf("samples() = %+v, want %v", got, want)
+	}
+	for i, w := range want {
+		if got[i].Counters.Name != w.name || got[i].Mountpoint != w.mountpoint {
+			t.Errorf("sample %d = %s on %s, want %s on %s", i, got[i].Counters.Name, got[i].Mountpoint, w.name, w.mountpoint)
+		}
+	}
+}
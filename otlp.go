@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jadiunr/check-disk-io/output"
+)
+
+// otlpTimeout bounds the export request so an unreachable collector cannot
+// hang the check.
+const otlpTimeout = 10 * time.Second
+
+// otlpCumulative is AGGREGATION_TEMPORALITY_CUMULATIVE.
+const otlpCumulative = 2
+
+// The types below mirror the OTLP metrics protobuf messages in their
+// canonical JSON encoding, which OTLP/HTTP collectors accept with a
+// Content-Type of application/json. 64-bit integers are strings there.
+type otlpRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpMetric struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Sum         *otlpSum   `json:"sum,omitempty"`
+	Gauge       *otlpGauge `json:"gauge,omitempty"`
+}
+
+type otlpSum struct {
+	AggregationTemporality int             `json:"aggregationTemporality"`
+	IsMonotonic            bool            `json:"isMonotonic"`
+	DataPoints             []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpDataPoint struct {
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+	TimeUnixNano string         `json:"timeUnixNano"`
+	AsInt        string         `json:"asInt,omitempty"`
+	AsDouble     *float64       `json:"asDouble,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+// otlpAttributes converts tags to OTLP attributes, sorted by key.
+func otlpAttributes(tags map[string]string) []otlpKeyValue {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	attrs := make([]otlpKeyValue, 0, len(keys))
+	for _, k := range keys {
+		attrs = append(attrs, otlpKeyValue{Key: k, Value: otlpAnyValue{StringValue: tags[k]}})
+	}
+	return attrs
+}
+
+// buildOTLP converts the metric groups to an OTLP export request. COUNTER
+// groups become monotonic cumulative sums, GAUGE groups become gauges.
+func buildOTLP(groups map[string]*MetricGroup, resource map[string]string, now time.Time) otlpRequest {
+	ts := strconv.FormatInt(now.UnixNano(), 10)
+	var metrics []otlpMetric
+	for _, name := range output.GroupNames(groups) {
+		g := groups[name]
+		points := make([]otlpDataPoint, 0, len(g.Metrics))
+		for _, m := range output.SortedMetrics(g.Metrics) {
+			p := otlpDataPoint{Attributes: otlpAttributes(m.Tags), TimeUnixNano: ts}
+			switch {
+			case m.IsInt && m.IntValue <= math.MaxInt64:
+				p.AsInt = strconv.FormatUint(m.IntValue, 10)
+			case m.IsInt:
+				v := float64(m.IntValue)
+				p.AsDouble = &v
+			default:
+				v := m.Value
+				p.AsDouble = &v
+			}
+			points = append(points, p)
+		}
+		metric := otlpMetric{Name: g.Name, Description: g.Comment}
+		if strings.EqualFold(g.Type, "COUNTER") {
+			metric.Sum = &otlpSum{AggregationTemporality: otlpCumulative, IsMonotonic: true, DataPoints: points}
+		} else {
+			metric.Gauge = &otlpGauge{DataPoints: points}
+		}
+		metrics = append(metrics, metric)
+	}
+
+	return otlpRequest{ResourceMetrics: []otlpResourceMetrics{{
+		Resource:     otlpResource{Attributes: otlpAttributes(resource)},
+		ScopeMetrics: []otlpScopeMetrics{{Scope: otlpScope{Name: plugin.Name}, Metrics: metrics}},
+	}}}
+}
+
+// exportOTLP posts the request to an OTLP/HTTP metrics endpoint.
+func exportOTLP(endpoint string, headers map[string]string, insecure bool, req otlpRequest) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		httpReq.Header.Set(k, v)
+	}
+
+	client := &http.Client{Timeout: otlpTimeout}
+	if insecure {
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}} // #nosec G402 -- opt-in via --otlp-insecure
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("collector returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestExportOTLP(t *testing.T) {
+	groups := map[string]*MetricGroup{
+		"disk_read_bytes":       {Name: "disk_read_bytes", Type: "COUNTER"},
+		"disk_iops_in_progress": {Name: "disk_iops_in_progress", Type: "GAUGE"},
+	}
+	groups["disk_read_bytes"].AddIntMetric(map[string]string{"device": "sda"}, 4096)
+	groups["disk_iops_in_progress"].AddIntMetric(map[string]string{"device": "sda"}, 2)
+
+	var got otlpRequest
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decoding request: %v", err)
+		}
+	}))
+	defer srv.Close()
+
+	req := buildOTLP(groups, map[string]string{"host.name": "db1"}, time.Unix(1, 0))
+	if err := exportOTLP(srv.URL, map[string]string{"Authorization": "Bearer x"}, false, req); err != nil {
+		t.Fatal(err)
+	}
+
+	if auth != "Bearer x" {
+		t.Errorf("Authorization header = %q", auth)
+	}
+	rm := got.ResourceMetrics[0]
+	if rm.Resource.Attributes[0].Key != "host.name" || rm.Resource.Attributes[0].Value.StringValue != "db1" {
+		t.Errorf("resource attributes = %+v", rm.Resource.Attributes)
+	}
+	metrics := rm.ScopeMetrics[0].Metrics
+	if len(metrics) != 2 {
+		t.Fatalf("got %d metrics, want 2", len(metrics))
+	}
+	gauge, sum := metrics[0], metrics[1]
+	if gauge.Gauge == nil || gauge.Gauge.DataPoints[0].AsInt != "2" {
+		t.Errorf("disk_iops_in_progress = %+v, want gauge 2", gauge)
+	}
+	if sum.Sum == nil || !sum.Sum.IsMonotonic || sum.Sum.DataPoints[0].AsInt != "4096" || sum.Sum.DataPoints[0].TimeUnixNano != "1000000000" {
+		t.Errorf("disk_read_bytes = %+v, want monotonic sum 4096", sum)
+	}
+}
+
+func TestExportOTLPError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad payload", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	if err := exportOTLP(srv.URL, nil, false, otlpRequest{}); err == nil {
+		t.Errorf("expected an error for a 400 response")
+	}
+}
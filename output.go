@@ -0,0 +1,586 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jadiunr/check-disk-io/collector"
+	"github.com/jadiunr/check-disk-io/output"
+)
+
+// Output formats selectable with --format.
+const (
+	formatPrometheus = "prometheus"
+	formatLabels     = "labels"
+	formatEnv        = "env"
+	formatJSON       = "json"
+	formatDocument   = "json-document"
+	formatInfluxDB   = "influxdb"
+	formatGraphite   = "graphite"
+)
+
+// outputSink is one format of --format and the file of --output-file it is
+// written to, empty for stdout or --fifo.
+type outputSink struct {
+	Format string
+	File   string
+}
+
+// parseOutputs pairs the comma-separated formats of --format with the files
+// of --output-file, given as a plain path for a single format or as
+// <format>=<path>,... At most one format may go without a file, to stdout.
+func parseOutputs(formats, files string) ([]outputSink, error) {
+	var sinks []outputSink
+	index := map[string]int{}
+	for _, f := range strings.Split(formats, ",") {
+		f = strings.TrimSpace(f)
+		switch f {
+		case formatPrometheus, formatJSON, formatDocument, formatInfluxDB, formatGraphite, formatEnv, formatLabels:
+		default:
+			return nil, fmt.Errorf("invalid --format %q, must be prometheus, json, json-document, influxdb, graphite, env or labels", f)
+		}
+		if _, ok := index[f]; ok {
+			return nil, fmt.Errorf("invalid --format %q, %s is given twice", formats, f)
+		}
+		index[f] = len(sinks)
+		sinks = append(sinks, outputSink{Format: f})
+	}
+	if len(strings.TrimSpace(files)) > 0 {
+		for _, entry := range strings.Split(files, ",") {
+			entry = strings.TrimSpace(entry)
+			format, file := "", entry
+			if i := strings.IndexByte(entry, '='); i >= 0 {
+				if _, ok := index[entry[:i]]; ok || len(sinks) > 1 {
+					format, file = entry[:i], entry[i+1:]
+				}
+			}
+			if len(format) == 0 {
+				if len(sinks) > 1 {
+					return nil, fmt.Errorf("invalid --output-file %q, with several formats each file must be given as <format>=<path>", entry)
+				}
+				format = sinks[0].Format
+			}
+			i, ok := index[format]
+			if !ok {
+				return nil, fmt.Errorf("invalid --output-file %q, %s is not a --format", entry, format)
+			}
+			if len(file) == 0 {
+				return nil, fmt.Errorf("invalid --output-file %q, empty path", entry)
+			}
+			if len(sinks[i].File) > 0 {
+				return nil, fmt.Errorf("invalid --output-file %q, %s is given twice", entry, format)
+			}
+			sinks[i].File = file
+		}
+	}
+	var stdout []string
+	for _, s := range sinks {
+		if len(s.File) == 0 {
+			stdout = append(stdout, s.Format)
+		}
+	}
+	if len(stdout) > 1 {
+		return nil, fmt.Errorf("--format %s would all be written to stdout, give all but one of them an --output-file <format>=<path>", strings.Join(stdout, ", "))
+	}
+	return sinks, nil
+}
+
+// encoder returns the encoder of a --format. now is the time given to the
+// samples without a timestamp by the formats that need one.
+func encoder(format string, now time.Time) output.Encoder {
+	switch format {
+	case formatLabels:
+		return output.Labels{Tag: plugin.LabelsTag}
+	case formatEnv:
+		return output.Env{}
+	case formatJSON:
+		return output.JSON{}
+	case formatDocument:
+		return output.JSONDocument{}
+	case formatInfluxDB:
+		return output.InfluxDB{Measurement: plugin.InfluxMeasurement, FieldsMode: plugin.InfluxFieldsMode}
+	case formatGraphite:
+		return output.Graphite{Prefix: plugin.GraphitePrefix, Now: now}
+	}
+	return output.Prometheus{Legacy: plugin.LegacyOutput}
+}
+
+// stdoutSink returns the sink written to stdout or --fifo, nil when every
+// format goes to a file.
+func stdoutSink(sinks []outputSink) *outputSink {
+	for i := range sinks {
+		if len(sinks[i].File) == 0 {
+			return &sinks[i]
+		}
+	}
+	return nil
+}
+
+// parseStaticTags parses the key=value entries of --tag.
+func parseStaticTags(entries []string) (map[string]string, error) {
+	tags := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		kv := strings.SplitN(entry, "=", 2)
+		if len(kv) != 2 || len(strings.TrimSpace(kv[0])) == 0 {
+			return nil, fmt.Errorf("%q, must be key=value", entry)
+		}
+		tags[strings.TrimSpace(kv[0])] = kv[1]
+	}
+	return tags, nil
+}
+
+// withHost returns the static tags with a host tag added, unless host is
+// empty or --tag already sets one.
+func withHost(tags map[string]string, host string) map[string]string {
+	if _, ok := tags["host"]; ok || len(host) == 0 {
+		return tags
+	}
+	merged := make(map[string]string, len(tags)+1)
+	for k, v := range tags {
+		merged[k] = v
+	}
+	merged["host"] = host
+	return merged
+}
+
+// applyStaticTags adds the --tag tags to every sample. Tags the sample
+// already has, such as device and mountpoint, take precedence. Like
+// applyTargetTags, every sample gets a fresh map.
+func applyStaticTags(groups map[string]*MetricGroup, tags map[string]string) {
+	if len(tags) == 0 {
+		return
+	}
+	for _, g := range groups {
+		for i := range g.Metrics {
+			merged := make(map[string]string, len(g.Metrics[i].Tags)+len(tags))
+			for k, v := range tags {
+				merged[k] = v
+			}
+			for k, v := range g.Metrics[i].Tags {
+				merged[k] = v
+			}
+			g.Metrics[i].Tags = merged
+		}
+	}
+}
+
+// applyTargetTags adds tags such as the --instance and --job of the target
+// to every sample. A sample that already carries one of these keys keeps its
+// value under "exported_<key>", the same way Prometheus resolves such
+// collisions, so no information is lost. Tag maps can be shared between
+// groups, so every sample gets a fresh map.
+func applyTargetTags(groups map[string]*MetricGroup, tags map[string]string) {
+	if len(tags) == 0 {
+		return
+	}
+	for _, g := range groups {
+		for i := range g.Metrics {
+			merged := make(map[string]string, len(g.Metrics[i].Tags)+len(tags))
+			for k, v := range g.Metrics[i].Tags {
+				merged[k] = v
+			}
+			for k, v := range tags {
+				if old, ok := merged[k]; ok {
+					merged["exported_"+k] = old
+				}
+				merged[k] = v
+			}
+			g.Metrics[i].Tags = merged
+		}
+	}
+}
+
+// Values accepted by --mask-method.
+const (
+	maskHash        = "hash"
+	maskPlaceholder = "placeholder"
+)
+
+// maskPlaceholderValue replaces masked values with --mask-method placeholder.
+const maskPlaceholderValue = "masked"
+
+// maskValue returns the masked form of a tag value: the first 12 hex digits
+// of the SHA-256 of salt and value for hash, which keeps distinct values
+// distinct, or a fixed placeholder. Empty values are left empty.
+func maskValue(value, method, salt string) string {
+	if len(value) == 0 {
+		return value
+	}
+	if method == maskPlaceholder {
+		return maskPlaceholderValue
+	}
+	sum := sha256.Sum256([]byte(salt + value))
+	return hex.EncodeToString(sum[:6])
+}
+
+// maskTags masks the values of the given tag keys in every sample. Like
+// applyTargetTags it gives every touched sample a fresh tag map, since tag
+// maps can be shared between groups.
+func maskTags(groups map[string]*MetricGroup, keys []string, method, salt string) {
+	if len(keys) == 0 {
+		return
+	}
+	for _, g := range groups {
+		for i := range g.Metrics {
+			var masked map[string]string
+			for _, k := range keys {
+				v, ok := g.Metrics[i].Tags[k]
+				if !ok {
+					continue
+				}
+				if masked == nil {
+					masked = make(map[string]string, len(g.Metrics[i].Tags))
+					for k, v := range g.Metrics[i].Tags {
+						masked[k] = v
+					}
+				}
+				masked[k] = maskValue(v, method, salt)
+			}
+			if masked != nil {
+				g.Metrics[i].Tags = masked
+			}
+		}
+	}
+}
+
+// metricTypes are the types accepted by --type-override.
+var metricTypes = map[string]bool{"COUNTER": true, "GAUGE": true, "UNTYPED": true}
+
+// extraGroupNames are the metric groups emitted besides collector.Counters
+// and the groups derived from them.
+var extraGroupNames = []string{
+	"disk_cgroup_read_bytes",
+	"disk_cgroup_read_count",
+	"disk_cgroup_write_bytes",
+	"disk_cgroup_write_count",
+	"disk_free_bytes",
+	"disk_inodes_free",
+	"disk_inodes_total",
+	"disk_inodes_used",
+	"disk_inodes_used_percent",
+	"disk_io_up",
+	"disk_io_collect_duration_seconds",
+	"disk_io_collect_errors",
+	"disk_io_collect_timeouts",
+	"disk_io_counter_resets_total",
+	"disk_io_device_info",
+	"disk_io_device_reappeared",
+	"disk_io_devices_filtered",
+	"disk_io_devices_scanned",
+	"disk_io_enrichment_available",
+	"disk_io_metrics_emitted_total",
+	"disk_io_parse_suspect",
+	"disk_io_plugin_cpu_seconds",
+	"disk_io_plugin_info",
+	"disk_io_plugin_rss_bytes",
+	"disk_io_run_sequence",
+	"disk_io_scrape_success",
+	"disk_io_stuck",
+	"disk_iowait_contribution_ms",
+	"disk_latency_slo_breaches_total",
+	"disk_md_member_read_wait_ms_max",
+	"disk_md_member_read_wait_ms_min",
+	"disk_md_member_write_wait_ms_max",
+	"disk_md_member_write_wait_ms_min",
+	"disk_nvme_available_spare_percent",
+	"disk_nvme_available_spare_threshold_percent",
+	"disk_nvme_controller_busy_minutes",
+	"disk_nvme_critical_warning",
+	"disk_nvme_error_log_entries",
+	"disk_nvme_media_errors",
+	"disk_nvme_percentage_used",
+	"disk_nvme_power_on_hours",
+	"disk_nvme_temperature_celsius",
+	"disk_nvme_unsafe_shutdowns",
+	"disk_queue_completed",
+	"disk_queue_issued",
+	"disk_read_latency_p50_ms",
+	"disk_read_merge_ratio",
+	"disk_read_latency_p95_ms",
+	"disk_read_wait_ms",
+	"disk_smart_attribute_raw",
+	"disk_smart_attribute_value",
+	"disk_total_bytes",
+	"disk_used_bytes",
+	"disk_used_percent",
+	"disk_write_latency_p50_ms",
+	"disk_write_latency_p95_ms",
+	"disk_write_merge_ratio",
+	"disk_write_wait_ms",
+	"disk_util_percent",
+	"disk_util_percent_max",
+	"disk_util_percent_min",
+	"disk_util_percent_p95",
+	"disk_read_await_ms",
+	"disk_read_await_ms_max",
+	"disk_read_await_ms_min",
+	"disk_read_await_ms_p95",
+	"disk_write_await_ms",
+	"disk_write_await_ms_max",
+	"disk_write_await_ms_min",
+	"disk_write_await_ms_p95",
+	"disk_sub_sample_await_seconds_bucket",
+	"disk_avg_request_bytes",
+	"disk_avg_queue_size",
+	"disk_zfs_read_bytes_per_sec",
+	"disk_zfs_read_latency_seconds_bucket",
+	"disk_zfs_read_ops_per_sec",
+	"disk_zfs_write_bytes_per_sec",
+	"disk_zfs_write_latency_seconds_bucket",
+	"disk_zfs_write_ops_per_sec",
+}
+
+// knownGroup reports whether name is a metric group this plugin can emit,
+// including the *_since_baseline, *_delta, *_per_sec and *_rate_<window>
+// variants of the base groups.
+func knownGroup(name string) bool {
+	for _, n := range extraGroupNames {
+		if name == n {
+			return true
+		}
+	}
+	for _, b := range collector.Counters {
+		switch {
+		case name == b.Name, name == b.Name+"_since_baseline", name == b.Name+"_delta", name == b.Name+"_per_sec":
+			return true
+		case strings.HasPrefix(name, b.Name+"_rate_"):
+			return true
+		}
+	}
+	return false
+}
+
+// metricNamePattern is the Prometheus metric name charset.
+var metricNamePattern = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// validMetricName reports whether name is a valid Prometheus metric name.
+func validMetricName(name string) bool {
+	return metricNamePattern.MatchString(name)
+}
+
+// applyNamespace prefixes the name of every group with namespace and an
+// underscore, returning the groups keyed by their new names. This is the
+// only place names change, so the header and sample lines of every format
+// agree.
+func applyNamespace(groups map[string]*MetricGroup, namespace string) map[string]*MetricGroup {
+	if len(namespace) == 0 {
+		return groups
+	}
+	renamed := make(map[string]*MetricGroup, len(groups))
+	for _, g := range groups {
+		g.Name = namespace + "_" + g.Name
+		renamed[g.Name] = g
+	}
+	return renamed
+}
+
+// Values accepted by --naming-scheme.
+const (
+	namingLegacy       = "legacy"
+	namingNodeExporter = "node-exporter"
+)
+
+// nodeExporterGroups maps the raw counter groups to the name, help text and
+// unit conversion node_exporter uses for the same /proc/diskstats field,
+// without the node_ namespace.
+var nodeExporterGroups = map[string]struct {
+	Name    string
+	Comment string
+	Scale   float64
+}{
+	"disk_read_bytes":         {"disk_read_bytes_total", "The total number of bytes read successfully.", 1},
+	"disk_write_bytes":        {"disk_written_bytes_total", "The total number of bytes written successfully.", 1},
+	"disk_read_count":         {"disk_reads_completed_total", "The total number of reads completed successfully.", 1},
+	"disk_write_count":        {"disk_writes_completed_total", "The total number of writes completed successfully.", 1},
+	"disk_read_time":          {"disk_read_time_seconds_total", "The total number of seconds spent by all reads.", 0.001},
+	"disk_write_time":         {"disk_write_time_seconds_total", "This is the total number of seconds spent by all writes.", 0.001},
+	"disk_io_time":            {"disk_io_time_seconds_total", "Total seconds spent doing I/Os.", 0.001},
+	"disk_weighted_io":        {"disk_io_time_weighted_seconds_total", "The weighted # of seconds spent doing I/Os.", 0.001},
+	"disk_iops_in_progress":   {"disk_io_now", "The number of I/Os currently in progress.", 1},
+	"disk_merged_read_count":  {"disk_reads_merged_total", "The total number of reads merged.", 1},
+	"disk_merged_write_count": {"disk_writes_merged_total", "The number of writes merged.", 1},
+}
+
+// applyNamingScheme renames the raw counter groups for --naming-scheme
+// node-exporter and converts the milliseconds node_exporter reports in
+// seconds. Other groups keep their names. The legacy scheme returns groups
+// unchanged.
+func applyNamingScheme(groups map[string]*MetricGroup, scheme string) map[string]*MetricGroup {
+	if scheme != namingNodeExporter {
+		return groups
+	}
+	renamed := make(map[string]*MetricGroup, len(groups))
+	for name, g := range groups {
+		if n, ok := nodeExporterGroups[name]; ok {
+			g.Name, g.Comment = n.Name, n.Comment
+			if n.Scale != 1 {
+				for i := range g.Metrics {
+					m := &g.Metrics[i]
+					if m.IsInt {
+						m.Value, m.IsInt = float64(m.IntValue), false
+					}
+					m.Value *= n.Scale
+				}
+			}
+		}
+		renamed[g.Name] = g
+	}
+	return renamed
+}
+
+// Values accepted by --time-unit and --size-unit.
+const (
+	timeUnitMs    = "ms"
+	timeUnitS     = "s"
+	sizeUnitBytes = "bytes"
+	sizeUnitKiB   = "kib"
+	sizeUnitMiB   = "mib"
+)
+
+// implicitMsGroups are the raw counter groups counting milliseconds without
+// a unit in their name.
+var implicitMsGroups = []string{"disk_read_time", "disk_write_time", "disk_io_time", "disk_weighted_io"}
+
+// sizeUnitNames maps --size-unit to the name replacing "bytes" and the
+// number of bytes per unit.
+var sizeUnitNames = map[string]struct {
+	Name  string
+	Bytes float64
+}{
+	sizeUnitKiB: {"kibibytes", 1 << 10},
+	sizeUnitMiB: {"mebibytes", 1 << 20},
+}
+
+// unitConversion returns the name and scale of a group in other units: for
+// --time-unit s the groups in milliseconds, the ms token of their name
+// becoming seconds or seconds being added after the counter name, and for
+// --size-unit kib or mib the groups with a bytes token. ok is false when
+// the group is in neither. unit is the name of the new unit.
+func unitConversion(name, timeUnit, sizeUnit string) (renamed, unit string, scale float64, ok bool) {
+	tokens := strings.Split(name, "_")
+	if timeUnit == timeUnitS {
+		for i, t := range tokens {
+			if t == "ms" {
+				tokens[i] = "seconds"
+				return strings.Join(tokens, "_"), "seconds", 0.001, true
+			}
+		}
+		for _, base := range implicitMsGroups {
+			if name == base || strings.HasPrefix(name, base+"_") {
+				return base + "_seconds" + strings.TrimPrefix(name, base), "seconds", 0.001, true
+			}
+		}
+	}
+	if u, found := sizeUnitNames[sizeUnit]; found {
+		for i, t := range tokens {
+			if t == "bytes" {
+				tokens[i] = u.Name
+				return strings.Join(tokens, "_"), u.Name, 1 / u.Bytes, true
+			}
+		}
+	}
+	return name, "", 1, false
+}
+
+// applyUnits converts the groups in milliseconds and bytes to the units of
+// --time-unit and --size-unit and renames them after the new unit, counters
+// also getting the _total suffix, e.g. disk_read_time_seconds_total. The
+// default units return groups unchanged.
+func applyUnits(groups map[string]*MetricGroup, timeUnit, sizeUnit string) map[string]*MetricGroup {
+	if timeUnit == timeUnitMs && sizeUnit == sizeUnitBytes {
+		return groups
+	}
+	renamed := make(map[string]*MetricGroup, len(groups))
+	for name, g := range groups {
+		if n, unit, scale, ok := unitConversion(name, timeUnit, sizeUnit); ok {
+			if strings.EqualFold(g.Type, "COUNTER") && !strings.HasSuffix(n, "_total") {
+				n += "_total"
+			}
+			g.Name = n
+			g.Comment += " It is reported in " + unit + "."
+			for i := range g.Metrics {
+				m := &g.Metrics[i]
+				if m.IsInt {
+					m.Value, m.IsInt = float64(m.IntValue), false
+				}
+				m.Value *= scale
+			}
+		}
+		renamed[g.Name] = g
+	}
+	return renamed
+}
+
+// parseMetricsAllowlist parses --metrics into a set of group names,
+// rejecting every name that is not a metric group of this plugin.
+func parseMetricsAllowlist(names []string) (map[string]bool, error) {
+	allow := make(map[string]bool, len(names))
+	var unknown []string
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if !knownGroup(name) {
+			unknown = append(unknown, fmt.Sprintf("%q", name))
+			continue
+		}
+		allow[name] = true
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("unknown metric groups %s", strings.Join(unknown, ", "))
+	}
+	return allow, nil
+}
+
+// groupNeeded reports whether the named counter group has to be collected
+// for the allowlist: either it is listed itself, or a group derived from
+// it, such as its _delta, is. An empty allowlist needs every group.
+func groupNeeded(name string, allow map[string]bool) bool {
+	if len(allow) == 0 {
+		return true
+	}
+	for n := range allow {
+		if n == name || strings.HasPrefix(n, name+"_") {
+			return true
+		}
+	}
+	return false
+}
+
+// selectGroups drops the groups that are not in the allowlist, or that are
+// in deny. An empty allowlist keeps every group not denied.
+func selectGroups(groups map[string]*MetricGroup, allow, deny map[string]bool) {
+	for name := range groups {
+		if len(allow) > 0 && !allow[name] || deny[name] {
+			delete(groups, name)
+		}
+	}
+}
+
+// parseTypeOverrides validates --type-override entries, mapping group names
+// to a type, and returns them with upper-cased types as used in the output.
+func parseTypeOverrides(entries map[string]string) (map[string]string, error) {
+	overrides := make(map[string]string, len(entries))
+	for name, typ := range entries {
+		if !knownGroup(name) {
+			return nil, fmt.Errorf("unknown metric group %q", name)
+		}
+		typ = strings.ToUpper(typ)
+		if !metricTypes[typ] {
+			return nil, fmt.Errorf("invalid type %q for %s, must be counter, gauge or untyped", entries[name], name)
+		}
+		overrides[name] = typ
+	}
+	return overrides, nil
+}
+
+// applyTypeOverrides sets the type of the overridden groups.
+func applyTypeOverrides(groups map[string]*MetricGroup, overrides map[string]string) {
+	for name, typ := range overrides {
+		if g, ok := groups[name]; ok {
+			g.Type = typ
+		}
+	}
+}
@@ -0,0 +1,546 @@
+// Package output writes metric groups in the output formats of
+// check-disk-io, each of them an Encoder:
+//
+//	var enc output.Encoder = output.InfluxDB{Measurement: "disk_io", FieldsMode: output.InfluxMultiField}
+//	err := enc.Encode(os.Stdout, groups, nil)
+//
+// Every format lists the groups sorted by name and their samples sorted by
+// device, then by their other tags, so the output is the same from run to
+// run.
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jadiunr/check-disk-io/collector"
+)
+
+// Encoder writes metric groups in one output format.
+type Encoder interface {
+	// Encode writes groups, keyed by name, and then the samples of
+	// success, the scrape success of the run, unless it is nil. It returns
+	// the first write error.
+	Encode(w io.Writer, groups map[string]*collector.MetricGroup, success *collector.MetricGroup) error
+}
+
+// errWriter remembers the first write error, so rendering code can write
+// unconditionally and the error is checked once at the end.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (e *errWriter) Write(p []byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	n, err := e.w.Write(p)
+	e.err = err
+	return n, err
+}
+
+// stream writes the groups one by one with write and then success. The
+// samples of success are written as 0 when writing the groups failed, so a
+// reader that got the end of the output still sees the failure.
+func stream(w io.Writer, groups map[string]*collector.MetricGroup, success *collector.MetricGroup, write func(io.Writer, *collector.MetricGroup)) error {
+	out := &errWriter{w: w}
+	for _, name := range GroupNames(groups) {
+		write(out, groups[name])
+	}
+	if success != nil {
+		if out.err != nil {
+			failed := *success
+			failed.Metrics = make([]collector.Metric, len(success.Metrics))
+			for i, m := range success.Metrics {
+				m.Value, m.IntValue = 0, 0
+				failed.Metrics[i] = m
+			}
+			success = &failed
+		}
+		write(out, success)
+	}
+	return out.err
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+// Prometheus is the Prometheus text format. Legacy writes the types in
+// upper case and the help texts and tag values unescaped, as the first
+// releases of the check did.
+type Prometheus struct {
+	Legacy bool
+}
+
+func (p Prometheus) Encode(w io.Writer, groups map[string]*collector.MetricGroup, success *collector.MetricGroup) error {
+	return stream(w, groups, success, p.writeGroup)
+}
+
+func (p Prometheus) writeGroup(w io.Writer, g *collector.MetricGroup) {
+	var output string
+	if p.Legacy {
+		fmt.Fprintf(w, "# HELP %s [%s] %s\n", g.Name, g.Type, g.Comment)
+		fmt.Fprintf(w, "# TYPE %s %s\n", g.Name, g.Type)
+	} else {
+		fmt.Fprintf(w, "# HELP %s [%s] %s\n", g.Name, g.Type, helpEscaper.Replace(g.Comment))
+		fmt.Fprintf(w, "# TYPE %s %s\n", g.Name, strings.ToLower(g.Type))
+	}
+	for _, m := range SortedMetrics(g.Metrics) {
+		tagStr := ""
+		tags := make([]string, 0, len(m.Tags))
+		for tag := range m.Tags {
+			tags = append(tags, tag)
+		}
+		sort.Strings(tags)
+		for _, tag := range tags {
+			if len(tagStr) > 0 {
+				tagStr = tagStr + ","
+			}
+			value := m.Tags[tag]
+			if !p.Legacy {
+				value = labelEscaper.Replace(value)
+			}
+			tagStr = tagStr + tag + "=\"" + value + "\""
+		}
+		if len(tagStr) > 0 {
+			tagStr = "{" + tagStr + "}"
+		}
+		output = strings.Join([]string{g.Name + tagStr, m.FormatValue()}, " ")
+		if m.Timestamp > 0 {
+			output = output + " " + strconv.FormatInt(m.Timestamp, 10)
+		}
+		fmt.Fprintln(w, output)
+	}
+	fmt.Fprintln(w, "")
+}
+
+// JSON is newline-delimited JSON, one object per sample in the same order
+// as the Prometheus output. Values that JSON cannot represent, NaN and the
+// infinities, are written as null.
+type JSON struct{}
+
+func (JSON) Encode(w io.Writer, groups map[string]*collector.MetricGroup, success *collector.MetricGroup) error {
+	return stream(w, groups, success, writeJSON)
+}
+
+// jsonSample is one line of the JSON format.
+type jsonSample struct {
+	Name      string            `json:"name"`
+	Type      string            `json:"type"`
+	Tags      map[string]string `json:"tags"`
+	Value     *json.Number      `json:"value"`
+	Timestamp int64             `json:"timestamp,omitempty"`
+}
+
+func writeJSON(w io.Writer, g *collector.MetricGroup) {
+	for _, m := range SortedMetrics(g.Metrics) {
+		sample := jsonSample{Name: g.Name, Type: g.Type, Tags: m.Tags, Timestamp: m.Timestamp}
+		if m.IsInt || !math.IsNaN(m.Value) && !math.IsInf(m.Value, 0) {
+			v := json.Number(m.FormatValue())
+			sample.Value = &v
+		}
+		line, err := json.Marshal(sample)
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(w, "%s\n", line)
+	}
+}
+
+// JSONSchemaVersion is the schema_version of the JSONDocument format. It
+// is increased whenever a consumer could be broken by a change of the
+// layout.
+const JSONSchemaVersion = 1
+
+// JSONDocument writes all samples as a single JSON document: one object per
+// device (and mountpoint, and queue) carrying its tags and the value of
+// every metric group, the samples without a device tag under "global", and
+// the type of every group. The samples of the scrape success are the last
+// series of "global". Like JSON, values that JSON cannot represent are
+// written as null.
+type JSONDocument struct{}
+
+// jsonDocument is the output of the JSONDocument format.
+type jsonDocument struct {
+	SchemaVersion int               `json:"schema_version"`
+	Timestamp     int64             `json:"timestamp,omitempty"`
+	Types         map[string]string `json:"types"`
+	Devices       []jsonSeries      `json:"devices"`
+	Global        []jsonSeries      `json:"global"`
+}
+
+// jsonSeries is the values of all metric groups for one set of tags.
+type jsonSeries struct {
+	Tags    map[string]string       `json:"tags"`
+	Metrics map[string]*json.Number `json:"metrics"`
+}
+
+func (JSONDocument) Encode(w io.Writer, groups map[string]*collector.MetricGroup, success *collector.MetricGroup) error {
+	doc := jsonDocument{
+		SchemaVersion: JSONSchemaVersion,
+		Types:         map[string]string{},
+		Devices:       []jsonSeries{},
+		Global:        []jsonSeries{},
+	}
+	for name, g := range groups {
+		if len(g.Metrics) > 0 {
+			doc.Types[name] = g.Type
+		}
+	}
+	sets := groupByTags(groups)
+	if success != nil {
+		doc.Types[success.Name] = success.Type
+		sets = append(sets, groupByTags(map[string]*collector.MetricGroup{success.Name: success})...)
+	}
+	for _, set := range sets {
+		series := jsonSeries{Tags: set.Tags, Metrics: map[string]*json.Number{}}
+		for i, m := range set.Samples {
+			var value *json.Number
+			if m.IsInt || !math.IsNaN(m.Value) && !math.IsInf(m.Value, 0) {
+				v := json.Number(m.FormatValue())
+				value = &v
+			}
+			series.Metrics[set.Names[i]] = value
+			if doc.Timestamp == 0 {
+				doc.Timestamp = m.Timestamp
+			}
+		}
+		if _, ok := set.Tags["device"]; ok {
+			doc.Devices = append(doc.Devices, series)
+		} else {
+			doc.Global = append(doc.Global, series)
+		}
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// Labels writes the distinct, non-empty values of Tag across all samples,
+// sorted and one per line. This is what Grafana needs to populate a
+// template variable. The scrape success, which has no such tag, is left
+// out.
+type Labels struct {
+	Tag string
+}
+
+func (l Labels) Encode(w io.Writer, groups map[string]*collector.MetricGroup, success *collector.MetricGroup) error {
+	values := map[string]bool{}
+	for _, g := range groups {
+		for _, m := range g.Metrics {
+			if v := m.Tags[l.Tag]; len(v) > 0 {
+				values[v] = true
+			}
+		}
+	}
+	sorted := make([]string, 0, len(values))
+	for v := range values {
+		sorted = append(sorted, v)
+	}
+	sort.Strings(sorted)
+	out := &errWriter{w: w}
+	for _, v := range sorted {
+		fmt.Fprintln(out, v)
+	}
+	return out.err
+}
+
+// Env writes every sample as a NAME=value line that a shell can source.
+// Samples are written sorted by group and then by their tags, so when
+// several samples map to the same name (a device with several mountpoints,
+// or devices that only differ in characters replaced by _) the first keeps
+// the name and the others get a _2, _3, ... suffix in the same order on
+// every run. The samples of the scrape success come last.
+type Env struct{}
+
+func (Env) Encode(w io.Writer, groups map[string]*collector.MetricGroup, success *collector.MetricGroup) error {
+	out := &errWriter{w: w}
+	used := map[string]int{}
+	write := func(name string, g *collector.MetricGroup) {
+		for _, m := range SortedMetrics(g.Metrics) {
+			env := envName(name, m.Tags["device"])
+			used[env]++
+			if n := used[env]; n > 1 {
+				env = fmt.Sprintf("%s_%d", env, n)
+			}
+			fmt.Fprintf(out, "%s=%s\n", env, m.FormatValue())
+		}
+	}
+	for _, name := range GroupNames(groups) {
+		write(name, groups[name])
+	}
+	if success != nil {
+		write(success.Name, success)
+	}
+	return out.err
+}
+
+// envName turns a metric group name and device into a shell variable name:
+// the group name upper-cased with a DISK_IO_ prefix, followed by the device,
+// with every character other than A-Z, 0-9 and _ replaced by _.
+func envName(group, device string) string {
+	name := strings.ToUpper(group)
+	if !strings.HasPrefix(name, "DISK_IO_") {
+		name = "DISK_IO_" + strings.TrimPrefix(name, "DISK_")
+	}
+	if len(device) > 0 {
+		name += "_" + device
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		}
+		return '_'
+	}, name)
+}
+
+// Schemas of the InfluxDB format, its FieldsMode.
+const (
+	InfluxMultiField = "single-measurement-multi-field"
+	InfluxPerMetric  = "per-metric-measurement"
+)
+
+var (
+	influxEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+	// Measurement names may contain an unescaped =.
+	influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+)
+
+// InfluxDB is the InfluxDB line protocol. With the InfluxMultiField
+// FieldsMode the samples of all groups that share a tag set, normally those
+// of one device and mountpoint, become the fields of a single line of
+// Measurement, named after the group without its "disk_" prefix. With
+// InfluxPerMetric every sample is a line of its own with a single value
+// field, its measurement being Measurement and the group name without its
+// "disk_io_" or "disk_" prefix joined by an underscore, such as
+// disk_io_read_bytes and disk_io_up. Line protocol has no empty tag values,
+// NaN or infinities, so such tags and fields are left out. Timestamps are
+// in nanoseconds. The samples of the scrape success are written on lines of
+// their own after all others.
+type InfluxDB struct {
+	Measurement string
+	FieldsMode  string
+}
+
+func (e InfluxDB) Encode(w io.Writer, groups map[string]*collector.MetricGroup, success *collector.MetricGroup) error {
+	out := &errWriter{w: w}
+	if e.FieldsMode == InfluxPerMetric {
+		write := func(name string, g *collector.MetricGroup) {
+			metric := strings.TrimPrefix(strings.TrimPrefix(name, "disk_io_"), "disk_")
+			for _, m := range SortedMetrics(g.Metrics) {
+				if value, ok := influxValue(m); ok {
+					writeInfluxLine(out, e.Measurement+"_"+metric, m.Tags, []string{"value=" + value}, m.Timestamp)
+				}
+			}
+		}
+		for _, name := range GroupNames(groups) {
+			write(name, groups[name])
+		}
+		if success != nil {
+			write(success.Name, success)
+		}
+		return out.err
+	}
+	sets := groupByTags(groups)
+	if success != nil {
+		sets = append(sets, groupByTags(map[string]*collector.MetricGroup{success.Name: success})...)
+	}
+	for _, set := range sets {
+		var fields []string
+		for i, m := range set.Samples {
+			if value, ok := influxValue(m); ok {
+				fields = append(fields, influxEscaper.Replace(strings.TrimPrefix(set.Names[i], "disk_"))+"="+value)
+			}
+		}
+		if len(fields) > 0 {
+			writeInfluxLine(out, e.Measurement, set.Tags, fields, set.Samples[0].Timestamp)
+		}
+	}
+	return out.err
+}
+
+// influxValue renders the value of a sample as a line protocol field value:
+// raw counters as integers, everything else as floats. It is false for NaN
+// and the infinities.
+func influxValue(m collector.Metric) (string, bool) {
+	switch {
+	case m.IsInt && m.IntValue <= math.MaxInt64:
+		return strconv.FormatUint(m.IntValue, 10) + "i", true
+	case m.IsInt:
+		return strconv.FormatFloat(float64(m.IntValue), 'g', -1, 64), true
+	case math.IsNaN(m.Value) || math.IsInf(m.Value, 0):
+		return "", false
+	}
+	return strconv.FormatFloat(m.Value, 'g', -1, 64), true
+}
+
+// writeInfluxLine writes one line of line protocol, with the non-empty tags
+// sorted by key and the timestamp, in milliseconds, left out when it is 0.
+func writeInfluxLine(w io.Writer, measurement string, tags map[string]string, fields []string, ts int64) {
+	var b strings.Builder
+	b.WriteString(influxMeasurementEscaper.Replace(measurement))
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if v := tags[k]; len(v) > 0 {
+			b.WriteString("," + influxEscaper.Replace(k) + "=" + influxEscaper.Replace(v))
+		}
+	}
+	b.WriteString(" " + strings.Join(fields, ","))
+	if ts > 0 {
+		b.WriteString(" " + strconv.FormatInt(ts*int64(time.Millisecond), 10))
+	}
+	fmt.Fprintln(w, b.String())
+}
+
+// tagSet holds the samples of all groups that have the same tags, and the
+// name of the group of each sample.
+type tagSet struct {
+	Tags    map[string]string
+	Names   []string
+	Samples []collector.Metric
+}
+
+// groupByTags collects the samples of all groups by their tags. The sets are
+// sorted by their tags and the samples of a set by group name.
+func groupByTags(groups map[string]*collector.MetricGroup) []*tagSet {
+	sets := map[string]*tagSet{}
+	var keys []string
+	for _, name := range GroupNames(groups) {
+		for _, m := range groups[name].Metrics {
+			key := tagKey(m.Tags)
+			set, ok := sets[key]
+			if !ok {
+				set = &tagSet{Tags: m.Tags}
+				sets[key] = set
+				keys = append(keys, key)
+			}
+			set.Names = append(set.Names, name)
+			set.Samples = append(set.Samples, m)
+		}
+	}
+	sort.Strings(keys)
+	sorted := make([]*tagSet, len(keys))
+	for i, key := range keys {
+		sorted[i] = sets[key]
+	}
+	return sorted
+}
+
+// graphiteTags are the tags that become segments of a Graphite path, in
+// this order, after the host and "disk". Other tags are left out.
+var graphiteTags = []string{"device", "mountpoint", "queue"}
+
+var graphiteUnsafe = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// graphiteSegment turns a tag value into a single Graphite path segment.
+// Slashes at either end are dropped, so the / mountpoint becomes "root" and
+// /var/lib becomes "var_lib", and dots, which separate segments, become
+// underscores.
+func graphiteSegment(s string) string {
+	s = graphiteUnsafe.ReplaceAllString(strings.Trim(s, "/"), "_")
+	if len(s) == 0 {
+		return "root"
+	}
+	return s
+}
+
+// Graphite is the Graphite plaintext protocol, with one
+// <Prefix>.<host>.disk.<device>.<mountpoint>.<metric> line per sample,
+// where metric is the group name without its "disk_" prefix. Segments of
+// tags a sample does not have are left out. Samples without a timestamp
+// get Now, and NaN and the infinities, which Graphite does not store, are
+// skipped.
+type Graphite struct {
+	Prefix string
+	Now    time.Time
+}
+
+func (e Graphite) Encode(w io.Writer, groups map[string]*collector.MetricGroup, success *collector.MetricGroup) error {
+	return stream(w, groups, success, e.writeGroup)
+}
+
+func (e Graphite) writeGroup(w io.Writer, g *collector.MetricGroup) {
+	metric := graphiteUnsafe.ReplaceAllString(strings.TrimPrefix(g.Name, "disk_"), "_")
+	for _, m := range SortedMetrics(g.Metrics) {
+		if !m.IsInt && (math.IsNaN(m.Value) || math.IsInf(m.Value, 0)) {
+			continue
+		}
+		var path []string
+		if len(e.Prefix) > 0 {
+			path = append(path, e.Prefix)
+		}
+		if host, ok := m.Tags["host"]; ok && len(host) > 0 {
+			path = append(path, graphiteSegment(host))
+		}
+		path = append(path, "disk")
+		for _, tag := range graphiteTags {
+			if v, ok := m.Tags[tag]; ok && len(v) > 0 {
+				path = append(path, graphiteSegment(v))
+			}
+		}
+		path = append(path, metric)
+		ts := m.Timestamp / 1000
+		if ts == 0 {
+			ts = e.Now.Unix()
+		}
+		fmt.Fprintf(w, "%s %s %d\n", strings.Join(path, "."), m.FormatValue(), ts)
+	}
+}
+
+// GroupNames returns the names of the groups in sorted order, so every
+// output format lists them the same way from run to run.
+func GroupNames(groups map[string]*collector.MetricGroup) []string {
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SortedMetrics returns a copy of metrics sorted by device, then by the
+// remaining tags.
+func SortedMetrics(metrics []collector.Metric) []collector.Metric {
+	sorted := append([]collector.Metric(nil), metrics...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if a, b := sorted[i].Tags["device"], sorted[j].Tags["device"]; a != b {
+			return a < b
+		}
+		return tagKey(sorted[i].Tags) < tagKey(sorted[j].Tags)
+	})
+	return sorted
+}
+
+// tagKey renders tags in a canonical order for sorting.
+func tagKey(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k + "=" + tags[k] + "\x00")
+	}
+	return b.String()
+}
@@ -0,0 +1,280 @@
+package output
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jadiunr/check-disk-io/collector"
+)
+
+func TestPrometheusKeepsLargeCountersExact(t *testing.T) {
+	const value = uint64(1)<<53 + 1
+
+	g := &collector.MetricGroup{Name: "disk_read_bytes", Type: "COUNTER", Comment: "test"}
+	g.AddIntMetric(map[string]string{"device": "sda"}, value)
+
+	var buf bytes.Buffer
+	Prometheus{}.writeGroup(&buf, g)
+
+	want := `disk_read_bytes{device="sda"} 9007199254740993`
+	if !strings.Contains(buf.String(), want) {
+		t.Errorf("output %q does not contain %q", buf.String(), want)
+	}
+}
+
+func TestPrometheusTimestamp(t *testing.T) {
+	g := &collector.MetricGroup{Name: "disk_io_up", Type: "GAUGE", Comment: "test"}
+	g.AddMetric(map[string]string{"device": "sda"}, 1)
+	g.SetTimestamp(1700000000123)
+
+	var buf bytes.Buffer
+	Prometheus{}.writeGroup(&buf, g)
+
+	want := `disk_io_up{device="sda"} 1 1700000000123` + "\n"
+	if !strings.Contains(buf.String(), want) {
+		t.Errorf("output %q does not contain %q", buf.String(), want)
+	}
+}
+
+func TestPrometheusIsSorted(t *testing.T) {
+	g := &collector.MetricGroup{Name: "disk_read_bytes", Type: "COUNTER", Comment: "test"}
+	g.AddIntMetric(map[string]string{"mountpoint": "/data", "device": "sdb"}, 2)
+	g.AddIntMetric(map[string]string{"mountpoint": "/", "device": "sda"}, 1)
+
+	var buf bytes.Buffer
+	Prometheus{}.writeGroup(&buf, g)
+
+	want := `disk_read_bytes{device="sda",mountpoint="/"} 1
+disk_read_bytes{device="sdb",mountpoint="/data"} 2
+`
+	if !strings.Contains(buf.String(), want) {
+		t.Errorf("output %q does not contain %q", buf.String(), want)
+	}
+}
+
+func TestPrometheusEscaping(t *testing.T) {
+	g := &collector.MetricGroup{Name: "disk_read_bytes", Type: "COUNTER", Comment: `C:\ line`}
+	g.AddIntMetric(map[string]string{"label": "a \"b\"\nc\\"}, 1)
+
+	var buf bytes.Buffer
+	Prometheus{}.writeGroup(&buf, g)
+	want := `# HELP disk_read_bytes [COUNTER] C:\\ line
+# TYPE disk_read_bytes counter
+disk_read_bytes{label="a \"b\"\nc\\"} 1
+`
+	if !strings.HasPrefix(buf.String(), want) {
+		t.Errorf("output %q, want prefix %q", buf.String(), want)
+	}
+
+	buf.Reset()
+	Prometheus{Legacy: true}.writeGroup(&buf, g)
+	if want := "# TYPE disk_read_bytes COUNTER\n"; !strings.Contains(buf.String(), want) {
+		t.Errorf("legacy output %q does not contain %q", buf.String(), want)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	g := &collector.MetricGroup{Name: "disk_read_bytes", Type: "COUNTER"}
+	g.Metrics = []collector.Metric{
+		{Tags: map[string]string{"device": "sdb"}, IntValue: 1<<53 + 1, IsInt: true, Timestamp: 1700000000123},
+		{Tags: map[string]string{"device": "sda"}, Value: math.NaN()},
+	}
+
+	var buf bytes.Buffer
+	if err := (JSON{}).Encode(&buf, map[string]*collector.MetricGroup{g.Name: g}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"name":"disk_read_bytes","type":"COUNTER","tags":{"device":"sda"},"value":null}
+{"name":"disk_read_bytes","type":"COUNTER","tags":{"device":"sdb"},"value":9007199254740993,"timestamp":1700000000123}
+`
+	if got := buf.String(); got != want {
+		t.Errorf("JSON = %q, want %q", got, want)
+	}
+}
+
+func TestJSONDocument(t *testing.T) {
+	groups := map[string]*collector.MetricGroup{
+		"disk_read_bytes": {Name: "disk_read_bytes", Type: "COUNTER", Metrics: []collector.Metric{
+			{Tags: map[string]string{"device": "sdb"}, IntValue: 2, IsInt: true, Timestamp: 1700000000123},
+			{Tags: map[string]string{"device": "sda"}, IntValue: 1, IsInt: true, Timestamp: 1700000000123},
+		}},
+		"disk_read_wait_ms": {Name: "disk_read_wait_ms", Type: "GAUGE", Metrics: []collector.Metric{
+			{Tags: map[string]string{"device": "sda"}, Value: math.Inf(1), Timestamp: 1700000000123},
+		}},
+		"disk_io_collect_errors": {Name: "disk_io_collect_errors", Type: "GAUGE", Metrics: []collector.Metric{
+			{Tags: map[string]string{}, IntValue: 0, IsInt: true, Timestamp: 1700000000123},
+		}},
+	}
+	success := &collector.MetricGroup{Name: "disk_io_scrape_success", Type: "GAUGE", Metrics: []collector.Metric{
+		{Tags: map[string]string{}, IntValue: 1, IsInt: true, Timestamp: 1700000000123},
+	}}
+
+	var buf bytes.Buffer
+	if err := (JSONDocument{}).Encode(&buf, groups, success); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"schema_version":1,"timestamp":1700000000123,` +
+		`"types":{"disk_io_collect_errors":"GAUGE","disk_io_scrape_success":"GAUGE","disk_read_bytes":"COUNTER","disk_read_wait_ms":"GAUGE"},` +
+		`"devices":[{"tags":{"device":"sda"},"metrics":{"disk_read_bytes":1,"disk_read_wait_ms":null}},` +
+		`{"tags":{"device":"sdb"},"metrics":{"disk_read_bytes":2}}],` +
+		`"global":[{"tags":{},"metrics":{"disk_io_collect_errors":0}},{"tags":{},"metrics":{"disk_io_scrape_success":1}}]}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("JSONDocument =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestLabels(t *testing.T) {
+	groups := map[string]*collector.MetricGroup{
+		"a": {Metrics: []collector.Metric{
+			{Tags: map[string]string{"device": "sdb", "mountpoint": "/data"}},
+			{Tags: map[string]string{"device": "sda", "mountpoint": "/"}},
+		}},
+		"b": {Metrics: []collector.Metric{
+			{Tags: map[string]string{"device": "sdb", "mountpoint": ""}},
+		}},
+	}
+
+	var buf bytes.Buffer
+	Labels{Tag: "device"}.Encode(&buf, groups, nil)
+	if got, want := buf.String(), "sda\nsdb\n"; got != want {
+		t.Errorf("device values = %q, want %q", got, want)
+	}
+
+	buf.Reset()
+	Labels{Tag: "mountpoint"}.Encode(&buf, groups, nil)
+	if got, want := buf.String(), "/\n/data\n"; got != want {
+		t.Errorf("mountpoint values = %q, want %q", got, want)
+	}
+}
+
+func TestEnv(t *testing.T) {
+	groups := map[string]*collector.MetricGroup{
+		"disk_read_bytes": {Metrics: []collector.Metric{
+			{Tags: map[string]string{"device": "sda", "mountpoint": "/srv"}, IntValue: 2, IsInt: true},
+			{Tags: map[string]string{"device": "sda", "mountpoint": "/"}, IntValue: 1, IsInt: true},
+			{Tags: map[string]string{"device": "dm-0", "mountpoint": "/home"}, IntValue: 3, IsInt: true},
+		}},
+		"disk_io_up": {Metrics: []collector.Metric{
+			{Tags: map[string]string{"device": "sda"}, Value: 1},
+		}},
+		"disk_io_metrics_emitted_total": {Metrics: []collector.Metric{
+			{Tags: map[string]string{}, IntValue: 4, IsInt: true},
+		}},
+	}
+
+	var buf bytes.Buffer
+	Env{}.Encode(&buf, groups, nil)
+	want := "DISK_IO_METRICS_EMITTED_TOTAL=4\n" +
+		"DISK_IO_UP_SDA=1\n" +
+		"DISK_IO_READ_BYTES_DM_0=3\n" +
+		"DISK_IO_READ_BYTES_SDA=1\n" +
+		"DISK_IO_READ_BYTES_SDA_2=2\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Env =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestInfluxDB(t *testing.T) {
+	groups := map[string]*collector.MetricGroup{
+		"disk_read_bytes": {Name: "disk_read_bytes", Metrics: []collector.Metric{
+			{Tags: map[string]string{"device": "sda", "mountpoint": "/my data"}, IntValue: 2, IsInt: true, Timestamp: 1700000000123},
+			{Tags: map[string]string{"device": "vda", "mountpoint": ""}, IntValue: 1, IsInt: true},
+		}},
+		"disk_read_wait_ms": {Name: "disk_read_wait_ms", Metrics: []collector.Metric{
+			{Tags: map[string]string{"device": "sda", "mountpoint": "/my data"}, Value: 0.5, Timestamp: 1700000000123},
+			{Tags: map[string]string{"device": "vda", "mountpoint": ""}, Value: math.NaN()},
+		}},
+	}
+
+	var buf bytes.Buffer
+	InfluxDB{Measurement: "disk_io", FieldsMode: InfluxMultiField}.Encode(&buf, groups, nil)
+	want := `disk_io,device=sda,mountpoint=/my\ data read_bytes=2i,read_wait_ms=0.5 1700000000123000000` + "\n" +
+		"disk_io,device=vda read_bytes=1i\n"
+	if got := buf.String(); got != want {
+		t.Errorf("InfluxDB =\n%s\nwant\n%s", got, want)
+	}
+
+	success := &collector.MetricGroup{Name: "disk_io_scrape_success", Metrics: []collector.Metric{{Tags: map[string]string{}, IntValue: 1, IsInt: true}}}
+	buf.Reset()
+	InfluxDB{Measurement: "host disks", FieldsMode: InfluxPerMetric}.Encode(&buf, groups, success)
+	want = `host\ disks_read_bytes,device=sda,mountpoint=/my\ data value=2i 1700000000123000000` + "\n" +
+		"host\\ disks_read_bytes,device=vda value=1i\n" +
+		`host\ disks_read_wait_ms,device=sda,mountpoint=/my\ data value=0.5 1700000000123000000` + "\n" +
+		"host\\ disks_scrape_success value=1i\n"
+	if got := buf.String(); got != want {
+		t.Errorf("InfluxDB per metric =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestGraphite(t *testing.T) {
+	g := &collector.MetricGroup{Name: "disk_read_bytes", Metrics: []collector.Metric{
+		{Tags: map[string]string{"device": "sda", "mountpoint": "/", "host": "db1.example.com"}, IntValue: 2, IsInt: true, Timestamp: 1700000000123},
+		{Tags: map[string]string{"device": "sdb", "mountpoint": "/var/lib", "host": "db1.example.com", "job": "disks"}, IntValue: 3, IsInt: true},
+		{Tags: map[string]string{"device": "sdc", "mountpoint": ""}, Value: math.NaN()},
+	}}
+
+	var buf bytes.Buffer
+	Graphite{Prefix: "servers", Now: time.Unix(1800000000, 0)}.Encode(&buf, map[string]*collector.MetricGroup{g.Name: g}, nil)
+	want := "servers.db1_example_com.disk.sda.root.read_bytes 2 1700000000\n" +
+		"servers.db1_example_com.disk.sdb.var_lib.read_bytes 3 1800000000\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Graphite =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestSortedMetrics(t *testing.T) {
+	metrics := []collector.Metric{
+		{Tags: map[string]string{"device": "sdb", "mountpoint": "/data"}},
+		{Tags: map[string]string{"device": "sda", "mountpoint": "/var"}},
+		{Tags: map[string]string{}},
+		{Tags: map[string]string{"device": "sda", "mountpoint": "/"}},
+	}
+	var got []string
+	for _, m := range SortedMetrics(metrics) {
+		got = append(got, m.Tags["device"]+m.Tags["mountpoint"])
+	}
+	if want := []string{"", "sda/", "sda/var", "sdb/data"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("SortedMetrics() = %v, want %v", got, want)
+	}
+	if metrics[0].Tags["device"] != "sdb" {
+		t.Errorf("SortedMetrics() reordered its argument")
+	}
+	groups := map[string]*collector.MetricGroup{"disk_write_bytes": {}, "disk_io_up": {}, "disk_read_bytes": {}}
+	if got := strings.Join(GroupNames(groups), ","); got != "disk_io_up,disk_read_bytes,disk_write_bytes" {
+		t.Errorf("GroupNames() = %v", got)
+	}
+}
+
+// failingWriter fails every write after the first n bytes.
+type failingWriter struct {
+	n int
+}
+
+func (f *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > f.n {
+		return 0, errors.New("disk full")
+	}
+	f.n -= len(p)
+	return len(p), nil
+}
+
+func TestEncodeWriteError(t *testing.T) {
+	groups := map[string]*collector.MetricGroup{
+		"disk_io_up": {Name: "disk_io_up", Type: "GAUGE", Metrics: []collector.Metric{{Tags: map[string]string{"device": "sda"}, Value: 1}}},
+	}
+	success := &collector.MetricGroup{Name: "disk_io_scrape_success", Type: "GAUGE"}
+	success.AddIntMetric(map[string]string{}, 1)
+	for _, enc := range []Encoder{Prometheus{}, JSON{}, JSONDocument{}, InfluxDB{Measurement: "disk_io"}, Graphite{}, Env{}, Labels{Tag: "device"}} {
+		if err := enc.Encode(&failingWriter{n: 2}, groups, success); err == nil {
+			t.Errorf("%T.Encode() to a failing writer returned no error", enc)
+		}
+	}
+	if success.Metrics[0].IntValue != 1 {
+		t.Errorf("a failed Encode changed the scrape success to %d", success.Metrics[0].IntValue)
+	}
+}
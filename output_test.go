@@ -0,0 +1,308 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jadiunr/check-disk-io/output"
+)
+
+func TestParseStaticTags(t *testing.T) {
+	tags, err := parseStaticTags([]string{"datacenter=tyo1", "role=db", "note=a=b"})
+	if err != nil {
+		t.Fatalf("parseStaticTags returned error: %v", err)
+	}
+	if tags["datacenter"] != "tyo1" || tags["role"] != "db" || tags["note"] != "a=b" {
+		t.Errorf("tags = %v", tags)
+	}
+	for _, entry := range []string{"datacenter", "=tyo1"} {
+		if _, err := parseStaticTags([]string{entry}); err == nil {
+			t.Errorf("parseStaticTags(%q) expected error", entry)
+		}
+	}
+}
+
+func TestApplyStaticTags(t *testing.T) {
+	shared := map[string]string{"device": "sda"}
+	groups := map[string]*MetricGroup{
+		"a": {Metrics: []Metric{{Tags: shared}}},
+	}
+	applyStaticTags(groups, map[string]string{"role": "db", "device": "ignored"})
+
+	if got := groups["a"].Metrics[0].Tags; got["role"] != "db" || got["device"] != "sda" {
+		t.Errorf("tags = %v, want role=db device=sda", got)
+	}
+	if len(shared) != 1 {
+		t.Errorf("input tag map was modified: %v", shared)
+	}
+}
+
+func TestWithHost(t *testing.T) {
+	static := map[string]string{"role": "db"}
+	if got := withHost(static, "web1"); got["host"] != "web1" || got["role"] != "db" {
+		t.Errorf("withHost() = %v", got)
+	}
+	if len(static) != 1 {
+		t.Errorf("input tag map was modified: %v", static)
+	}
+	if got := withHost(static, ""); len(got) != 1 {
+		t.Errorf("withHost() with an empty host = %v", got)
+	}
+	if got := withHost(map[string]string{"host": "node1"}, "web1"); got["host"] != "node1" {
+		t.Errorf("withHost() overrode --tag host: %v", got)
+	}
+}
+
+func TestApplyTargetTags(t *testing.T) {
+	shared := map[string]string{"device": "sda"}
+	groups := map[string]*MetricGroup{
+		"a": {Metrics: []Metric{{Tags: shared}}},
+		"b": {Metrics: []Metric{{Tags: shared}, {Tags: map[string]string{"job": "node"}}}},
+	}
+	applyTargetTags(groups, map[string]string{"instance": "web1", "job": "disk"})
+
+	for _, m := range append(groups["a"].Metrics, groups["b"].Metrics[0]) {
+		if m.Tags["instance"] != "web1" || m.Tags["job"] != "disk" || m.Tags["device"] != "sda" {
+			t.Errorf("tags = %v", m.Tags)
+		}
+		if _, ok := m.Tags["exported_job"]; ok {
+			t.Errorf("shared tags were rewritten twice: %v", m.Tags)
+		}
+	}
+	if got := groups["b"].Metrics[1].Tags; got["job"] != "disk" || got["exported_job"] != "node" {
+		t.Errorf("colliding tags = %v, want job=disk exported_job=node", got)
+	}
+	if len(shared) != 1 {
+		t.Errorf("input tag map was modified: %v", shared)
+	}
+}
+
+func TestMaskTags(t *testing.T) {
+	shared := map[string]string{"device": "sda", "mountpoint": "/srv/customer-acme"}
+	groups := map[string]*MetricGroup{
+		"a": {Metrics: []Metric{{Tags: shared}}},
+		"b": {Metrics: []Metric{{Tags: shared}, {Tags: map[string]string{"device": "sdb", "mountpoint": ""}}}},
+	}
+	maskTags(groups, []string{"mountpoint", "label"}, maskHash, "")
+
+	want := maskValue("/srv/customer-acme", maskHash, "")
+	if len(want) != 12 || want == "/srv/customer-acme" {
+		t.Fatalf("maskValue = %q, want 12 hex digits", want)
+	}
+	for _, m := range append(groups["a"].Metrics, groups["b"].Metrics[0]) {
+		if m.Tags["mountpoint"] != want || m.Tags["device"] != "sda" {
+			t.Errorf("tags = %v, want mountpoint masked once", m.Tags)
+		}
+	}
+	if got := groups["b"].Metrics[1].Tags["mountpoint"]; got != "" {
+		t.Errorf("empty value masked to %q", got)
+	}
+	if shared["mountpoint"] != "/srv/customer-acme" {
+		t.Errorf("input tag map was modified: %v", shared)
+	}
+
+	if maskValue("/srv", maskHash, "salt") == maskValue("/srv", maskHash, "") {
+		t.Errorf("salt does not change the hash")
+	}
+	if got := maskValue("/srv", maskPlaceholder, ""); got != maskPlaceholderValue {
+		t.Errorf("placeholder = %q", got)
+	}
+}
+
+func TestApplyNamespace(t *testing.T) {
+	groups := map[string]*MetricGroup{"disk_read_bytes": {Name: "disk_read_bytes"}}
+	if got := applyNamespace(groups, ""); got["disk_read_bytes"] == nil {
+		t.Errorf("an empty namespace renamed the groups: %v", output.GroupNames(got))
+	}
+	got := applyNamespace(groups, "node")
+	if g := got["node_disk_read_bytes"]; g == nil || g.Name != "node_disk_read_bytes" || len(got) != 1 {
+		t.Errorf("applyNamespace() = %v", output.GroupNames(got))
+	}
+
+	for name, want := range map[string]bool{"node_disk": true, "team:io_disk": true, "9x_disk": false, "my-team_disk": false} {
+		if got := validMetricName(name); got != want {
+			t.Errorf("validMetricName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestApplyNamingScheme(t *testing.T) {
+	groups := func() map[string]*MetricGroup {
+		return map[string]*MetricGroup{
+			"disk_read_time":   {Name: "disk_read_time", Metrics: []Metric{{IntValue: 1500, IsInt: true}}},
+			"disk_write_bytes": {Name: "disk_write_bytes", Metrics: []Metric{{IntValue: 42, IsInt: true}}},
+			"disk_io_up":       {Name: "disk_io_up", Metrics: []Metric{{Value: 1}}},
+		}
+	}
+	if got := applyNamingScheme(groups(), namingLegacy); got["disk_read_time"] == nil || len(got) != 3 {
+		t.Errorf("the legacy scheme renamed the groups: %v", output.GroupNames(got))
+	}
+
+	got := applyNamingScheme(groups(), namingNodeExporter)
+	if want := []string{"disk_io_up", "disk_read_time_seconds_total", "disk_written_bytes_total"}; strings.Join(output.GroupNames(got), ",") != strings.Join(want, ",") {
+		t.Fatalf("applyNamingScheme() = %v, want %v", output.GroupNames(got), want)
+	}
+	if m := got["disk_read_time_seconds_total"].Metrics[0]; m.IsInt || m.Value != 1.5 {
+		t.Errorf("read time = %+v, want 1.5 seconds", m)
+	}
+	if m := got["disk_written_bytes_total"].Metrics[0]; !m.IsInt || m.IntValue != 42 {
+		t.Errorf("written bytes = %+v, want the exact integer 42", m)
+	}
+}
+
+func TestApplyUnits(t *testing.T) {
+	groups := func() map[string]*MetricGroup {
+		return map[string]*MetricGroup{
+			"disk_read_time":       {Name: "disk_read_time", Type: "COUNTER", Metrics: []Metric{{IntValue: 1500, IsInt: true}}},
+			"disk_read_time_delta": {Name: "disk_read_time_delta", Type: "GAUGE", Metrics: []Metric{{IntValue: 250, IsInt: true}}},
+			"disk_read_await_ms":   {Name: "disk_read_await_ms", Type: "GAUGE", Metrics: []Metric{{Value: 2}}},
+			"disk_write_bytes":     {Name: "disk_write_bytes", Type: "COUNTER", Metrics: []Metric{{IntValue: 3 << 20, IsInt: true}}},
+			"disk_io_up":           {Name: "disk_io_up", Type: "GAUGE", Metrics: []Metric{{Value: 1}}},
+		}
+	}
+	if got := applyUnits(groups(), timeUnitMs, sizeUnitBytes); got["disk_read_time"] == nil || len(got) != 5 {
+		t.Errorf("the default units renamed the groups: %v", output.GroupNames(got))
+	}
+
+	got := applyUnits(groups(), timeUnitS, sizeUnitMiB)
+	want := []string{"disk_io_up", "disk_read_await_seconds", "disk_read_time_seconds_delta", "disk_read_time_seconds_total", "disk_write_mebibytes_total"}
+	if strings.Join(output.GroupNames(got), ",") != strings.Join(want, ",") {
+		t.Fatalf("applyUnits() = %v, want %v", output.GroupNames(got), want)
+	}
+	for name, value := range map[string]float64{
+		"disk_read_time_seconds_total": 1.5,
+		"disk_read_time_seconds_delta": 0.25,
+		"disk_read_await_seconds":      0.002,
+		"disk_write_mebibytes_total":   3,
+		"disk_io_up":                   1,
+	} {
+		if m := got[name].Metrics[0]; m.IsInt || m.Value != value {
+			t.Errorf("%s = %+v, want %v", name, m, value)
+		}
+	}
+
+	got = applyUnits(groups(), timeUnitMs, sizeUnitKiB)
+	if got["disk_write_kibibytes_total"] == nil || got["disk_read_time"] == nil {
+		t.Errorf("applyUnits() with --size-unit kib = %v", output.GroupNames(got))
+	}
+}
+
+func TestParseMetricsAllowlist(t *testing.T) {
+	allow, err := parseMetricsAllowlist([]string{"disk_read_bytes", " disk_write_count_delta"})
+	if err != nil {
+		t.Fatalf("parseMetricsAllowlist returned error: %v", err)
+	}
+	if !allow["disk_read_bytes"] || !allow["disk_write_count_delta"] {
+		t.Errorf("allow = %v", allow)
+	}
+	_, err = parseMetricsAllowlist([]string{"disk_read_byte", "disk_read_count", "disk_writes"})
+	if err == nil || !strings.Contains(err.Error(), `"disk_read_byte", "disk_writes"`) {
+		t.Errorf("parseMetricsAllowlist error = %v, want both unknown names", err)
+	}
+}
+
+func TestSelectGroups(t *testing.T) {
+	allow := map[string]bool{"disk_read_bytes": true, "disk_write_count_delta": true}
+	for name, want := range map[string]bool{
+		"disk_read_bytes":  true,
+		"disk_write_count": true,
+		"disk_read_count":  false,
+	} {
+		if got := groupNeeded(name, allow); got != want {
+			t.Errorf("groupNeeded(%q) = %v, want %v", name, got, want)
+		}
+	}
+
+	groups := map[string]*MetricGroup{"disk_read_bytes": {}, "disk_write_count": {}, "disk_write_count_delta": {}}
+	selectGroups(groups, allow, nil)
+	if len(groups) != 2 || groups["disk_write_count"] != nil {
+		t.Errorf("selectGroups kept %v", output.GroupNames(groups))
+	}
+	groups = map[string]*MetricGroup{"disk_read_bytes": {}, "disk_write_count": {}}
+	selectGroups(groups, nil, map[string]bool{"disk_write_count": true})
+	if len(groups) != 1 || groups["disk_read_bytes"] == nil {
+		t.Errorf("selectGroups with a denied group kept %v", output.GroupNames(groups))
+	}
+	if !groupNeeded("disk_read_count", nil) {
+		t.Errorf("an empty allowlist should need every group")
+	}
+}
+
+func TestParseTypeOverrides(t *testing.T) {
+	got, err := parseTypeOverrides(map[string]string{
+		"disk_iops_in_progress":       "gauge",
+		"disk_read_bytes_rate_5m":     "Untyped",
+		"disk_io_time_since_baseline": "GAUGE",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["disk_iops_in_progress"] != "GAUGE" || got["disk_read_bytes_rate_5m"] != "UNTYPED" {
+		t.Errorf("overrides = %v", got)
+	}
+
+	for _, in := range []map[string]string{
+		{"disk_nonexistent": "gauge"},
+		{"disk_read_bytes": "histogram"},
+	} {
+		if _, err := parseTypeOverrides(in); err == nil {
+			t.Errorf("parseTypeOverrides(%v) expected error", in)
+		}
+	}
+
+	groups := map[string]*MetricGroup{"disk_read_bytes": {Type: "COUNTER"}}
+	applyTypeOverrides(groups, map[string]string{"disk_read_bytes": "GAUGE", "disk_io_up": "COUNTER"})
+	if groups["disk_read_bytes"].Type != "GAUGE" {
+		t.Errorf("type = %s, want GAUGE", groups["disk_read_bytes"].Type)
+	}
+}
+
+func TestInfluxOptions(t *testing.T) {
+	for _, tt := range []struct {
+		measurement, mode string
+		valid             bool
+	}{
+		{"disk_io", output.InfluxMultiField, true},
+		{"disks", output.InfluxPerMetric, true},
+		{" ", output.InfluxMultiField, false},
+		{"disk_io", "multi-field", false},
+	} {
+		useDefaults(t)
+		plugin.InfluxMeasurement, plugin.InfluxFieldsMode = tt.measurement, tt.mode
+		if _, err := checkArgs(nil); (err == nil) != tt.valid {
+			t.Errorf("checkArgs() with --influx-measurement %q --influx-fields-mode %q = %v, want valid %v", tt.measurement, tt.mode, err, tt.valid)
+		}
+	}
+}
+
+func TestParseOutputs(t *testing.T) {
+	for _, tt := range []struct {
+		formats, files string
+		want           []outputSink
+	}{
+		{"prometheus", "", []outputSink{{Format: "prometheus"}}},
+		{"prometheus", "/var/lib/disk=io.prom", []outputSink{{Format: "prometheus", File: "/var/lib/disk=io.prom"}}},
+		{"json", "json=/tmp/disk.json", []outputSink{{Format: "json", File: "/tmp/disk.json"}}},
+		{"prometheus, json", "json=/tmp/disk.json", []outputSink{{Format: "prometheus"}, {Format: "json", File: "/tmp/disk.json"}}},
+		{"prometheus,influxdb", "prometheus=/a.prom,influxdb=/b.lp", []outputSink{{Format: "prometheus", File: "/a.prom"}, {Format: "influxdb", File: "/b.lp"}}},
+	} {
+		got, err := parseOutputs(tt.formats, tt.files)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseOutputs(%q, %q) = %v, %v, want %v", tt.formats, tt.files, got, err, tt.want)
+		}
+	}
+	for _, tt := range [][2]string{
+		{"xml", ""},
+		{"json,json", "json=/a"},
+		{"prometheus,json", ""},
+		{"prometheus,json", "/a"},
+		{"prometheus,json", "env=/a"},
+		{"prometheus,json", "json=/a,json=/b"},
+		{"prometheus,json", "json="},
+	} {
+		if _, err := parseOutputs(tt[0], tt[1]); err == nil {
+			t.Errorf("parseOutputs(%q, %q) accepted", tt[0], tt[1])
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// queueStats are the request counters of one blk-mq hardware queue.
+type queueStats struct {
+	Index     int
+	Issued    uint64
+	Completed uint64
+}
+
+// diskOf returns the whole disk a block device belongs to: the device itself
+// for disks, the parent for partitions. Only whole disks have blk-mq queues.
+func diskOf(device string) string {
+	link := hostSys("class", "block", device)
+	if !pathExists(filepath.Join(link, "partition")) {
+		return device
+	}
+	resolved, err := filepath.EvalSymlinks(link)
+	if err != nil {
+		return device
+	}
+	return filepath.Base(filepath.Dir(resolved))
+}
+
+// readQueueCounter sums the numbers in the per-software-queue counter file
+// name (the kernel prints one value per direction) over all cpu<n>
+// directories below dir.
+func readQueueCounter(dir, name string) (uint64, bool) {
+	files, _ := filepath.Glob(filepath.Join(dir, "cpu*", name))
+	var sum uint64
+	found := false
+	for _, f := range files {
+		str, err := readSysString(f)
+		if err != nil {
+			continue
+		}
+		for _, field := range strings.Fields(str) {
+			if n, err := strconv.ParseUint(field, 10, 64); err == nil {
+				sum += n
+				found = true
+			}
+		}
+	}
+	return sum, found
+}
+
+// hostDebug joins parts onto the debugfs root. There is no gopsutil
+// convention for it, so HOST_SYS is reused as the mount of /sys.
+func hostDebug(parts ...string) string {
+	return hostSys(append([]string{"kernel", "debug", "block"}, parts...)...)
+}
+
+// deviceQueues returns the issue and completion counters of the blk-mq
+// hardware queues of a disk, ordered by queue index and capped at max
+// queues. The counters are read from /sys/block/<disk>/mq/<n>/cpu<m>/ on
+// kernels that still expose them there, and from debugfs
+// (/sys/kernel/debug/block/<disk>/hctx<n>/cpu<m>/) otherwise. Devices
+// without blk-mq, or hosts where neither tree is readable, yield no queues.
+func deviceQueues(disk string, max int) []queueStats {
+	var queues []queueStats
+	for _, layout := range []struct {
+		dir    string
+		prefix string
+	}{
+		{hostSys("block", disk, "mq"), ""},
+		{hostDebug(disk), "hctx"},
+	} {
+		entries, err := ioutil.ReadDir(layout.dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if !e.IsDir() || !strings.HasPrefix(e.Name(), layout.prefix) {
+				continue
+			}
+			index, err := strconv.Atoi(strings.TrimPrefix(e.Name(), layout.prefix))
+			if err != nil {
+				continue
+			}
+			dir := filepath.Join(layout.dir, e.Name())
+			issued, ok1 := readQueueCounter(dir, "dispatched")
+			completed, ok2 := readQueueCounter(dir, "completed")
+			if !ok1 && !ok2 {
+				continue
+			}
+			queues = append(queues, queueStats{Index: index, Issued: issued, Completed: completed})
+		}
+		if len(queues) > 0 {
+			break
+		}
+	}
+
+	sort.Slice(queues, func(i, j int) bool { return queues[i].Index < queues[j].Index })
+	if len(queues) > max {
+		queues = queues[:max]
+	}
+	return queues
+}
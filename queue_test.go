@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiskOf(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("HOST_SYS", root)
+
+	writeSysFile(t, root, "devices/pci0/nvme/nvme0n1/nvme0n1p1/partition", "1\n")
+	writeSysFile(t, root, "devices/pci0/nvme/nvme0n1/size", "100\n")
+	if err := os.MkdirAll(filepath.Join(root, "class/block"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for link, target := range map[string]string{
+		"nvme0n1":   "devices/pci0/nvme/nvme0n1",
+		"nvme0n1p1": "devices/pci0/nvme/nvme0n1/nvme0n1p1",
+	} {
+		if err := os.Symlink(filepath.Join(root, target), filepath.Join(root, "class/block", link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for device, want := range map[string]string{"nvme0n1": "nvme0n1", "nvme0n1p1": "nvme0n1", "sda": "sda"} {
+		if got := diskOf(device); got != want {
+			t.Errorf("diskOf(%q) = %q, want %q", device, got, want)
+		}
+	}
+}
+
+func TestDeviceQueues(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("HOST_SYS", root)
+
+	writeSysFile(t, root, "block/nvme0n1/mq/0/cpu0/dispatched", "10 5\n")
+	writeSysFile(t, root, "block/nvme0n1/mq/0/cpu0/completed", "9 5\n")
+	writeSysFile(t, root, "block/nvme0n1/mq/0/cpu1/dispatched", "1 0\n")
+	writeSysFile(t, root, "block/nvme0n1/mq/0/cpu1/completed", "1 0\n")
+	writeSysFile(t, root, "block/nvme0n1/mq/10/cpu2/dispatched", "7 0\n")
+	writeSysFile(t, root, "block/nvme0n1/mq/10/cpu2/completed", "7 0\n")
+	writeSysFile(t, root, "block/nvme0n1/mq/2/cpu3/dispatched", "3 3\n")
+	writeSysFile(t, root, "block/nvme0n1/mq/2/cpu3/completed", "2 3\n")
+	writeSysFile(t, root, "block/nvme0n1/mq/3/nr_tags", "1023\n")
+	writeSysFile(t, root, "kernel/debug/block/nvme1n1/hctx1/cpu0/dispatched", "4 4\n")
+	writeSysFile(t, root, "kernel/debug/block/nvme1n1/hctx1/cpu0/completed", "4 3\n")
+
+	got := deviceQueues("nvme0n1", 2)
+	want := []queueStats{{Index: 0, Issued: 16, Completed: 15}, {Index: 2, Issued: 6, Completed: 5}}
+	if len(got) != len(want) {
+		t.Fatalf("deviceQueues = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("queue %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	if got := deviceQueues("nvme1n1", 16); len(got) != 1 || got[0] != (queueStats{Index: 1, Issued: 8, Completed: 7}) {
+		t.Errorf("debugfs queues = %+v", got)
+	}
+	if got := deviceQueues("sda", 16); len(got) != 0 {
+		t.Errorf("sda queues = %+v, want none", got)
+	}
+}
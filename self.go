@@ -0,0 +1,26 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/sensu/sensu-plugin-sdk/version"
+)
+
+// pluginVersion returns the version and commit that release builds set in
+// the plugin SDK, "dev" and "none" for other builds.
+func pluginVersion() (v, commit string) {
+	return parseVersion(version.Version())
+}
+
+// parseVersion splits the SDK's "<version>, commit <commit>, built at
+// <date>" into the version and the commit.
+func parseVersion(s string) (v, commit string) {
+	v = s
+	if i := strings.Index(s, ", commit "); i >= 0 {
+		v, commit = s[:i], s[i+len(", commit "):]
+	}
+	if i := strings.Index(commit, ", built at "); i >= 0 {
+		commit = commit[:i]
+	}
+	return v, commit
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestProcessUsage(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no getrusage on windows")
+	}
+	// Burn a little CPU so the counter is above its resolution.
+	n := 0
+	for i := 0; i < 50000000; i++ {
+		n += i % 7
+	}
+	cpu, rss, err := processUsage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cpu <= 0 || rss < 1<<20 {
+		t.Errorf("processUsage = %v s, %d bytes (n=%d), want both positive and rss above 1MiB", cpu, rss, n)
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	v, commit := parseVersion("1.4.0, commit 3f2a9c1, built at 2022-03-01T10:00:00Z")
+	if v != "1.4.0" || commit != "3f2a9c1" {
+		t.Errorf("parseVersion() = %q, %q, want 1.4.0, 3f2a9c1", v, commit)
+	}
+	if v, commit := pluginVersion(); v != "dev" || commit != "none" {
+		t.Errorf("pluginVersion() of a test build = %q, %q, want dev, none", v, commit)
+	}
+}
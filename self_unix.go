@@ -0,0 +1,25 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"runtime"
+	"syscall"
+)
+
+// processUsage returns the CPU time in seconds (user plus system) and the
+// peak resident set size in bytes of the plugin process so far.
+func processUsage() (cpuSeconds float64, rssBytes uint64, err error) {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return 0, 0, err
+	}
+	cpuSeconds = float64(ru.Utime.Sec+ru.Stime.Sec) + float64(ru.Utime.Usec+ru.Stime.Usec)/1e6
+	rssBytes = uint64(ru.Maxrss)
+	// Only darwin reports ru_maxrss in bytes, the others use kilobytes.
+	if runtime.GOOS != "darwin" {
+		rssBytes *= 1024
+	}
+	return cpuSeconds, rssBytes, nil
+}
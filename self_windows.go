@@ -0,0 +1,10 @@
+package main
+
+import (
+	"errors"
+)
+
+// processUsage is not supported on Windows, which has no getrusage.
+func processUsage() (cpuSeconds float64, rssBytes uint64, err error) {
+	return 0, 0, errors.New("process usage is not supported on windows")
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// deviceSizeFilter implements --device-size-min and --device-size-max,
+// caching the verdict per device for the run.
+type deviceSizeFilter map[string]bool
+
+// inRange reports whether the device should be reported under the
+// configured size range. The size is read from sysfs; where that is not
+// available, the size of the filesystem mounted at mountpoint is used as an
+// approximation.
+func (f deviceSizeFilter) inRange(device, mountpoint string) bool {
+	if len(plugin.DeviceSizeMin) == 0 && len(plugin.DeviceSizeMax) == 0 {
+		return true
+	}
+	if ok, found := f[device]; found {
+		return ok
+	}
+
+	size, err := deviceSize(device)
+	if err != nil && len(mountpoint) > 0 {
+		var usage *disk.UsageStat
+		if usage, err = disk.Usage(mountpoint); err == nil {
+			size = usage.Total
+		}
+	}
+
+	enrichments.record("size", err == nil)
+	var ok bool
+	switch {
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Failed to get size of %s, error: %v\n", device, err)
+		ok = !plugin.DropUnknownSize
+	case len(plugin.DeviceSizeMax) > 0 && size > plugin.deviceSizeMax:
+		ok = false
+	default:
+		ok = size >= plugin.deviceSizeMin
+	}
+	f[device] = ok
+	return ok
+}
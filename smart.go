@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/binary"
+	"regexp"
+	"strconv"
+)
+
+// nvmeHealth holds the fields of the NVMe SMART / Health Information log
+// page (log identifier 02h) emitted by --smart.
+type nvmeHealth struct {
+	CriticalWarning    uint64
+	TemperatureKelvin  uint64
+	AvailableSpare     uint64
+	SpareThreshold     uint64
+	PercentageUsed     uint64
+	ControllerBusyTime uint64
+	PowerOnHours       uint64
+	UnsafeShutdowns    uint64
+	MediaErrors        uint64
+	ErrorLogEntries    uint64
+}
+
+// nvmeHealthLogSize is the size of the NVMe health log page.
+const nvmeHealthLogSize = 512
+
+// parseNVMeHealth decodes the health log page. The counters are 128-bit
+// little-endian values of which the low 64 bits are kept; none of them
+// comes anywhere near 2^64 on a real drive.
+func parseNVMeHealth(log []byte) (nvmeHealth, bool) {
+	if len(log) < nvmeHealthLogSize {
+		return nvmeHealth{}, false
+	}
+	u128 := func(offset int) uint64 { return binary.LittleEndian.Uint64(log[offset:]) }
+	return nvmeHealth{
+		CriticalWarning:    uint64(log[0]),
+		TemperatureKelvin:  uint64(binary.LittleEndian.Uint16(log[1:])),
+		AvailableSpare:     uint64(log[3]),
+		SpareThreshold:     uint64(log[4]),
+		PercentageUsed:     uint64(log[5]),
+		ControllerBusyTime: u128(96),
+		PowerOnHours:       u128(128),
+		UnsafeShutdowns:    u128(144),
+		MediaErrors:        u128(160),
+		ErrorLogEntries:    u128(176),
+	}, true
+}
+
+// nvmeGroups are the metric groups of the NVMe health log.
+var nvmeGroups = []struct {
+	Name    string
+	Type    string
+	Comment string
+	Value   func(nvmeHealth) float64
+}{
+	{"disk_nvme_critical_warning", "GAUGE", "This value is the critical warning bit field of the NVMe health log, 0 when the controller reports no critical condition.", func(h nvmeHealth) float64 { return float64(h.CriticalWarning) }},
+	{"disk_nvme_temperature_celsius", "GAUGE", "This value is the composite temperature of the NVMe controller in degrees Celsius.", func(h nvmeHealth) float64 { return float64(h.TemperatureKelvin) - 273.15 }},
+	{"disk_nvme_available_spare_percent", "GAUGE", "This value is the remaining spare capacity of the NVMe device in percent.", func(h nvmeHealth) float64 { return float64(h.AvailableSpare) }},
+	{"disk_nvme_available_spare_threshold_percent", "GAUGE", "This value is the available spare below which the NVMe device raises a critical warning, in percent.", func(h nvmeHealth) float64 { return float64(h.SpareThreshold) }},
+	{"disk_nvme_percentage_used", "GAUGE", "This value is the vendor estimate of the NVMe device life used in percent; it may exceed 100.", func(h nvmeHealth) float64 { return float64(h.PercentageUsed) }},
+	{"disk_nvme_controller_busy_minutes", "COUNTER", "This value counts the minutes the NVMe controller was busy with IO commands.", func(h nvmeHealth) float64 { return float64(h.ControllerBusyTime) }},
+	{"disk_nvme_power_on_hours", "COUNTER", "This value counts the hours the NVMe device was powered on.", func(h nvmeHealth) float64 { return float64(h.PowerOnHours) }},
+	{"disk_nvme_unsafe_shutdowns", "COUNTER", "This value counts the shutdowns of the NVMe device without prior notification.", func(h nvmeHealth) float64 { return float64(h.UnsafeShutdowns) }},
+	{"disk_nvme_media_errors", "COUNTER", "This value counts the unrecovered data integrity errors the NVMe controller detected.", func(h nvmeHealth) float64 { return float64(h.MediaErrors) }},
+	{"disk_nvme_error_log_entries", "COUNTER", "This value counts the entries in the error information log of the NVMe controller.", func(h nvmeHealth) float64 { return float64(h.ErrorLogEntries) }},
+}
+
+// smartAttribute is one entry of the ATA SMART attribute table.
+type smartAttribute struct {
+	ID    uint8
+	Value uint8
+	Worst uint8
+	Raw   uint64
+}
+
+// smartAttributeNames names the ATA SMART attributes whose meaning is the
+// same across vendors; others are tagged with their id only.
+var smartAttributeNames = map[uint8]string{
+	1:   "raw_read_error_rate",
+	5:   "reallocated_sector_count",
+	9:   "power_on_hours",
+	12:  "power_cycle_count",
+	177: "wear_leveling_count",
+	187: "reported_uncorrectable",
+	188: "command_timeout",
+	190: "airflow_temperature",
+	194: "temperature",
+	196: "reallocation_event_count",
+	197: "current_pending_sector",
+	198: "offline_uncorrectable",
+	199: "udma_crc_error_count",
+}
+
+// parseSMARTAttributes decodes the attribute table of the 512 byte SMART READ
+// DATA response: 30 entries of 12 bytes from offset 2, each an id, two flag
+// bytes, the normalized and worst values and a 48-bit raw value. Unused
+// entries have id 0.
+func parseSMARTAttributes(data []byte) ([]smartAttribute, bool) {
+	if len(data) < 362 {
+		return nil, false
+	}
+	var attrs []smartAttribute
+	for i := 0; i < 30; i++ {
+		e := data[2+12*i:]
+		if e[0] == 0 {
+			continue
+		}
+		var raw uint64
+		for j := 5; j >= 0; j-- {
+			raw = raw<<8 | uint64(e[5+j])
+		}
+		attrs = append(attrs, smartAttribute{ID: e[0], Value: e[3], Worst: e[4], Raw: raw})
+	}
+	return attrs, true
+}
+
+// smartTags returns the tags of the samples of attribute a of device.
+func smartTags(device string, a smartAttribute) map[string]string {
+	tags := map[string]string{"device": device, "attribute_id": strconv.Itoa(int(a.ID))}
+	if name, ok := smartAttributeNames[a.ID]; ok {
+		tags["attribute"] = name
+	}
+	return tags
+}
+
+// nvmeNamespace matches NVMe namespace block devices and captures their
+// controller: nvme0 for nvme0n1.
+var nvmeNamespace = regexp.MustCompile(`^(nvme[0-9]+)n[0-9]+$`)
+
+// nvmeController returns the controller character device name of an NVMe
+// namespace, or "" for other devices.
+func nvmeController(disk string) string {
+	m := nvmeNamespace.FindStringSubmatch(disk)
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+// smartData is what --smart could read from one disk: the NVMe health log
+// or the ATA SMART attributes.
+type smartData struct {
+	NVMe       *nvmeHealth
+	Attributes []smartAttribute
+}
+
+// readSMART reads the health data of a whole disk, given by its kernel
+// name: the health log from the controller of an NVMe namespace, the SMART
+// attributes through ATA pass-through otherwise.
+func readSMART(disk string) (smartData, error) {
+	if ctrl := nvmeController(disk); len(ctrl) > 0 {
+		log, err := nvmeHealthLog(hostDev(ctrl))
+		if err != nil {
+			return smartData{}, err
+		}
+		h, _ := parseNVMeHealth(log)
+		return smartData{NVMe: &h}, nil
+	}
+	data, err := ataSMARTData(hostDev(disk))
+	if err != nil {
+		return smartData{}, err
+	}
+	attrs, _ := parseSMARTAttributes(data)
+	return smartData{Attributes: attrs}, nil
+}
+
+// addSMARTMetrics adds the health data of one disk to the --smart groups.
+func addSMARTMetrics(groups map[string]*MetricGroup, device string, data smartData) {
+	if data.NVMe != nil {
+		for _, n := range nvmeGroups {
+			groups[n.Name].AddMetric(map[string]string{"device": device}, n.Value(*data.NVMe))
+		}
+	}
+	for _, a := range data.Attributes {
+		tags := smartTags(device, a)
+		groups["disk_smart_attribute_value"].AddIntMetric(tags, uint64(a.Value))
+		groups["disk_smart_attribute_raw"].AddIntMetric(tags, a.Raw)
+	}
+}
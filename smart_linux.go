@@ -0,0 +1,148 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// nvmeAdminCmd is struct nvme_admin_cmd from linux/nvme_ioctl.h.
+type nvmeAdminCmd struct {
+	Opcode      uint8
+	Flags       uint8
+	Rsvd1       uint16
+	NSID        uint32
+	Cdw2        uint32
+	Cdw3        uint32
+	Metadata    uint64
+	Addr        uint64
+	MetadataLen uint32
+	DataLen     uint32
+	Cdw10       uint32
+	Cdw11       uint32
+	Cdw12       uint32
+	Cdw13       uint32
+	Cdw14       uint32
+	Cdw15       uint32
+	TimeoutMs   uint32
+	Result      uint32
+}
+
+// nvmeIoctlAdminCmd is NVME_IOCTL_ADMIN_CMD, _IOWR('N', 0x41, struct
+// nvme_admin_cmd).
+const nvmeIoctlAdminCmd = 0xC0484E41
+
+// nvmeHealthLog reads the SMART / Health Information log page from an NVMe
+// controller character device such as /dev/nvme0.
+func nvmeHealthLog(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	log := make([]byte, nvmeHealthLogSize)
+	cmd := nvmeAdminCmd{
+		Opcode:  0x02, // Get Log Page
+		NSID:    0xffffffff,
+		Addr:    uint64(uintptr(unsafe.Pointer(&log[0]))),
+		DataLen: nvmeHealthLogSize,
+		// Number of dwords minus one, and log identifier 02h.
+		Cdw10:     (nvmeHealthLogSize/4-1)<<16 | 0x02,
+		TimeoutMs: 5000,
+	}
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, f.Fd(), nvmeIoctlAdminCmd, uintptr(unsafe.Pointer(&cmd)))
+	runtime.KeepAlive(log)
+	if errno != 0 {
+		return nil, errno
+	}
+	return log, nil
+}
+
+// sgIOHdr is struct sg_io_hdr from scsi/sg.h.
+type sgIOHdr struct {
+	InterfaceID    int32
+	DxferDirection int32
+	CmdLen         uint8
+	MxSbLen        uint8
+	IovecCount     uint16
+	DxferLen       uint32
+	Dxferp         uintptr
+	Cmdp           uintptr
+	Sbp            uintptr
+	Timeout        uint32
+	Flags          uint32
+	PackID         int32
+	UsrPtr         uintptr
+	Status         uint8
+	MaskedStatus   uint8
+	MsgStatus      uint8
+	SbLenWr        uint8
+	HostStatus     uint16
+	DriverStatus   uint16
+	Resid          int32
+	Duration       uint32
+	Info           uint32
+}
+
+const (
+	sgIO           = 0x2285
+	sgDxferFromDev = -3
+	sgInfoOKMask   = 0x1
+)
+
+// ataSMARTData issues SMART READ DATA to a SATA disk such as /dev/sda
+// through an ATA PASS-THROUGH (16) SCSI command, which libata translates.
+func ataSMARTData(path string) ([]byte, error) {
+	f, err := os.OpenFile(path, os.O_RDONLY|unix.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data := make([]byte, 512)
+	sense := make([]byte, 32)
+	cdb := []byte{
+		0x85,    // ATA PASS-THROUGH (16)
+		4 << 1,  // PIO data-in
+		0x0e,    // from the device, length in sectors from the count
+		0, 0xd0, // features: SMART READ DATA
+		0, 1, // one sector
+		0, 0, // LBA low
+		0, 0x4f, // LBA mid
+		0, 0xc2, // LBA high
+		0,    // device
+		0xb0, // SMART
+		0,    // control
+	}
+	hdr := sgIOHdr{
+		InterfaceID:    'S',
+		DxferDirection: sgDxferFromDev,
+		CmdLen:         uint8(len(cdb)),
+		MxSbLen:        uint8(len(sense)),
+		DxferLen:       uint32(len(data)),
+		Dxferp:         uintptr(unsafe.Pointer(&data[0])),
+		Cmdp:           uintptr(unsafe.Pointer(&cdb[0])),
+		Sbp:            uintptr(unsafe.Pointer(&sense[0])),
+		Timeout:        5000,
+	}
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, f.Fd(), sgIO, uintptr(unsafe.Pointer(&hdr)))
+	runtime.KeepAlive(data)
+	runtime.KeepAlive(sense)
+	runtime.KeepAlive(cdb)
+	if errno != 0 {
+		return nil, errno
+	}
+	if hdr.Info&sgInfoOKMask != 0 {
+		return nil, fmt.Errorf("SMART READ DATA failed with SCSI status %#x, host status %#x, driver status %#x", hdr.Status, hdr.HostStatus, hdr.DriverStatus)
+	}
+	if data[0] == 0 && data[1] == 0 && data[2] == 0 {
+		return nil, errors.New("device returned no SMART data")
+	}
+	return data, nil
+}
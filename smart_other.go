@@ -0,0 +1,19 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"errors"
+)
+
+// errSMARTUnsupported is returned by the SMART readers off Linux.
+var errSMARTUnsupported = errors.New("--smart is only supported on Linux")
+
+func nvmeHealthLog(path string) ([]byte, error) {
+	return nil, errSMARTUnsupported
+}
+
+func ataSMARTData(path string) ([]byte, error) {
+	return nil, errSMARTUnsupported
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestParseNVMeHealth(t *testing.T) {
+	if _, ok := parseNVMeHealth(make([]byte, 100)); ok {
+		t.Error("parseNVMeHealth accepted a short log")
+	}
+	log := make([]byte, nvmeHealthLogSize)
+	log[0] = 0x04
+	binary.LittleEndian.PutUint16(log[1:], 310)
+	log[3], log[4], log[5] = 98, 10, 7
+	binary.LittleEndian.PutUint64(log[96:], 1234)
+	binary.LittleEndian.PutUint64(log[128:], 8760)
+	binary.LittleEndian.PutUint64(log[144:], 12)
+	binary.LittleEndian.PutUint64(log[160:], 3)
+	binary.LittleEndian.PutUint64(log[176:], 42)
+	log[168] = 0xff // high half of media errors is ignored
+	h, ok := parseNVMeHealth(log)
+	if !ok {
+		t.Fatal("parseNVMeHealth rejected a full log")
+	}
+	want := nvmeHealth{
+		CriticalWarning:    4,
+		TemperatureKelvin:  310,
+		AvailableSpare:     98,
+		SpareThreshold:     10,
+		PercentageUsed:     7,
+		ControllerBusyTime: 1234,
+		PowerOnHours:       8760,
+		UnsafeShutdowns:    12,
+		MediaErrors:        3,
+		ErrorLogEntries:    42,
+	}
+	if h != want {
+		t.Errorf("parseNVMeHealth() = %+v, want %+v", h, want)
+	}
+}
+
+func TestParseSMARTAttributes(t *testing.T) {
+	data := make([]byte, 512)
+	// Reallocated sector count: value 100, worst 99, raw 8.
+	copy(data[2:], []byte{5, 0x33, 0, 100, 99, 8, 0, 0, 0, 0, 0, 0})
+	// Second entry unused, third is the temperature with a 48-bit raw value.
+	copy(data[26:], []byte{194, 0x22, 0, 64, 40, 0x24, 0, 0x10, 0, 0x2d, 0x01, 0})
+	attrs, ok := parseSMARTAttributes(data)
+	if !ok {
+		t.Fatal("parseSMARTAttributes rejected a full response")
+	}
+	want := []smartAttribute{
+		{ID: 5, Value: 100, Worst: 99, Raw: 8},
+		{ID: 194, Value: 64, Worst: 40, Raw: 0x012d00100024},
+	}
+	if len(attrs) != len(want) {
+		t.Fatalf("parseSMARTAttributes() = %+v, want %+v", attrs, want)
+	}
+	for i := range want {
+		if attrs[i] != want[i] {
+			t.Errorf("attribute %d = %+v, want %+v", i, attrs[i], want[i])
+		}
+	}
+	if _, ok := parseSMARTAttributes(data[:100]); ok {
+		t.Error("parseSMARTAttributes accepted a short response")
+	}
+}
+
+func TestNVMeController(t *testing.T) {
+	tests := map[string]string{
+		"nvme0n1":  "nvme0",
+		"nvme12n3": "nvme12",
+		"sda":      "",
+		"nvme0":    "",
+	}
+	for in, want := range tests {
+		if got := nvmeController(in); got != want {
+			t.Errorf("nvmeController(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
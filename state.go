@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jadiunr/check-disk-io/collector"
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// State is the data persisted between check executions.
+type State struct {
+	Timestamp int64                   `json:"timestamp"`
+	Devices   map[string]*DeviceState `json:"devices"`
+	// LatencySLOBreaches counts the runs in which a device exceeded
+	// --latency-slo-ms.
+	LatencySLOBreaches uint64 `json:"latency_slo_breaches,omitempty"`
+	// Sequence counts the successful runs that used this state file.
+	Sequence uint64 `json:"sequence,omitempty"`
+}
+
+// DeviceState is the per-device part of the persisted state.
+type DeviceState struct {
+	Counters disk.IOCountersStat `json:"counters"`
+	// Time is when Counters were sampled, in unix milliseconds.
+	Time         int64     `json:"time,omitempty"`
+	ReadLatency  []float64 `json:"read_latency,omitempty"`
+	WriteLatency []float64 `json:"write_latency,omitempty"`
+	// Unchanged counts the consecutive runs in which the counters did not
+	// move at all while IOs were in flight.
+	Unchanged int `json:"unchanged,omitempty"`
+	// Window holds the recent samples used by --rate-window.
+	Window []windowSample `json:"window,omitempty"`
+	// ReadRate and WriteRate are the recent byte rates used by
+	// --suggest-thresholds.
+	ReadRate  []float64 `json:"read_rate,omitempty"`
+	WriteRate []float64 `json:"write_rate,omitempty"`
+	// Anomaly holds the recent samples compared by --anomaly-factor.
+	Anomaly *anomalyHistory `json:"anomaly,omitempty"`
+	// Resets counts the runs in which the counters of the device went
+	// backwards, for disk_io_counter_resets_total.
+	Resets uint64 `json:"resets,omitempty"`
+	// Absent is set when the device was not seen in the latest run. Its
+	// entry is kept until --absent-retention has passed since Time, so a
+	// reappearing device can be recognized.
+	Absent bool `json:"absent,omitempty"`
+}
+
+// clampedDelta returns the increase of a counter between two samples, or 0
+// when it went backwards because the device was reset.
+func clampedDelta(prev, cur uint64) uint64 {
+	if cur < prev {
+		return 0
+	}
+	return cur - prev
+}
+
+// counterReset reports whether any cumulative counter of a device went
+// backwards between two samples, as after a driver reload or a live
+// migration. The IOs in flight are a gauge and may drop at any time.
+func counterReset(prev, cur disk.IOCountersStat) bool {
+	for _, b := range collector.Counters {
+		if b.Name != "disk_iops_in_progress" && b.Value(cur) < b.Value(prev) {
+			return true
+		}
+	}
+	return false
+}
+
+// pruneState marks the devices that were not seen in this run as absent and
+// drops those last seen longer than retention ago. nowMs is the time of the
+// run in unix milliseconds.
+func pruneState(state *State, seen map[string]bool, nowMs int64, retention time.Duration) {
+	for name, ds := range state.Devices {
+		if seen[name] {
+			continue
+		}
+		ds.Absent = true
+		if nowMs-ds.Time > retention.Milliseconds() {
+			delete(state.Devices, name)
+		}
+	}
+}
+
+// updateStuck updates the count of consecutive runs in which a device had
+// IOs in flight but none of its counters moved, and reports whether that
+// count reached threshold.
+func updateStuck(ds *DeviceState, cur disk.IOCountersStat, threshold int) bool {
+	if cur == ds.Counters && cur.IopsInProgress > 0 {
+		ds.Unchanged++
+	} else {
+		ds.Unchanged = 0
+	}
+	return ds.Unchanged >= threshold
+}
+
+// loadState reads the state file at path. A missing file is not an error and
+// yields an empty state, which is what the very first run sees.
+func loadState(path string) (*State, error) {
+	state := &State{Devices: map[string]*DeviceState{}}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return &State{Devices: map[string]*DeviceState{}}, err
+	}
+	if state.Devices == nil {
+		state.Devices = map[string]*DeviceState{}
+	}
+	return state, nil
+}
+
+// saveState writes the state atomically so a concurrent or interrupted run
+// never leaves a truncated file behind.
+func saveState(path string, state *State) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0600)
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it into place with the given permissions, creating the parent directory
+// if needed.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+func TestStateRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "state.json")
+
+	state, err := loadState(path)
+	if err != nil {
+		t.Fatalf("loading a missing state file: %v", err)
+	}
+	state.Devices["sda"] = &DeviceState{Counters: disk.IOCountersStat{Name: "sda", ReadCount: 7}}
+	if err := saveState(path, state); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := loadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ds := got.Devices["sda"]; ds == nil || ds.Counters.ReadCount != 7 {
+		t.Errorf("sda state = %+v", ds)
+	}
+}
+
+func TestUpdateStuck(t *testing.T) {
+	busy := disk.IOCountersStat{Name: "sda", ReadCount: 5, IopsInProgress: 3}
+	ds := &DeviceState{Counters: busy}
+	for i := 1; i < 3; i++ {
+		if updateStuck(ds, busy, 3) {
+			t.Fatalf("stuck after %d unchanged runs, threshold is 3", i)
+		}
+	}
+	if !updateStuck(ds, busy, 3) {
+		t.Errorf("not stuck after 3 unchanged runs")
+	}
+
+	moved := busy
+	moved.ReadCount++
+	if updateStuck(ds, moved, 3) || ds.Unchanged != 0 {
+		t.Errorf("moving counters must reset the stuck count")
+	}
+
+	idle := disk.IOCountersStat{Name: "sdb", ReadCount: 5}
+	ds = &DeviceState{Counters: idle}
+	for i := 0; i < 5; i++ {
+		if updateStuck(ds, idle, 3) {
+			t.Fatalf("an idle device without IOs in flight must not be stuck")
+		}
+	}
+}
+
+func TestPruneState(t *testing.T) {
+	now := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC).UnixNano() / int64(time.Millisecond)
+	state := &State{Devices: map[string]*DeviceState{
+		"sda": {Time: now},
+		"sdb": {Time: now - 60*1000},
+		"sdc": {Time: now - 2*3600*1000},
+		"sdd": {},
+	}}
+	pruneState(state, map[string]bool{"sda": true}, now, time.Hour)
+
+	if ds := state.Devices["sda"]; ds == nil || ds.Absent {
+		t.Errorf("seen device sda = %+v, want present", ds)
+	}
+	if ds := state.Devices["sdb"]; ds == nil || !ds.Absent {
+		t.Errorf("recently absent device sdb = %+v, want kept and marked absent", ds)
+	}
+	for _, name := range []string{"sdc", "sdd"} {
+		if _, ok := state.Devices[name]; ok {
+			t.Errorf("device %s absent for longer than the retention was kept", name)
+		}
+	}
+}
+
+func TestClampedDelta(t *testing.T) {
+	if got := clampedDelta(100, 250); got != 150 {
+		t.Errorf("clampedDelta(100, 250) = %d, want 150", got)
+	}
+	if got := clampedDelta(250, 100); got != 0 {
+		t.Errorf("clampedDelta after a reset = %d, want 0", got)
+	}
+}
+
+func TestCounterReset(t *testing.T) {
+	prev := disk.IOCountersStat{ReadBytes: 4096, ReadCount: 1, IopsInProgress: 8}
+	if counterReset(prev, disk.IOCountersStat{ReadBytes: 8192, ReadCount: 2}) {
+		t.Error("counterReset() = true for growing counters and fewer IOs in flight")
+	}
+	if !counterReset(prev, disk.IOCountersStat{ReadBytes: 8192}) {
+		t.Error("counterReset() = false with the read count going backwards")
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "disk_io.prom")
+	if err := writeFileAtomic(path, []byte("disk_io_up 1\n"), 0644); err != nil {
+		t.Fatalf("writeFileAtomic returned error: %v", err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil || string(data) != "disk_io_up 1\n" {
+		t.Errorf("file = %q, %v", data, err)
+	}
+	if runtime.GOOS != "windows" {
+		if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0644 {
+			t.Errorf("mode = %v, %v, want 0644", info.Mode(), err)
+		}
+	}
+	matches, _ := filepath.Glob(path + ".tmp*")
+	if len(matches) != 0 {
+		t.Errorf("temporary files left behind: %v", matches)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"math"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jadiunr/check-disk-io/output"
+)
+
+// statsdTimeout bounds resolving and writing to --statsd-addr.
+const statsdTimeout = 5 * time.Second
+
+// statsdMaxPacket is the largest datagram sent to StatsD, small enough to
+// avoid IP fragmentation on a standard 1500 byte MTU.
+const statsdMaxPacket = 1432
+
+// statsdEscaper replaces the characters that delimit the fields of a
+// DogStatsD line, which cannot appear in tag values.
+var statsdEscaper = strings.NewReplacer("|", "_", ",", "_", "\n", "_")
+
+// statsdLines renders the metric groups as DogStatsD lines such as
+//
+//	disk_read_bytes:1234|g|#device:sda,host:node1
+//
+// The *_delta groups of --emit-delta are the increase since the previous
+// run and become counters (c), which StatsD sums; everything else,
+// including the cumulative counters, is sent as a gauge (g) holding the
+// current value.
+func statsdLines(groups map[string]*MetricGroup) []string {
+	var lines []string
+	for _, name := range output.GroupNames(groups) {
+		g := groups[name]
+		kind := "g"
+		if strings.HasSuffix(g.Name, "_delta") {
+			kind = "c"
+		}
+		for _, m := range output.SortedMetrics(g.Metrics) {
+			if !m.IsInt && (math.IsNaN(m.Value) || math.IsInf(m.Value, 0)) {
+				continue
+			}
+			line := g.Name + ":" + m.FormatValue() + "|" + kind
+			if len(m.Tags) > 0 {
+				keys := make([]string, 0, len(m.Tags))
+				for k := range m.Tags {
+					keys = append(keys, k)
+				}
+				sort.Strings(keys)
+				tags := make([]string, 0, len(keys))
+				for _, k := range keys {
+					tags = append(tags, k+":"+statsdEscaper.Replace(m.Tags[k]))
+				}
+				line += "|#" + strings.Join(tags, ",")
+			}
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// statsdPackets joins lines with newlines into datagrams of at most max
+// bytes. A line longer than max gets a datagram of its own.
+func statsdPackets(lines []string, max int) [][]byte {
+	var packets [][]byte
+	var cur []byte
+	for _, line := range lines {
+		if len(cur) > 0 && len(cur)+1+len(line) > max {
+			packets = append(packets, cur)
+			cur = nil
+		}
+		if len(cur) > 0 {
+			cur = append(cur, '\n')
+		}
+		cur = append(cur, line...)
+	}
+	if len(cur) > 0 {
+		packets = append(packets, cur)
+	}
+	return packets
+}
+
+// sendStatsD sends the metric groups to a StatsD or DogStatsD server over
+// UDP. Delivery is not confirmed; only local errors, such as an address
+// that cannot be resolved or a refused port, are reported.
+func sendStatsD(addr string, groups map[string]*MetricGroup) error {
+	conn, err := net.DialTimeout("udp", addr, statsdTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetWriteDeadline(time.Now().Add(statsdTimeout)); err != nil {
+		return err
+	}
+	for _, p := range statsdPackets(statsdLines(groups), statsdMaxPacket) {
+		if _, err := conn.Write(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
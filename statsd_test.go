@@ -0,0 +1,63 @@
+package main
+
+import (
+	"math"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStatsDLines(t *testing.T) {
+	groups := map[string]*MetricGroup{
+		"disk_read_bytes": {Name: "disk_read_bytes", Type: "COUNTER", Metrics: []Metric{
+			{Tags: map[string]string{"device": "sda", "host": "node1"}, IntValue: 1234, IsInt: true},
+		}},
+		"disk_read_bytes_delta": {Name: "disk_read_bytes_delta", Type: "GAUGE", Metrics: []Metric{
+			{Tags: map[string]string{"device": "sda", "label": "a,b|c"}, IntValue: 10, IsInt: true},
+		}},
+		"disk_util_percent": {Name: "disk_util_percent", Type: "GAUGE", Metrics: []Metric{
+			{Tags: map[string]string{}, Value: 12.5},
+			{Tags: map[string]string{"device": "sdb"}, Value: math.NaN()},
+		}},
+	}
+	want := []string{
+		"disk_read_bytes:1234|g|#device:sda,host:node1",
+		"disk_read_bytes_delta:10|c|#device:sda,label:a_b_c",
+		"disk_util_percent:12.5|g",
+	}
+	if got := statsdLines(groups); !reflect.DeepEqual(got, want) {
+		t.Errorf("statsdLines() = %q, want %q", got, want)
+	}
+}
+
+func TestStatsDPackets(t *testing.T) {
+	got := statsdPackets([]string{"aaaa", "bbbb", "cccccccccccc", "dd"}, 10)
+	want := [][]byte{[]byte("aaaa\nbbbb"), []byte("cccccccccccc"), []byte("dd")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("statsdPackets() = %q, want %q", got, want)
+	}
+}
+
+func TestSendStatsD(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	groups := map[string]*MetricGroup{
+		"disk_read_bytes": {Name: "disk_read_bytes", Metrics: []Metric{{Tags: map[string]string{"device": "sda"}, IntValue: 1, IsInt: true}}},
+	}
+	if err := sendStatsD(conn.LocalAddr().String(), groups); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, statsdMaxPacket)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(buf[:n]); got != "disk_read_bytes:1|g|#device:sda" {
+		t.Errorf("received %q", got)
+	}
+}
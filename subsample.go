@@ -0,0 +1,150 @@
+package main
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/jadiunr/check-disk-io/collector"
+	"github.com/jadiunr/check-disk-io/thresholds"
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// subSampleSeries are the values of one device in the sub-intervals of
+// --sub-sample-interval. An await is only present for sub-intervals in which
+// IOs of that kind completed; Await covers reads and writes together.
+type subSampleSeries struct {
+	Util       []float64
+	ReadAwait  []float64
+	WriteAwait []float64
+	Await      []float64
+}
+
+// subSamples computes the series of every device from the first --rate
+// sample and the snapshots taken after it, comparing each sample with the
+// previous one. A device missing from a sample, or whose counters went
+// backwards, is skipped for that sub-interval.
+func subSamples(first map[string]disk.IOCountersStat, snapshots []collector.Snapshot) map[string]*subSampleSeries {
+	series := map[string]*subSampleSeries{}
+	prev, prevOffset := first, int64(0)
+	for _, snap := range snapshots {
+		elapsedMs := float64(snap.Offset.Milliseconds() - prevOffset)
+		for name, cur := range snap.Stats {
+			p, ok := prev[name]
+			if !ok {
+				continue
+			}
+			values, ok := iostatValues(p, cur, elapsedMs)
+			if !ok {
+				continue
+			}
+			s := series[name]
+			if s == nil {
+				s = &subSampleSeries{}
+				series[name] = s
+			}
+			s.Util = append(s.Util, values["disk_util_percent"])
+			if v, ok := values["disk_read_await_ms"]; ok {
+				s.ReadAwait = append(s.ReadAwait, v)
+			}
+			if v, ok := values["disk_write_await_ms"]; ok {
+				s.WriteAwait = append(s.WriteAwait, v)
+			}
+			if v, ok := thresholds.AverageLatency(p.ReadTime+p.WriteTime, cur.ReadTime+cur.WriteTime, p.ReadCount+p.WriteCount, cur.ReadCount+cur.WriteCount); ok {
+				s.Await = append(s.Await, v)
+			}
+		}
+		prev, prevOffset = snap.Stats, snap.Offset.Milliseconds()
+	}
+	return series
+}
+
+// minMax returns the smallest and largest of values, which must not be
+// empty.
+func minMax(values []float64) (min, max float64) {
+	min, max = math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		min = math.Min(min, v)
+		max = math.Max(max, v)
+	}
+	return min, max
+}
+
+// subSampleGroup is one min, max or p95 group of --sub-sample-interval.
+type subSampleGroup struct {
+	Name    string
+	Comment string
+	// Series selects the values of the device the group summarizes.
+	Series func(*subSampleSeries) []float64
+	Stat   func([]float64) float64
+}
+
+// subSampleGroups are the min, max and p95 groups of --sub-sample-interval,
+// named after the iostat group they summarize.
+var subSampleGroups = func() []subSampleGroup {
+	var groups []subSampleGroup
+	for _, base := range []struct {
+		name, what string
+		series     func(*subSampleSeries) []float64
+	}{
+		{"disk_util_percent", "share of the sub-interval the device was busy, in percent", func(s *subSampleSeries) []float64 { return s.Util }},
+		{"disk_read_await_ms", "average time in milliseconds per read completed in the sub-interval", func(s *subSampleSeries) []float64 { return s.ReadAwait }},
+		{"disk_write_await_ms", "average time in milliseconds per write completed in the sub-interval", func(s *subSampleSeries) []float64 { return s.WriteAwait }},
+	} {
+		for _, stat := range []struct {
+			suffix, what string
+			value        func([]float64) float64
+		}{
+			{"min", "lowest", func(v []float64) float64 { min, _ := minMax(v); return min }},
+			{"max", "highest", func(v []float64) float64 { _, max := minMax(v); return max }},
+			{"p95", "95th percentile of the", func(v []float64) float64 { return percentile(v, 95) }},
+		} {
+			groups = append(groups, subSampleGroup{
+				Name:    base.name + "_" + stat.suffix,
+				Comment: "This value is the " + stat.what + " " + base.what + ", over the sub-intervals of --sub-sample-interval within --interval.",
+				Series:  base.series,
+				Stat:    stat.value,
+			})
+		}
+	}
+	return groups
+}()
+
+// subSampleAwaitGroup is the histogram of the average await of the
+// sub-intervals.
+const subSampleAwaitGroup = "disk_sub_sample_await_seconds_bucket"
+
+// subSampleAwaitBuckets are the upper bounds in seconds of the
+// subSampleAwaitGroup buckets, from fast NVMe to stalled disks.
+var subSampleAwaitBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+
+// addSubSampleMetrics adds the summaries and the await histogram of one
+// device to the --sub-sample-interval groups present in groups.
+func addSubSampleMetrics(groups map[string]*MetricGroup, tags map[string]string, s *subSampleSeries) {
+	for _, g := range subSampleGroups {
+		if mg, ok := groups[g.Name]; ok && len(g.Series(s)) > 0 {
+			mg.AddMetric(tags, g.Stat(g.Series(s)))
+		}
+	}
+	g, ok := groups[subSampleAwaitGroup]
+	if !ok {
+		return
+	}
+	for i := 0; i <= len(subSampleAwaitBuckets); i++ {
+		le := "+Inf"
+		count := uint64(len(s.Await))
+		if i < len(subSampleAwaitBuckets) {
+			le = strconv.FormatFloat(subSampleAwaitBuckets[i], 'g', -1, 64)
+			count = 0
+			for _, ms := range s.Await {
+				if ms/1000 <= subSampleAwaitBuckets[i] {
+					count++
+				}
+			}
+		}
+		bucketTags := map[string]string{"le": le}
+		for k, v := range tags {
+			bucketTags[k] = v
+		}
+		g.AddIntMetric(bucketTags, count)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jadiunr/check-disk-io/collector"
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+func TestSubSamples(t *testing.T) {
+	first := map[string]disk.IOCountersStat{"sda": {Name: "sda"}}
+	// A stall in the second sub-interval: 10 reads taking 200ms each
+	// while the device is busy for the whole 500ms.
+	snapshots := []collector.Snapshot{
+		{Offset: 500 * time.Millisecond, Stats: map[string]disk.IOCountersStat{
+			"sda": {Name: "sda", ReadCount: 100, ReadTime: 100, IoTime: 50},
+			"sdb": {Name: "sdb"},
+		}},
+		{Offset: time.Second, Stats: map[string]disk.IOCountersStat{
+			"sda": {Name: "sda", ReadCount: 110, ReadTime: 2100, IoTime: 550},
+		}},
+		{Offset: 1500 * time.Millisecond, Stats: map[string]disk.IOCountersStat{
+			"sda": {Name: "sda", ReadCount: 110, ReadTime: 2100, IoTime: 550, WriteCount: 5, WriteTime: 5},
+		}},
+	}
+	series := subSamples(first, snapshots)
+	if _, ok := series["sdb"]; ok {
+		t.Errorf("sdb, missing from the first sample, has a series")
+	}
+	s := series["sda"]
+	if s == nil || len(s.Util) != 3 || s.Util[1] != 100 || len(s.ReadAwait) != 2 || s.ReadAwait[1] != 200 || len(s.WriteAwait) != 1 || len(s.Await) != 3 {
+		t.Fatalf("subSamples() = %+v", s)
+	}
+
+	groups := map[string]*MetricGroup{subSampleAwaitGroup: {Name: subSampleAwaitGroup}}
+	for _, g := range subSampleGroups {
+		groups[g.Name] = &MetricGroup{Name: g.Name}
+	}
+	addSubSampleMetrics(groups, map[string]string{"device": "sda"}, s)
+	for name, want := range map[string]float64{
+		"disk_read_await_ms_min":  1,
+		"disk_read_await_ms_max":  200,
+		"disk_util_percent_max":   100,
+		"disk_write_await_ms_p95": 1,
+	} {
+		if m := groups[name].Metrics; len(m) != 1 || m[0].Value != want {
+			t.Errorf("%s = %+v, want %v", name, m, want)
+		}
+	}
+	buckets := map[string]uint64{}
+	for _, m := range groups[subSampleAwaitGroup].Metrics {
+		buckets[m.Tags["le"]] = m.IntValue
+	}
+	if len(buckets) != len(subSampleAwaitBuckets)+1 || buckets["0.001"] != 2 || buckets["0.1"] != 2 || buckets["0.25"] != 3 || buckets["+Inf"] != 3 {
+		t.Errorf("await buckets = %v", buckets)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jadiunr/check-disk-io/thresholds"
+	"github.com/sensu/sensu-plugin-sdk/sensu"
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// deviceLoad is how busy a device was between two samples, for the
+// --summary-top ranking.
+type deviceLoad struct {
+	Device string
+	// Util is the share of the interval the device was busy, in percent.
+	Util float64
+	// Throughput is the bytes read and written per second.
+	Throughput float64
+}
+
+// loadOf returns the load of a device between two samples taken elapsedMs
+// apart. ok is false when a counter went backwards.
+func loadOf(device string, prev, cur disk.IOCountersStat, elapsedMs int64) (load deviceLoad, ok bool) {
+	values, ok := iostatValues(prev, cur, float64(elapsedMs))
+	if !ok {
+		return deviceLoad{}, false
+	}
+	read, write, ok := thresholds.ByteRates(prev, cur, elapsedMs)
+	if !ok {
+		return deviceLoad{}, false
+	}
+	return deviceLoad{Device: device, Util: values["disk_util_percent"], Throughput: read + write}, true
+}
+
+// summaryLine renders the violations and the busiest devices as one line
+// for alert notifications, e.g. "CRITICAL: nvme0n1 write await 38.0ms (crit
+// 20ms); busiest: sda 97% 410.0MiB/s". At most top violations, the most
+// severe first, and top devices by utilization are listed. It is empty when
+// nothing was violated.
+func summaryLine(violations []thresholds.Violation, loads []deviceLoad, top int) string {
+	if len(violations) == 0 || top < 1 {
+		return ""
+	}
+	sorted := append([]thresholds.Violation(nil), violations...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].State > sorted[j].State })
+	level := "WARNING"
+	if sorted[0].State == sensu.CheckStateCritical {
+		level = "CRITICAL"
+	}
+	var parts []string
+	for i, v := range sorted {
+		if i == top {
+			parts[len(parts)-1] += fmt.Sprintf(" and %d more", len(sorted)-top)
+			break
+		}
+		parts = append(parts, v.Brief())
+	}
+	line := level + ": " + strings.Join(parts, ", ")
+
+	busiest := append([]deviceLoad(nil), loads...)
+	sort.SliceStable(busiest, func(i, j int) bool {
+		if busiest[i].Util != busiest[j].Util {
+			return busiest[i].Util > busiest[j].Util
+		}
+		return busiest[i].Throughput > busiest[j].Throughput
+	})
+	if len(busiest) > top {
+		busiest = busiest[:top]
+	}
+	var devices []string
+	for _, l := range busiest {
+		devices = append(devices, fmt.Sprintf("%s %.0f%% %s/s", l.Device, l.Util, thresholds.FormatSize(l.Throughput)))
+	}
+	if len(devices) > 0 {
+		line += "; busiest: " + strings.Join(devices, ", ")
+	}
+	return line
+}
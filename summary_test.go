@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/jadiunr/check-disk-io/thresholds"
+	"github.com/sensu/sensu-plugin-sdk/sensu"
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+func TestLoadOf(t *testing.T) {
+	prev := disk.IOCountersStat{IoTime: 1000, ReadBytes: 0, WriteBytes: 0}
+	cur := disk.IOCountersStat{IoTime: 1500, ReadBytes: 1 << 20, WriteBytes: 1 << 20}
+	load, ok := loadOf("sda", prev, cur, 1000)
+	if !ok || load != (deviceLoad{Device: "sda", Util: 50, Throughput: 2 << 20}) {
+		t.Errorf("loadOf() = %+v, %v, want 50%% and 2MiB/s", load, ok)
+	}
+	if _, ok := loadOf("sda", cur, prev, 1000); ok {
+		t.Errorf("loadOf() with counters going backwards returned ok")
+	}
+}
+
+func TestSummaryLine(t *testing.T) {
+	violations := []thresholds.Violation{
+		{State: sensu.CheckStateWarning, Device: "sda", Direction: "read", Rate: 150 << 20, Limit: 100 << 20},
+		{State: sensu.CheckStateCritical, Device: "nvme0n1", Direction: "write await", Rate: 38, Limit: 20, Unit: "ms"},
+		{State: sensu.CheckStateWarning, Device: "sdb", Direction: "iops in progress", Rate: 40, Limit: 32, Count: true},
+	}
+	loads := []deviceLoad{
+		{Device: "sdb", Util: 12, Throughput: 1 << 20},
+		{Device: "sda", Util: 97, Throughput: 410 << 20},
+		{Device: "nvme0n1", Util: 40, Throughput: 12 << 20},
+	}
+	want := "CRITICAL: nvme0n1 write await 38.0ms (crit 20ms), sda read 150.0MiB/s (warn 100.0MiB/s) and 1 more; busiest: sda 97% 410.0MiB/s, nvme0n1 40% 12.0MiB/s"
+	if got := summaryLine(violations, loads, 2); got != want {
+		t.Errorf("summaryLine() = %q, want %q", got, want)
+	}
+	if got := summaryLine(violations[2:], nil, 3); got != "WARNING: sdb iops in progress 40 (warn 32)" {
+		t.Errorf("summaryLine() without loads = %q", got)
+	}
+	if got := summaryLine(nil, loads, 3); got != "" {
+		t.Errorf("summaryLine() without violations = %q, want empty", got)
+	}
+}
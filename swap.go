@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// hostProc joins parts onto the procfs root, honouring HOST_PROC the same
+// way gopsutil does.
+func hostProc(parts ...string) string {
+	root := os.Getenv("HOST_PROC")
+	if len(root) == 0 {
+		root = "/proc"
+	}
+	return filepath.Join(append([]string{root}, parts...)...)
+}
+
+// swapDevices returns the kernel names of the block devices listed as swap
+// partitions in /proc/swaps. Swap files are ignored since the device they
+// live on also holds regular data. Device-mapper paths such as
+// /dev/mapper/vg-swap are resolved to their dm-N name when possible.
+func swapDevices() (map[string]bool, error) {
+	data, err := ioutil.ReadFile(hostProc("swaps"))
+	if err != nil {
+		return nil, err
+	}
+	devices := map[string]bool{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[1] != "partition" {
+			continue
+		}
+		path := fields[0]
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			path = resolved
+		}
+		devices[filepath.Base(path)] = true
+	}
+	return devices, scanner.Err()
+}
+
+// isSwapDevice reports whether the device is memory-backed swap (zram) or
+// one of the given swap partitions.
+func isSwapDevice(name string, swaps map[string]bool) bool {
+	return strings.HasPrefix(name, "zram") || swaps[name]
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSwapDevices(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("HOST_PROC", root)
+	writeSysFile(t, root, "swaps", `Filename				Type		Size		Used		Priority
+/dev/sda2                               partition	8388604		0		-2
+/swapfile                               file		2097148		0		-3
+/dev/zram0                              partition	4194300		512		100
+`)
+
+	swaps, err := swapDevices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !swaps["sda2"] || !swaps["zram0"] || swaps["swapfile"] {
+		t.Errorf("swapDevices() = %v, want sda2 and zram0", swaps)
+	}
+
+	if !isSwapDevice("zram1", nil) {
+		t.Errorf("zram devices are always swap")
+	}
+	if isSwapDevice("sda1", swaps) {
+		t.Errorf("sda1 is not a swap device")
+	}
+}
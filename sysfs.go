@@ -0,0 +1,120 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// hostSys joins parts onto the sysfs root, honouring HOST_SYS the same way
+// gopsutil does so that enrichment and collection read the same tree.
+func hostSys(parts ...string) string {
+	root := os.Getenv("HOST_SYS")
+	if len(root) == 0 {
+		root = "/sys"
+	}
+	return filepath.Join(append([]string{root}, parts...)...)
+}
+
+// exportHostRoots points HOST_PROC and HOST_SYS at the given host mounts,
+// for --host-proc and --host-sys, so gopsutil and the enrichment code read
+// the host's tree instead of the container's. An empty path leaves the
+// variable alone.
+func exportHostRoots(proc, sys string) error {
+	if len(proc) > 0 {
+		if err := os.Setenv("HOST_PROC", proc); err != nil {
+			return err
+		}
+	}
+	if len(sys) > 0 {
+		if err := os.Setenv("HOST_SYS", sys); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readSysString returns the trimmed content of a sysfs attribute file.
+func readSysString(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// pathExists reports whether path exists.
+func pathExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// isPartition reports whether a block device is a partition of another one.
+func isPartition(device string) bool {
+	return pathExists(hostSys("class", "block", device, "partition"))
+}
+
+// parentDevice returns the device a partition belongs to, such as sda for
+// sda1 or nvme0n1 for nvme0n1p1, from its place in the sysfs device tree.
+// Devices that are not partitions, or whose parent cannot be determined,
+// are returned as they are.
+func parentDevice(device string) string {
+	if !isPartition(device) {
+		return device
+	}
+	path, err := filepath.EvalSymlinks(hostSys("class", "block", device))
+	if err != nil {
+		return device
+	}
+	return filepath.Base(filepath.Dir(path))
+}
+
+// cacheRole returns the role a block device plays in a bcache or dm-cache
+// stack: "cache" for the fast caching device, "backing" for the slow origin
+// device and "none" otherwise.
+//
+// bcache registers a bcache directory on both members; only the backing
+// device has a cache_mode attribute, while the caching device links to its
+// cache set. dm-cache exposes no role in sysfs, so the names lvmcache gives
+// its hidden sub-volumes (_corig, _cdata and _cmeta) are used instead.
+func cacheRole(device string) string {
+	bcache := hostSys("class", "block", device, "bcache")
+	if pathExists(bcache) {
+		if pathExists(filepath.Join(bcache, "cache_mode")) {
+			return "backing"
+		}
+		if pathExists(filepath.Join(bcache, "set")) {
+			return "cache"
+		}
+	}
+
+	if name, err := readSysString(hostSys("class", "block", device, "dm", "name")); err == nil {
+		switch {
+		case strings.HasSuffix(name, "_corig"):
+			return "backing"
+		case strings.HasSuffix(name, "_cdata"), strings.HasSuffix(name, "_cmeta"):
+			return "cache"
+		}
+	}
+	return "none"
+}
+
+// sysSectorSize is the unit of the sysfs size attribute. The kernel always
+// reports it in 512-byte sectors, whatever the logical block size of the
+// device is.
+const sysSectorSize = 512
+
+// deviceSize returns the size of a block device in bytes from sysfs.
+func deviceSize(device string) (uint64, error) {
+	str, err := readSysString(hostSys("class", "block", device, "size"))
+	if err != nil {
+		return 0, err
+	}
+	sectors, err := strconv.ParseUint(str, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return sectors * sysSectorSize, nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/jadiunr/check-disk-io/collector"
+)
+
+// writeSysFile creates a file below a fake sysfs root.
+func writeSysFile(t *testing.T, root, path, content string) {
+	t.Helper()
+	full := filepath.Join(root, path)
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(full, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCacheRole(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("HOST_SYS", root)
+
+	writeSysFile(t, root, "class/block/sdb/bcache/cache_mode", "writethrough [writeback]\n")
+	writeSysFile(t, root, "class/block/nvme0n1/bcache/set/bucket_size", "512k\n")
+	writeSysFile(t, root, "class/block/dm-1/dm/name", "vg-data_corig\n")
+	writeSysFile(t, root, "class/block/dm-2/dm/name", "vg-fast_cdata\n")
+	writeSysFile(t, root, "class/block/dm-3/dm/name", "vg-root\n")
+
+	tests := map[string]string{
+		"sdb":     "backing",
+		"nvme0n1": "cache",
+		"dm-1":    "backing",
+		"dm-2":    "cache",
+		"dm-3":    "none",
+		"sda":     "none",
+	}
+	for device, want := range tests {
+		if got := cacheRole(device); got != want {
+			t.Errorf("cacheRole(%q) = %q, want %q", device, got, want)
+		}
+	}
+}
+
+func TestDeviceSize(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("HOST_SYS", root)
+	writeSysFile(t, root, "class/block/sda/size", "7814037168\n")
+
+	size, err := deviceSize("sda")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 7814037168*512 {
+		t.Errorf("deviceSize(sda) = %d", size)
+	}
+	if _, err := deviceSize("sdb"); err == nil {
+		t.Errorf("expected an error for a missing device")
+	}
+}
+
+func TestParentDevice(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("HOST_SYS", root)
+	// Like the kernel, class/block holds symlinks into the device tree,
+	// where partitions are directories of their parent.
+	writeSysFile(t, root, "devices/pci0000:00/nvme/nvme0n1/nvme0n1p2/partition", "2\n")
+	writeSysFile(t, root, "devices/pci0000:00/nvme/nvme0n1/size", "1000\n")
+	if err := os.MkdirAll(filepath.Join(root, "class", "block"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, link := range []string{"nvme0n1", "nvme0n1/nvme0n1p2"} {
+		target := filepath.Join("..", "..", "devices", "pci0000:00", "nvme", link)
+		if err := os.Symlink(target, filepath.Join(root, "class", "block", filepath.Base(link))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for device, want := range map[string]string{"nvme0n1p2": "nvme0n1", "nvme0n1": "nvme0n1", "sdz1": "sdz1"} {
+		if got := parentDevice(device); got != want {
+			t.Errorf("parentDevice(%s) = %s, want %s", device, got, want)
+		}
+	}
+}
+
+func TestExportHostRoots(t *testing.T) {
+	t.Setenv("HOST_PROC", "/proc")
+	t.Setenv("HOST_SYS", "/sys")
+
+	if err := exportHostRoots("", ""); err != nil {
+		t.Fatalf("exportHostRoots returned error: %v", err)
+	}
+	if os.Getenv("HOST_PROC") != "/proc" || os.Getenv("HOST_SYS") != "/sys" {
+		t.Errorf("empty flags changed the environment: HOST_PROC=%q HOST_SYS=%q", os.Getenv("HOST_PROC"), os.Getenv("HOST_SYS"))
+	}
+
+	root := t.TempDir()
+	if err := exportHostRoots(filepath.Join(root, "proc"), filepath.Join(root, "sys")); err != nil {
+		t.Fatalf("exportHostRoots returned error: %v", err)
+	}
+	if got := hostProc("swaps"); got != filepath.Join(root, "proc", "swaps") {
+		t.Errorf("hostProc() = %q after --host-proc", got)
+	}
+	if got := hostSys("block"); got != filepath.Join(root, "sys", "block") {
+		t.Errorf("hostSys() = %q after --host-sys", got)
+	}
+
+	if runtime.GOOS != "linux" {
+		return
+	}
+	writeSysFile(t, root, "proc/diskstats", "   8       0 hosta 10 0 80 4 0 0 0 0 0 4 4 0 0 0 0\n")
+	stats, err := collector.New().IOCounters()
+	if err != nil {
+		t.Fatalf("IOCounters returned error: %v", err)
+	}
+	if _, ok := stats["hosta"]; !ok || len(stats) != 1 {
+		t.Errorf("IOCounters() = %v, want only the device of the host's diskstats", stats)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jadiunr/check-disk-io/thresholds"
+)
+
+// parseDeviceThreshold parses a --device-threshold entry of the form
+// "sda:write-crit=100MiB,read-warn=50MiB" into the resolved device name and
+// its limits.
+func parseDeviceThreshold(entry string) (string, thresholds.ByteRateLimits, error) {
+	var limits thresholds.ByteRateLimits
+	i := strings.LastIndex(entry, ":")
+	if i <= 0 || i == len(entry)-1 {
+		return "", limits, fmt.Errorf("%q: expected <device>:<limit>=<size>[,...]", entry)
+	}
+	device := resolveDevice(entry[:i])
+
+	for _, kv := range strings.Split(entry[i+1:], ",") {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 {
+			return "", limits, fmt.Errorf("%q: expected <limit>=<size>, got %q", entry, kv)
+		}
+		size, err := thresholds.ParseSize(parts[1])
+		if err != nil {
+			return "", limits, fmt.Errorf("%q: %v", entry, err)
+		}
+		var field *uint64
+		switch strings.TrimSpace(parts[0]) {
+		case "read-warn":
+			field = &limits.ReadWarn
+		case "read-crit":
+			field = &limits.ReadCrit
+		case "write-warn":
+			field = &limits.WriteWarn
+		case "write-crit":
+			field = &limits.WriteCrit
+		default:
+			return "", limits, fmt.Errorf("%q: unknown limit %q, must be read-warn, read-crit, write-warn or write-crit", entry, parts[0])
+		}
+		if *field != 0 {
+			return "", limits, fmt.Errorf("%q: %s given twice", entry, parts[0])
+		}
+		*field = size
+	}
+
+	if limits.ReadWarn > 0 && limits.ReadCrit > 0 && limits.ReadWarn > limits.ReadCrit {
+		return "", limits, fmt.Errorf("%q: read-warn is above read-crit", entry)
+	}
+	if limits.WriteWarn > 0 && limits.WriteCrit > 0 && limits.WriteWarn > limits.WriteCrit {
+		return "", limits, fmt.Errorf("%q: write-warn is above write-crit", entry)
+	}
+	return device, limits, nil
+}
+
+// joinThresholdEntries undoes the comma splitting the flag library applies
+// to repeatable flags: a piece without a device prefix continues the
+// previous entry, so "sda:read-warn=1MiB,write-warn=2MiB" stays one entry.
+func joinThresholdEntries(values []string) []string {
+	var entries []string
+	for _, v := range values {
+		if n := len(entries); n > 0 && !strings.Contains(v, ":") {
+			entries[n-1] += "," + v
+			continue
+		}
+		entries = append(entries, v)
+	}
+	return entries
+}
+
+// suggestMinSamples is the number of throughput samples --suggest-thresholds
+// needs before it makes a suggestion; fewer runs rarely include a busy
+// period.
+const suggestMinSamples = 10
+
+// suggestThresholds returns a --device-threshold entry derived from the
+// throughput history of a device: warning at 1.5 times the p95 and critical
+// at 3 times the p95 of the observed rates. Limits of directions without any
+// traffic are left out. ok is false while the history is too short.
+func suggestThresholds(device string, readRates, writeRates []float64) (string, bool) {
+	if len(readRates) < suggestMinSamples || len(writeRates) < suggestMinSamples {
+		return "", false
+	}
+	var limits []string
+	for _, dir := range []struct {
+		name  string
+		rates []float64
+	}{{"read", readRates}, {"write", writeRates}} {
+		p95 := percentile(dir.rates, 95)
+		if p95 < 1 {
+			continue
+		}
+		limits = append(limits,
+			dir.name+"-warn="+thresholds.FormatSize(p95*1.5),
+			dir.name+"-crit="+thresholds.FormatSize(p95*3))
+	}
+	if len(limits) == 0 {
+		return "", false
+	}
+	return device + ":" + strings.Join(limits, ","), true
+}
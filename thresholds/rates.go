@@ -0,0 +1,35 @@
+package thresholds
+
+import "github.com/shirou/gopsutil/v3/disk"
+
+// ByteRates returns the read and write throughput in bytes per second
+// between two samples taken elapsedMs apart. ok is false when the counters
+// went backwards.
+func ByteRates(prev, cur disk.IOCountersStat, elapsedMs int64) (read, write float64, ok bool) {
+	if elapsedMs <= 0 || cur.ReadBytes < prev.ReadBytes || cur.WriteBytes < prev.WriteBytes {
+		return 0, 0, false
+	}
+	elapsed := float64(elapsedMs) / 1000
+	return float64(cur.ReadBytes-prev.ReadBytes) / elapsed, float64(cur.WriteBytes-prev.WriteBytes) / elapsed, true
+}
+
+// IopsRates returns the reads and writes completed per second between two
+// samples taken elapsedMs apart. ok is false when the counters went
+// backwards.
+func IopsRates(prev, cur disk.IOCountersStat, elapsedMs int64) (read, write float64, ok bool) {
+	if elapsedMs <= 0 || cur.ReadCount < prev.ReadCount || cur.WriteCount < prev.WriteCount {
+		return 0, 0, false
+	}
+	elapsed := float64(elapsedMs) / 1000
+	return float64(cur.ReadCount-prev.ReadCount) / elapsed, float64(cur.WriteCount-prev.WriteCount) / elapsed, true
+}
+
+// AverageLatency returns the average time in milliseconds spent per IO
+// between two samples of a time and a count counter. ok is false when no IO
+// completed in between or the counters went backwards (device reset).
+func AverageLatency(prevTime, curTime, prevCount, curCount uint64) (latency float64, ok bool) {
+	if curTime < prevTime || curCount <= prevCount {
+		return 0, false
+	}
+	return float64(curTime-prevTime) / float64(curCount-prevCount), true
+}
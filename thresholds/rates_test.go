@@ -0,0 +1,41 @@
+package thresholds
+
+import (
+	"testing"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+func TestIopsRates(t *testing.T) {
+	prev := disk.IOCountersStat{ReadCount: 100, WriteCount: 1000}
+	read, write, ok := IopsRates(prev, disk.IOCountersStat{ReadCount: 300, WriteCount: 1500}, 2000)
+	if !ok || read != 100 || write != 250 {
+		t.Errorf("IopsRates = %v, %v, %v, want 100, 250, true", read, write, ok)
+	}
+	if _, _, ok := IopsRates(prev, disk.IOCountersStat{}, 2000); ok {
+		t.Error("IopsRates accepted counters that went backwards")
+	}
+}
+
+func TestByteRates(t *testing.T) {
+	prev := disk.IOCountersStat{ReadBytes: 1000, WriteBytes: 5000}
+	cur := disk.IOCountersStat{ReadBytes: 3000, WriteBytes: 5000}
+	if r, w, ok := ByteRates(prev, cur, 2000); !ok || r != 1000 || w != 0 {
+		t.Errorf("ByteRates = %v, %v, %v, want 1000, 0, true", r, w, ok)
+	}
+	if _, _, ok := ByteRates(cur, prev, 2000); ok {
+		t.Errorf("ByteRates with reset counters should not be ok")
+	}
+}
+
+func TestAverageLatency(t *testing.T) {
+	if l, ok := AverageLatency(100, 400, 10, 20); !ok || l != 30 {
+		t.Errorf("AverageLatency = %v, %v, want 30, true", l, ok)
+	}
+	if _, ok := AverageLatency(100, 400, 10, 10); ok {
+		t.Errorf("AverageLatency with no completed IO should not be ok")
+	}
+	if _, ok := AverageLatency(400, 100, 10, 20); ok {
+		t.Errorf("AverageLatency with reset counters should not be ok")
+	}
+}
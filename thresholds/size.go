@@ -0,0 +1,78 @@
+package thresholds
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// sizeUnits maps the accepted size suffixes (lower-cased, without the
+// trailing "b") to their multiplier. Single-letter and "xB" suffixes are SI
+// (powers of 1000), "xiB" suffixes are binary (powers of 1024).
+var sizeUnits = map[string]float64{
+	"":   1,
+	"k":  1e3,
+	"m":  1e6,
+	"g":  1e9,
+	"t":  1e12,
+	"p":  1e15,
+	"ki": 1 << 10,
+	"mi": 1 << 20,
+	"gi": 1 << 30,
+	"ti": 1 << 40,
+	"pi": 1 << 50,
+}
+
+// ParseSize converts a human-friendly size such as "500MiB", "50k" or
+// "1.5GB" into a number of bytes. A trailing "/s" is accepted so rates can be
+// written as "100MiB/s".
+func ParseSize(s string) (uint64, error) {
+	str := strings.TrimSpace(s)
+	str = strings.TrimSuffix(str, "/s")
+	if len(str) == 0 {
+		return 0, fmt.Errorf("invalid size %q: empty value", s)
+	}
+
+	i := 0
+	for i < len(str) && (str[i] >= '0' && str[i] <= '9' || str[i] == '.') {
+		i++
+	}
+	if i == 0 {
+		return 0, fmt.Errorf("invalid size %q: missing number", s)
+	}
+	num, err := strconv.ParseFloat(str[:i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %v", s, err)
+	}
+
+	unit := strings.ToLower(strings.TrimSpace(str[i:]))
+	unit = strings.TrimSuffix(unit, "b")
+	mult, ok := sizeUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("invalid size %q: unknown unit %q", s, strings.TrimSpace(str[i:]))
+	}
+
+	bytes := num * mult
+	// math.MaxUint64 rounds up to 2^64 as a float64, the first value that
+	// no longer fits.
+	if bytes >= math.MaxUint64 {
+		return 0, fmt.Errorf("invalid size %q: value out of range", s)
+	}
+	return uint64(bytes), nil
+}
+
+// FormatSize renders a number of bytes with the largest binary unit that
+// keeps it at or above 1, e.g. "150.0MiB".
+func FormatSize(bytes float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB"}
+	i := 0
+	for bytes >= 1024 && i < len(units)-1 {
+		bytes /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0fB", bytes)
+	}
+	return fmt.Sprintf("%.1f%s", bytes, units[i])
+}
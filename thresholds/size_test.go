@@ -0,0 +1,57 @@
+package thresholds
+
+import (
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want uint64
+	}{
+		{"0", 0},
+		{"1234", 1234},
+		{"512B", 512},
+		{"50k", 50000},
+		{"50K", 50000},
+		{"100MB", 100000000},
+		{"100MiB", 100 << 20},
+		{"500MiB/s", 500 << 20},
+		{"1.5GiB", 3 << 29},
+		{"2 TB", 2000000000000},
+		{"16383PiB", 16383 << 50},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.in)
+		if err != nil {
+			t.Errorf("ParseSize(%q) returned error: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseSizeInvalid(t *testing.T) {
+	for _, in := range []string{"", "MiB", "10XB", "1.2.3k", "-5M", "18446744073709551616", "16384PiB"} {
+		if _, err := ParseSize(in); err == nil {
+			t.Errorf("ParseSize(%q) expected error", in)
+		}
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := map[float64]string{
+		0:         "0B",
+		512:       "512B",
+		1536:      "1.5KiB",
+		100 << 20: "100.0MiB",
+		3 << 40:   "3.0TiB",
+	}
+	for in, want := range tests {
+		if got := FormatSize(in); got != want {
+			t.Errorf("FormatSize(%v) = %q, want %q", in, got, want)
+		}
+	}
+}
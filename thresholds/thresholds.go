@@ -0,0 +1,365 @@
+// Package thresholds evaluates the IO statistics of a device between two
+// samples against warning and critical limits. Limits are given per device
+// pattern as Rules, such as those of the --warn-read-bps and --crit-read-bps
+// flags of check-disk-io, and every limit exceeded is reported as a
+// Violation:
+//
+//	rules, err := thresholds.ParseRules("crit-read-bps", "nvme*:1GiB,default:100MiB", thresholds.SizeLimit)
+//	read, write, _ := thresholds.ByteRates(prev, cur, elapsedMs)
+//	violations := thresholds.EvaluateRules("sda", thresholds.Rates{ReadBpsCrit: rules}, read, write, 0, 0)
+//	state := thresholds.WorstState(violations)
+package thresholds
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sensu/sensu-plugin-sdk/sensu"
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// ByteRateLimits are the read and write throughput limits of one device in
+// bytes per second. Zero means no limit.
+type ByteRateLimits struct {
+	ReadWarn, ReadCrit   uint64
+	WriteWarn, WriteCrit uint64
+}
+
+// DefaultRule is the pattern of the threshold rule for the devices no other
+// rule matches.
+const DefaultRule = "default"
+
+// Rule is one entry of a threshold flag such as --crit-read-bps: the
+// limit for the devices whose kernel name matches Pattern, a path.Match
+// pattern, or for all others when Pattern is DefaultRule.
+type Rule struct {
+	Pattern string
+	Limit   float64
+	// Text is the flag and entry the rule comes from, for messages.
+	Text string
+}
+
+// Rules are the rules of one threshold flag.
+type Rules []Rule
+
+// ParseRules parses the value of a threshold flag, a comma separated
+// list of <pattern>:<limit> entries such as
+// "nvme*:1GiB,sda:50MiB,default:100MiB". An entry without a pattern is the
+// default rule, so a single limit applies to every device. parse converts
+// the limits.
+func ParseRules(flag, value string, parse func(string) (float64, error)) (Rules, error) {
+	if len(strings.TrimSpace(value)) == 0 {
+		return nil, nil
+	}
+	var rules Rules
+	seen := map[string]bool{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		pattern, limit := DefaultRule, entry
+		if i := strings.LastIndex(entry, ":"); i >= 0 {
+			pattern, limit = strings.TrimSpace(entry[:i]), strings.TrimSpace(entry[i+1:])
+		}
+		if _, err := path.Match(pattern, ""); err != nil || len(pattern) == 0 {
+			return nil, fmt.Errorf("%q: invalid device pattern %q", entry, pattern)
+		}
+		if seen[pattern] {
+			return nil, fmt.Errorf("%q: %s given twice", entry, pattern)
+		}
+		seen[pattern] = true
+		n, err := parse(limit)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %v", entry, err)
+		}
+		rules = append(rules, Rule{Pattern: pattern, Limit: n, Text: "--" + flag + " " + entry})
+	}
+	return rules, nil
+}
+
+// limit returns the limit of the first rule matching device, falling back
+// to the default rule, and the text of that rule. It is 0 when no rule
+// applies.
+func (r Rules) limit(device string) (float64, string) {
+	var fallback *Rule
+	for i := range r {
+		if r[i].Pattern == DefaultRule {
+			fallback = &r[i]
+			continue
+		}
+		if ok, _ := path.Match(r[i].Pattern, device); ok {
+			return r[i].Limit, r[i].Text
+		}
+	}
+	if fallback != nil {
+		return fallback.Limit, fallback.Text
+	}
+	return 0, ""
+}
+
+// SizeLimit parses a byte rate limit such as "100MiB".
+func SizeLimit(s string) (float64, error) {
+	n, err := ParseSize(s)
+	return float64(n), err
+}
+
+// CountLimit parses a limit that is a whole number of IOs.
+func CountLimit(s string) (float64, error) {
+	n, err := strconv.ParseUint(s, 10, 64)
+	return float64(n), err
+}
+
+// ParseLimit parses a limit that need not be a whole number, such as an
+// await of 0.5 milliseconds.
+func ParseLimit(s string) (float64, error) {
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(n) || math.IsInf(n, 0) || n < 0 {
+		return 0, fmt.Errorf("%s is not a non-negative number", s)
+	}
+	return n, nil
+}
+
+// CheckRuleOrder returns an error when a warning rule is above the critical
+// rule for the same pattern.
+func CheckRuleOrder(warn, crit Rules) error {
+	for _, w := range warn {
+		for _, c := range crit {
+			if w.Pattern == c.Pattern && w.Limit > 0 && c.Limit > 0 && w.Limit > c.Limit {
+				return fmt.Errorf("%s is above %s", w.Text, c.Text)
+			}
+		}
+	}
+	return nil
+}
+
+// Rates are the rules of the throughput, IOPS, await and queue depth
+// threshold flags.
+type Rates struct {
+	ReadBpsWarn, ReadBpsCrit       Rules
+	WriteBpsWarn, WriteBpsCrit     Rules
+	ReadIopsWarn, ReadIopsCrit     Rules
+	WriteIopsWarn, WriteIopsCrit   Rules
+	ReadAwaitWarn, ReadAwaitCrit   Rules
+	WriteAwaitWarn, WriteAwaitCrit Rules
+	QueueDepthWarn, QueueDepthCrit Rules
+}
+
+// Empty reports whether no threshold flag is set.
+func (t Rates) Empty() bool {
+	for _, r := range []Rules{t.ReadBpsWarn, t.ReadBpsCrit, t.WriteBpsWarn, t.WriteBpsCrit, t.ReadIopsWarn, t.ReadIopsCrit, t.WriteIopsWarn, t.WriteIopsCrit,
+		t.ReadAwaitWarn, t.ReadAwaitCrit, t.WriteAwaitWarn, t.WriteAwaitCrit,
+		t.QueueDepthWarn, t.QueueDepthCrit} {
+		if len(r) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Violation is one limit exceeded by one device.
+type Violation struct {
+	State     int
+	Device    string
+	Direction string
+	Rate      float64
+	Limit     float64
+	// Count is set when Rate and Limit are plain counts, such as the IOs
+	// in flight, rather than byte rates.
+	Count bool
+	// Average is set with Count when Rate is an average, such as the
+	// queue depth, which is shown with one decimal.
+	Average bool
+	// Unit is appended to Rate and Limit when they are in another unit
+	// than bytes per second, such as "ms".
+	Unit string
+	// Rule is the threshold rule that set Limit, if it came from one.
+	Rule string
+}
+
+func (v Violation) String() string {
+	level := "WARNING"
+	if v.State == sensu.CheckStateCritical {
+		level = "CRITICAL"
+	}
+	var msg string
+	switch {
+	case len(v.Unit) > 0:
+		msg = fmt.Sprintf("%s: %s %s %.1f%s exceeds %s%s", level, v.Device, v.Direction, v.Rate, v.Unit, FormatLimit(v.Limit), v.Unit)
+	case v.Count:
+		msg = fmt.Sprintf("%s: %s %s %s exceeds %s", level, v.Device, v.Direction, v.count(), FormatLimit(v.Limit))
+	default:
+		msg = fmt.Sprintf("%s: %s %s %s/s exceeds %s/s", level, v.Device, v.Direction, FormatSize(v.Rate), FormatSize(v.Limit))
+	}
+	if len(v.Rule) > 0 {
+		msg += " (" + v.Rule + ")"
+	}
+	return msg
+}
+
+// Brief renders the violation without its level, with the limit it
+// exceeded, e.g. "nvme0n1 write await 38.0ms (crit 20ms)".
+func (v Violation) Brief() string {
+	limit := "warn"
+	if v.State == sensu.CheckStateCritical {
+		limit = "crit"
+	}
+	switch {
+	case len(v.Unit) > 0:
+		return fmt.Sprintf("%s %s %.1f%s (%s %s%s)", v.Device, v.Direction, v.Rate, v.Unit, limit, FormatLimit(v.Limit), v.Unit)
+	case v.Count:
+		return fmt.Sprintf("%s %s %s (%s %s)", v.Device, v.Direction, v.count(), limit, FormatLimit(v.Limit))
+	default:
+		return fmt.Sprintf("%s %s %s/s (%s %s/s)", v.Device, v.Direction, FormatSize(v.Rate), limit, FormatSize(v.Limit))
+	}
+}
+
+// count renders the Rate of a Count violation.
+func (v Violation) count() string {
+	if v.Average {
+		return fmt.Sprintf("%.1f", v.Rate)
+	}
+	return fmt.Sprintf("%.0f", v.Rate)
+}
+
+// FormatLimit renders a limit without trailing zeros, e.g. "20" or "0.9".
+func FormatLimit(limit float64) string {
+	return strconv.FormatFloat(limit, 'f', -1, 64)
+}
+
+// checkLimit returns the violation of rate against the warning and critical
+// limits, if any.
+func checkLimit(device, direction string, rate float64, warn, crit float64) (Violation, bool) {
+	v := Violation{Device: device, Direction: direction, Rate: rate}
+	switch {
+	case crit > 0 && rate > crit:
+		v.State, v.Limit = sensu.CheckStateCritical, crit
+	case warn > 0 && rate > warn:
+		v.State, v.Limit = sensu.CheckStateWarning, warn
+	default:
+		return v, false
+	}
+	return v, true
+}
+
+// EvaluateLimits returns the violations of the read and write byte rates of
+// a device against its limits.
+func EvaluateLimits(device string, limits ByteRateLimits, readRate, writeRate float64) []Violation {
+	var violations []Violation
+	if v, ok := checkLimit(device, "read", readRate, float64(limits.ReadWarn), float64(limits.ReadCrit)); ok {
+		violations = append(violations, v)
+	}
+	if v, ok := checkLimit(device, "write", writeRate, float64(limits.WriteWarn), float64(limits.WriteCrit)); ok {
+		violations = append(violations, v)
+	}
+	return violations
+}
+
+// checkRules returns the violation of value against the warning and
+// critical rules for device, if any, naming the rule that fired.
+func checkRules(device, direction string, value float64, warn, crit Rules) (Violation, bool) {
+	warnLimit, warnRule := warn.limit(device)
+	critLimit, critRule := crit.limit(device)
+	v, ok := checkLimit(device, direction, value, warnLimit, critLimit)
+	if !ok {
+		return v, false
+	}
+	v.Rule = warnRule
+	if v.State == sensu.CheckStateCritical {
+		v.Rule = critRule
+	}
+	return v, true
+}
+
+// EvaluateRules returns the violations of the byte rates and IOPS of a
+// device against the threshold flags.
+func EvaluateRules(device string, t Rates, readRate, writeRate, readIops, writeIops float64) []Violation {
+	var violations []Violation
+	for _, c := range []struct {
+		direction  string
+		value      float64
+		warn, crit Rules
+		count      bool
+	}{
+		{"read", readRate, t.ReadBpsWarn, t.ReadBpsCrit, false},
+		{"write", writeRate, t.WriteBpsWarn, t.WriteBpsCrit, false},
+		{"read iops", readIops, t.ReadIopsWarn, t.ReadIopsCrit, true},
+		{"write iops", writeIops, t.WriteIopsWarn, t.WriteIopsCrit, true},
+	} {
+		if v, ok := checkRules(device, c.direction, c.value, c.warn, c.crit); ok {
+			v.Count = c.count
+			violations = append(violations, v)
+		}
+	}
+	return violations
+}
+
+// EvaluateAwait returns the violations of the average read and write await
+// of a device between two samples, the milliseconds per completed IO,
+// against the await threshold flags. A direction without completed IOs is
+// not checked.
+func EvaluateAwait(device string, t Rates, prev, cur disk.IOCountersStat) []Violation {
+	var violations []Violation
+	for _, c := range []struct {
+		direction           string
+		prevTime, curTime   uint64
+		prevCount, curCount uint64
+		warn, crit          Rules
+	}{
+		{"read await", prev.ReadTime, cur.ReadTime, prev.ReadCount, cur.ReadCount, t.ReadAwaitWarn, t.ReadAwaitCrit},
+		{"write await", prev.WriteTime, cur.WriteTime, prev.WriteCount, cur.WriteCount, t.WriteAwaitWarn, t.WriteAwaitCrit},
+	} {
+		await, ok := AverageLatency(c.prevTime, c.curTime, c.prevCount, c.curCount)
+		if !ok {
+			continue
+		}
+		if v, ok := checkRules(device, c.direction, await, c.warn, c.crit); ok {
+			v.Unit = "ms"
+			violations = append(violations, v)
+		}
+	}
+	return violations
+}
+
+// EvaluateQueueDepth returns the violation of the average queue depth of a
+// device between two samples, the growth of its weighted IO time divided by
+// the elapsed time, against the --warn-queue-depth and --crit-queue-depth
+// rules. Unlike the number of IOs in flight at the time of a sample, it
+// includes every request queued in between.
+func EvaluateQueueDepth(device string, t Rates, prev, cur disk.IOCountersStat, elapsedMs int64) []Violation {
+	if cur.WeightedIO < prev.WeightedIO || elapsedMs <= 0 {
+		return nil
+	}
+	depth := float64(cur.WeightedIO-prev.WeightedIO) / float64(elapsedMs)
+	v, ok := checkRules(device, "queue depth", depth, t.QueueDepthWarn, t.QueueDepthCrit)
+	if !ok {
+		return nil
+	}
+	v.Count, v.Average = true, true
+	return []Violation{v}
+}
+
+// CheckIopsInProgress returns the violation of the number of IOs in flight
+// on a device against the --iops-warning and --iops-critical thresholds.
+func CheckIopsInProgress(device string, inProgress uint64, warn, crit int) (Violation, bool) {
+	v, ok := checkLimit(device, "iops in progress", float64(inProgress), float64(warn), float64(crit))
+	v.Count = true
+	return v, ok
+}
+
+// WorstState returns the most severe state of the violations, critical
+// first, and sorts them by device for a stable message.
+func WorstState(violations []Violation) int {
+	sort.SliceStable(violations, func(i, j int) bool { return violations[i].Device < violations[j].Device })
+	state := sensu.CheckStateOK
+	for _, v := range violations {
+		if v.State > state {
+			state = v.State
+		}
+	}
+	return state
+}
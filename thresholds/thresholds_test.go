@@ -0,0 +1,195 @@
+package thresholds
+
+import (
+	"testing"
+
+	"github.com/sensu/sensu-plugin-sdk/sensu"
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+func TestEvaluateLimits(t *testing.T) {
+	limits := ByteRateLimits{ReadWarn: 50 << 20, ReadCrit: 100 << 20, WriteCrit: 10 << 20}
+
+	if v := EvaluateLimits("sda", limits, 10<<20, 1<<20); len(v) != 0 {
+		t.Errorf("violations below the limits: %v", v)
+	}
+
+	v := EvaluateLimits("sda", limits, 60<<20, 20<<20)
+	if len(v) != 2 || v[0].State != sensu.CheckStateWarning || v[1].State != sensu.CheckStateCritical {
+		t.Fatalf("violations = %+v", v)
+	}
+	if got, want := v[1].String(), "CRITICAL: sda write 20.0MiB/s exceeds 10.0MiB/s"; got != want {
+		t.Errorf("message = %q, want %q", got, want)
+	}
+	if got := WorstState(v); got != sensu.CheckStateCritical {
+		t.Errorf("WorstState = %d, want critical", got)
+	}
+	if got := WorstState(nil); got != sensu.CheckStateOK {
+		t.Errorf("WorstState(nil) = %d, want OK", got)
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules("crit-read-bps", "nvme*:1GiB, sda:50MiB,default:100MiB", SizeLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for device, want := range map[string]struct {
+		limit float64
+		rule  string
+	}{
+		"nvme0n1": {1 << 30, "--crit-read-bps nvme*:1GiB"},
+		"sda":     {50 << 20, "--crit-read-bps sda:50MiB"},
+		"sdb":     {100 << 20, "--crit-read-bps default:100MiB"},
+	} {
+		if limit, rule := rules.limit(device); limit != want.limit || rule != want.rule {
+			t.Errorf("limit(%s) = %v, %q, want %v, %q", device, limit, rule, want.limit, want.rule)
+		}
+	}
+
+	single, err := ParseRules("warn-read-iops", "1000", CountLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limit, _ := single.limit("sda"); limit != 1000 {
+		t.Errorf("a single value should apply to every device, got %v", limit)
+	}
+	if limit, rule := (Rules{{Pattern: "sda", Limit: 1}}).limit("sdb"); limit != 0 || rule != "" {
+		t.Errorf("limit() without a matching rule = %v, %q", limit, rule)
+	}
+
+	for _, in := range []string{"sda:", "[:10MiB", ":10MiB", "sda:1MiB,sda:2MiB", "10MiB,default:20MiB"} {
+		if _, err := ParseRules("crit-read-bps", in, SizeLimit); err == nil {
+			t.Errorf("ParseRules(%q) expected error", in)
+		}
+	}
+	warn, _ := ParseRules("warn-read-bps", "sda:60MiB", SizeLimit)
+	if err := CheckRuleOrder(warn, rules); err == nil {
+		t.Error("CheckRuleOrder accepted a warning rule above its critical rule")
+	}
+}
+
+func TestEvaluateRules(t *testing.T) {
+	critIops, _ := ParseRules("crit-write-iops", "sd*:2000", CountLimit)
+	warnIops, _ := ParseRules("warn-write-iops", "500", CountLimit)
+	rules := Rates{WriteIopsWarn: warnIops, WriteIopsCrit: critIops}
+
+	if v := EvaluateRules("sda", rules, 1<<30, 1<<30, 0, 500); len(v) != 0 {
+		t.Errorf("violations below the limits: %v", v)
+	}
+
+	v := EvaluateRules("sda", rules, 0, 0, 0, 2500)
+	if len(v) != 1 || v[0].State != sensu.CheckStateCritical {
+		t.Fatalf("violations = %+v", v)
+	}
+	if got, want := v[0].String(), "CRITICAL: sda write iops 2500 exceeds 2000 (--crit-write-iops sd*:2000)"; got != want {
+		t.Errorf("message = %q, want %q", got, want)
+	}
+	if v := EvaluateRules("nvme0n1", rules, 0, 0, 0, 2500); len(v) != 1 || v[0].State != sensu.CheckStateWarning {
+		t.Errorf("nvme0n1 violations = %+v, want a warning from the default rule", v)
+	}
+}
+
+func TestEvaluateAwait(t *testing.T) {
+	rules := Rates{
+		ReadAwaitWarn:  Rules{{Pattern: DefaultRule, Limit: 10, Text: "10"}},
+		WriteAwaitCrit: Rules{{Pattern: "sd*", Limit: 50, Text: "sd*:50"}},
+	}
+	prev := disk.IOCountersStat{ReadCount: 100, ReadTime: 1000, WriteCount: 10, WriteTime: 100}
+	cur := disk.IOCountersStat{ReadCount: 200, ReadTime: 2500, WriteCount: 20, WriteTime: 700}
+	got := EvaluateAwait("sda", rules, prev, cur)
+	if len(got) != 2 {
+		t.Fatalf("EvaluateAwait = %+v, want 2 violations", got)
+	}
+	if want := "WARNING: sda read await 15.0ms exceeds 10ms (10)"; got[0].String() != want {
+		t.Errorf("message = %q, want %q", got[0].String(), want)
+	}
+	if got[1].State != sensu.CheckStateCritical || got[1].Direction != "write await" {
+		t.Errorf("violation = %+v, want critical write await", got[1])
+	}
+	if got := EvaluateAwait("nvme0n1", rules, prev, cur); len(got) != 1 {
+		t.Errorf("EvaluateAwait(nvme0n1) = %+v, want only the read violation", got)
+	}
+	idle := prev
+	idle.ReadTime += 5000
+	if got := EvaluateAwait("sda", rules, prev, idle); len(got) != 0 {
+		t.Errorf("EvaluateAwait without completed IOs = %+v, want none", got)
+	}
+
+	fast, err := ParseRules("warn-read-await-ms", "nvme*:0.5", ParseLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 80ms over 100 reads is an await of 0.8ms.
+	got = EvaluateAwait("nvme0n1", Rates{ReadAwaitWarn: fast}, prev, disk.IOCountersStat{ReadCount: 200, ReadTime: 1080})
+	if want := "WARNING: nvme0n1 read await 0.8ms exceeds 0.5ms (--warn-read-await-ms nvme*:0.5)"; len(got) != 1 || got[0].String() != want {
+		t.Errorf("EvaluateAwait with a fractional limit = %+v, want %q", got, want)
+	}
+}
+
+func TestParseLimit(t *testing.T) {
+	for in, want := range map[string]float64{"20": 20, "0.5": 0.5, "0": 0, "1e1": 10} {
+		if got, err := ParseLimit(in); err != nil || got != want {
+			t.Errorf("ParseLimit(%q) = %v, %v, want %v", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "-1", "NaN", "Inf", "+Inf", "10ms"} {
+		if got, err := ParseLimit(in); err == nil {
+			t.Errorf("ParseLimit(%q) = %v, expected error", in, got)
+		}
+	}
+}
+
+func TestEvaluateQueueDepth(t *testing.T) {
+	rules := Rates{
+		QueueDepthWarn: Rules{{Pattern: DefaultRule, Limit: 8, Text: "--warn-queue-depth 8"}},
+		QueueDepthCrit: Rules{{Pattern: DefaultRule, Limit: 32, Text: "--crit-queue-depth 32"}},
+	}
+	prev := disk.IOCountersStat{WeightedIO: 1000}
+	// 24 seconds of weighted IO time in 2 seconds is a depth of 12.
+	got := EvaluateQueueDepth("sda", rules, prev, disk.IOCountersStat{WeightedIO: 25000}, 2000)
+	if len(got) != 1 {
+		t.Fatalf("EvaluateQueueDepth = %+v, want 1 violation", got)
+	}
+	if want := "WARNING: sda queue depth 12.0 exceeds 8 (--warn-queue-depth 8)"; got[0].String() != want {
+		t.Errorf("message = %q, want %q", got[0].String(), want)
+	}
+	if got := EvaluateQueueDepth("sda", rules, prev, disk.IOCountersStat{WeightedIO: 3000}, 2000); len(got) != 0 {
+		t.Errorf("EvaluateQueueDepth at depth 1 = %+v, want none", got)
+	}
+	if got := EvaluateQueueDepth("sda", rules, prev, disk.IOCountersStat{}, 2000); len(got) != 0 {
+		t.Errorf("EvaluateQueueDepth after a reset = %+v, want none", got)
+	}
+
+	light, err := ParseRules("warn-queue-depth", "1.5", ParseLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 3.8 seconds of weighted IO time in 2 seconds is a depth of 1.9.
+	got = EvaluateQueueDepth("sda", Rates{QueueDepthWarn: light}, prev, disk.IOCountersStat{WeightedIO: 4800}, 2000)
+	if want := "WARNING: sda queue depth 1.9 exceeds 1.5 (--warn-queue-depth 1.5)"; len(got) != 1 || got[0].String() != want {
+		t.Errorf("EvaluateQueueDepth with a fractional limit = %+v, want %q", got, want)
+	}
+	if _, err := ParseRules("crit-queue-depth", "sda:-1", ParseLimit); err == nil {
+		t.Error("ParseRules accepted a negative queue depth")
+	}
+}
+
+func TestCheckIopsInProgress(t *testing.T) {
+	if _, ok := CheckIopsInProgress("sda", 8, 16, 32); ok {
+		t.Errorf("8 IOs in flight should not violate 16/32")
+	}
+	v, ok := CheckIopsInProgress("sda", 20, 16, 32)
+	if !ok || v.State != sensu.CheckStateWarning {
+		t.Fatalf("violation = %+v, %v, want warning", v, ok)
+	}
+	if got, want := v.String(), "WARNING: sda iops in progress 20 exceeds 16"; got != want {
+		t.Errorf("message = %q, want %q", got, want)
+	}
+	if v, ok := CheckIopsInProgress("sda", 40, 0, 32); !ok || v.State != sensu.CheckStateCritical {
+		t.Errorf("violation = %+v, %v, want critical", v, ok)
+	}
+	if _, ok := CheckIopsInProgress("sda", 1000, 0, 0); ok {
+		t.Errorf("zero thresholds should disable the check")
+	}
+}
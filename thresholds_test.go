@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/jadiunr/check-disk-io/thresholds"
+)
+
+func TestParseDeviceThreshold(t *testing.T) {
+	device, limits, err := parseDeviceThreshold("sda:write-crit=100MiB,read-warn=50MiB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := thresholds.ByteRateLimits{ReadWarn: 50 << 20, WriteCrit: 100 << 20}
+	if device != "sda" || limits != want {
+		t.Errorf("got %q %+v, want sda %+v", device, limits, want)
+	}
+
+	if device, _, err := parseDeviceThreshold("/dev/nvme0n1:read-crit=1GiB"); err != nil || device != "nvme0n1" {
+		t.Errorf("path device = %q, %v, want nvme0n1", device, err)
+	}
+}
+
+func TestParseDeviceThresholdInvalid(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"sda",
+		"sda:",
+		":read-warn=1MiB",
+		"sda:read-warn",
+		"sda:read-warn=fast",
+		"sda:iops-warn=100",
+		"sda:read-warn=1MiB,read-warn=2MiB",
+		"sda:write-warn=200MiB,write-crit=100MiB",
+	} {
+		if _, _, err := parseDeviceThreshold(in); err == nil {
+			t.Errorf("parseDeviceThreshold(%q) expected error", in)
+		}
+	}
+}
+
+func TestJoinThresholdEntries(t *testing.T) {
+	got := joinThresholdEntries([]string{"sda:write-crit=100MiB", "read-warn=50MiB", "sdb:read-crit=1GiB"})
+	want := []string{"sda:write-crit=100MiB,read-warn=50MiB", "sdb:read-crit=1GiB"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("joinThresholdEntries = %q, want %q", got, want)
+	}
+}
+
+func TestSuggestThresholds(t *testing.T) {
+	var reads, writes []float64
+	for i := 1; i <= 20; i++ {
+		reads = append(reads, float64(i<<20))
+		writes = append(writes, 0)
+	}
+	if _, ok := suggestThresholds("sda", reads[:suggestMinSamples-1], writes[:suggestMinSamples-1]); ok {
+		t.Errorf("suggestion made from too short a history")
+	}
+
+	// p95 of 1..20 MiB/s is 19MiB/s.
+	got, ok := suggestThresholds("sda", reads, writes)
+	want := "sda:read-warn=28.5MiB,read-crit=57.0MiB"
+	if !ok || got != want {
+		t.Errorf("suggestThresholds = %q, %v, want %q", got, ok, want)
+	}
+	if _, _, err := parseDeviceThreshold(got); err != nil {
+		t.Errorf("suggestion is not a valid --device-threshold: %v", err)
+	}
+}
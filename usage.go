@@ -0,0 +1,42 @@
+package main
+
+import (
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// filesystemUsage is the source of --with-usage, replaceable in tests.
+var filesystemUsage = disk.Usage
+
+// usageGroups are the metric groups of --with-usage with the value of each.
+// Percentages are floats, everything else exact integers. Free space is
+// what unprivileged users can still allocate, as df reports it.
+var usageGroups = []struct {
+	Name    string
+	Comment string
+	Int     func(*disk.UsageStat) uint64
+	Percent func(*disk.UsageStat) float64
+}{
+	{"disk_total_bytes", "This value is the size in bytes of the filesystem mounted at the mountpoint.", func(u *disk.UsageStat) uint64 { return u.Total }, nil},
+	{"disk_used_bytes", "This value is the number of bytes used on the filesystem mounted at the mountpoint.", func(u *disk.UsageStat) uint64 { return u.Used }, nil},
+	{"disk_free_bytes", "This value is the number of bytes available to unprivileged users on the filesystem mounted at the mountpoint.", func(u *disk.UsageStat) uint64 { return u.Free }, nil},
+	{"disk_used_percent", "This value is the share of the space available to unprivileged users that is used, in percent, as df reports it.", nil, func(u *disk.UsageStat) float64 { return u.UsedPercent }},
+	{"disk_inodes_total", "This value is the number of inodes of the filesystem mounted at the mountpoint.", func(u *disk.UsageStat) uint64 { return u.InodesTotal }, nil},
+	{"disk_inodes_used", "This value is the number of inodes used on the filesystem mounted at the mountpoint.", func(u *disk.UsageStat) uint64 { return u.InodesUsed }, nil},
+	{"disk_inodes_free", "This value is the number of free inodes of the filesystem mounted at the mountpoint.", func(u *disk.UsageStat) uint64 { return u.InodesFree }, nil},
+	{"disk_inodes_used_percent", "This value is the share of the inodes of the filesystem that are used, in percent.", nil, func(u *disk.UsageStat) float64 { return u.InodesUsedPercent }},
+}
+
+// addUsageMetrics adds the usage of one filesystem to the --with-usage
+// groups present in groups.
+func addUsageMetrics(groups map[string]*MetricGroup, tags map[string]string, u *disk.UsageStat) {
+	for _, g := range usageGroups {
+		mg, ok := groups[g.Name]
+		switch {
+		case !ok:
+		case g.Int != nil:
+			mg.AddIntMetric(tags, g.Int(u))
+		default:
+			mg.AddMetric(tags, g.Percent(u))
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+func TestAddUsageMetrics(t *testing.T) {
+	groups := map[string]*MetricGroup{}
+	for _, g := range usageGroups {
+		if g.Name != "disk_inodes_free" {
+			groups[g.Name] = &MetricGroup{Name: g.Name}
+		}
+	}
+	u := &disk.UsageStat{Total: 1000, Used: 600, Free: 350, UsedPercent: 63.2, InodesTotal: 100, InodesUsed: 10, InodesFree: 90, InodesUsedPercent: 10}
+	addUsageMetrics(groups, map[string]string{"mountpoint": "/"}, u)
+	if m := groups["disk_used_bytes"].Metrics; len(m) != 1 || !m[0].IsInt || m[0].IntValue != 600 {
+		t.Errorf("disk_used_bytes = %+v, want the exact integer 600", m)
+	}
+	if m := groups["disk_used_percent"].Metrics; len(m) != 1 || m[0].IsInt || m[0].Value != 63.2 {
+		t.Errorf("disk_used_percent = %+v, want 63.2", m)
+	}
+	if _, ok := groups["disk_inodes_free"]; ok {
+		t.Errorf("addUsageMetrics() created a group that was not requested")
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// windowSample is one run's counters kept in the state file for
+// --rate-window, keyed by metric group name.
+type windowSample struct {
+	Time   int64             `json:"t"` // unix milliseconds
+	Values map[string]uint64 `json:"v"`
+}
+
+// updateWindow appends cur to the history and prunes samples that are no
+// longer needed: everything older than the window except the newest such
+// sample, which anchors the interpolation at the start of the window. If
+// any counter went backwards the device was reset and the history starts
+// over from cur.
+func updateWindow(history []windowSample, cur windowSample, window time.Duration) []windowSample {
+	if n := len(history); n > 0 {
+		for name, v := range cur.Values {
+			if v < history[n-1].Values[name] {
+				return []windowSample{cur}
+			}
+		}
+	}
+	history = append(history, cur)
+
+	start := cur.Time - window.Milliseconds()
+	first := 0
+	for i, s := range history {
+		if s.Time <= start {
+			first = i
+		}
+	}
+	return history[first:]
+}
+
+// windowRate returns the per-second rate of the named counter over the
+// window ending at the newest sample. The counter value at the start of the
+// window is interpolated between the samples around it; when the history
+// does not reach back that far yet, the oldest sample is used instead. ok
+// is false while there are fewer than two samples.
+func windowRate(history []windowSample, name string, window time.Duration) (rate float64, ok bool) {
+	if len(history) < 2 {
+		return 0, false
+	}
+	last := history[len(history)-1]
+	start := last.Time - window.Milliseconds()
+
+	base := history[0]
+	baseTime := float64(base.Time)
+	baseValue := float64(base.Values[name])
+	if base.Time < start {
+		next := history[1]
+		frac := float64(start-base.Time) / float64(next.Time-base.Time)
+		baseValue += (float64(next.Values[name]) - baseValue) * frac
+		baseTime = float64(start)
+	}
+
+	elapsed := (float64(last.Time) - baseTime) / 1000
+	if elapsed <= 0 {
+		return 0, false
+	}
+	return (float64(last.Values[name]) - baseValue) / elapsed, true
+}
+
+// windowSuffix renders a window as a compact metric name suffix such as
+// 5m, 1h or 90s.
+func windowSuffix(window time.Duration) string {
+	switch {
+	case window%time.Hour == 0:
+		return fmt.Sprintf("%dh", window/time.Hour)
+	case window%time.Minute == 0:
+		return fmt.Sprintf("%dm", window/time.Minute)
+	default:
+		return fmt.Sprintf("%ds", window/time.Second)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func sample(sec int64, readBytes uint64) windowSample {
+	return windowSample{Time: sec * 1000, Values: map[string]uint64{"disk_read_bytes": readBytes}}
+}
+
+func TestUpdateWindowPrunes(t *testing.T) {
+	var h []windowSample
+	for i := int64(0); i <= 10; i++ {
+		h = updateWindow(h, sample(i*60, uint64(i)*6000), 5*time.Minute)
+	}
+	// 600s is the newest sample, the window starts at 300s: samples
+	// 300..600 are kept, 300 itself being the anchor.
+	if len(h) != 6 || h[0].Time != 300000 {
+		t.Errorf("kept %d samples starting at %d, want 6 starting at 300000", len(h), h[0].Time)
+	}
+}
+
+func TestUpdateWindowReset(t *testing.T) {
+	h := []windowSample{sample(0, 100), sample(60, 200)}
+	h = updateWindow(h, sample(120, 50), 5*time.Minute)
+	if len(h) != 1 || h[0].Values["disk_read_bytes"] != 50 {
+		t.Errorf("history after reset = %+v, want only the new sample", h)
+	}
+}
+
+func TestWindowRate(t *testing.T) {
+	if _, ok := windowRate([]windowSample{sample(0, 0)}, "disk_read_bytes", time.Minute); ok {
+		t.Errorf("a single sample must not produce a rate")
+	}
+
+	// Shorter history than the window: rate over what is available.
+	h := []windowSample{sample(0, 0), sample(60, 6000)}
+	if r, ok := windowRate(h, "disk_read_bytes", 5*time.Minute); !ok || r != 100 {
+		t.Errorf("rate = %v, %v, want 100", r, ok)
+	}
+
+	// The window starts halfway between the first two samples: the start
+	// value is interpolated to 3000 and the rate is (12000-3000)/90s.
+	h = []windowSample{sample(0, 0), sample(60, 6000), sample(120, 12000)}
+	if r, ok := windowRate(h, "disk_read_bytes", 90*time.Second); !ok || r != 100 {
+		t.Errorf("interpolated rate = %v, %v, want 100", r, ok)
+	}
+}
+
+func TestWindowSuffix(t *testing.T) {
+	tests := map[time.Duration]string{
+		5 * time.Minute:  "5m",
+		time.Hour:        "1h",
+		90 * time.Second: "90s",
+	}
+	for in, want := range tests {
+		if got := windowSuffix(in); got != want {
+			t.Errorf("windowSuffix(%v) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// zpoolTimeout bounds every zpool invocation of --zfs, so a pool stuck in
+// a failing device cannot hang the check.
+const zpoolTimeout = 10 * time.Second
+
+// runZpool runs the zpool command with args and returns its output.
+func runZpool(command string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), zpoolTimeout)
+	defer cancel()
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, command, args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); len(msg) > 0 {
+			return nil, fmt.Errorf("%s %s: %v: %s", command, strings.Join(args, " "), err, msg)
+		}
+		return nil, fmt.Errorf("%s %s: %v", command, strings.Join(args, " "), err)
+	}
+	return out, nil
+}
+
+// zfsVdevIO is one line of zpool iostat -Hpv: the average operations and
+// bytes per second of a pool or one of its vdevs since the pool was
+// imported.
+type zfsVdevIO struct {
+	// Vdev is empty for the line of the pool itself.
+	Vdev       string
+	ReadOps    float64
+	WriteOps   float64
+	ReadBytes  float64
+	WriteBytes float64
+}
+
+// parseZpoolIostat parses the output of zpool iostat -Hpv for one pool:
+//
+//	tank	1081344	10736336896	2	5	81920	163840
+//	mirror-0	1081344	10736336896	2	5	81920	163840
+//	sda	-	-	1	2	40960	81920
+//
+// The first line is the pool, the others its vdevs, without indentation in
+// scripted mode. Class headers such as "logs" carry no numbers and are
+// skipped.
+func parseZpoolIostat(out []byte) []zfsVdevIO {
+	var stats []zfsVdevIO
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	first := true
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 7 {
+			continue
+		}
+		var values [4]float64
+		ok := true
+		for i := range values {
+			v, err := strconv.ParseFloat(strings.TrimSpace(fields[3+i]), 64)
+			if err != nil {
+				ok = false
+				break
+			}
+			values[i] = v
+		}
+		if !ok {
+			continue
+		}
+		s := zfsVdevIO{ReadOps: values[0], WriteOps: values[1], ReadBytes: values[2], WriteBytes: values[3]}
+		if !first {
+			s.Vdev = strings.TrimSpace(fields[0])
+		}
+		first = false
+		stats = append(stats, s)
+	}
+	return stats
+}
+
+// zfsLatencyBucket is one row of zpool iostat -Hpw: how many reads and
+// writes since the pool was imported took at most UpperNs nanoseconds, in
+// total and at the disk.
+type zfsLatencyBucket struct {
+	UpperNs    uint64
+	TotalRead  uint64
+	TotalWrite uint64
+	DiskRead   uint64
+	DiskWrite  uint64
+}
+
+// parseZpoolHistogram parses the output of zpool iostat -Hpw for one pool.
+// Every bucket row starts with its upper bound in nanoseconds, followed by
+// the read and write counts of the total_wait, disk_wait, syncq_wait and
+// asyncq_wait histograms and further columns that depend on the OpenZFS
+// version; only total_wait and disk_wait are kept.
+func parseZpoolHistogram(out []byte) []zfsLatencyBucket {
+	var buckets []zfsLatencyBucket
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		var values [5]uint64
+		ok := true
+		for i := range values {
+			v, err := strconv.ParseUint(fields[i], 10, 64)
+			if err != nil {
+				ok = false
+				break
+			}
+			values[i] = v
+		}
+		if !ok {
+			continue
+		}
+		buckets = append(buckets, zfsLatencyBucket{UpperNs: values[0], TotalRead: values[1], TotalWrite: values[2], DiskRead: values[3], DiskWrite: values[4]})
+	}
+	return buckets
+}
+
+// zfsPool is what --zfs read for one pool.
+type zfsPool struct {
+	Name    string
+	IO      []zfsVdevIO
+	Latency []zfsLatencyBucket
+}
+
+// zfsPools reads the IO statistics and latency histograms of every
+// imported pool with the given zpool command.
+func zfsPools(command string) ([]zfsPool, error) {
+	out, err := runZpool(command, "list", "-Hpo", "name")
+	if err != nil {
+		return nil, err
+	}
+	var pools []zfsPool
+	for _, name := range strings.Fields(string(out)) {
+		pool := zfsPool{Name: name}
+		out, err := runZpool(command, "iostat", "-Hpv", name)
+		if err != nil {
+			return pools, err
+		}
+		pool.IO = parseZpoolIostat(out)
+		out, err = runZpool(command, "iostat", "-Hpw", name)
+		if err != nil {
+			return pools, err
+		}
+		pool.Latency = parseZpoolHistogram(out)
+		pools = append(pools, pool)
+	}
+	return pools, nil
+}
+
+// zfsIOGroups are the --zfs groups of zpool iostat -v with the value of each.
+var zfsIOGroups = []struct {
+	Name    string
+	Comment string
+	Value   func(zfsVdevIO) float64
+}{
+	{"disk_zfs_read_ops_per_sec", "This value is the average number of read operations per second of the pool or vdev since the pool was imported.", func(s zfsVdevIO) float64 { return s.ReadOps }},
+	{"disk_zfs_write_ops_per_sec", "This value is the average number of write operations per second of the pool or vdev since the pool was imported.", func(s zfsVdevIO) float64 { return s.WriteOps }},
+	{"disk_zfs_read_bytes_per_sec", "This value is the average number of bytes read per second from the pool or vdev since the pool was imported.", func(s zfsVdevIO) float64 { return s.ReadBytes }},
+	{"disk_zfs_write_bytes_per_sec", "This value is the average number of bytes written per second to the pool or vdev since the pool was imported.", func(s zfsVdevIO) float64 { return s.WriteBytes }},
+}
+
+// addZFSMetrics adds the samples of pools to the --zfs groups. The latency
+// buckets are made cumulative, as a Prometheus histogram expects, with le
+// holding the upper bound in seconds.
+func addZFSMetrics(groups map[string]*MetricGroup, pools []zfsPool) {
+	for _, p := range pools {
+		for _, s := range p.IO {
+			tags := map[string]string{"pool": p.Name}
+			if len(s.Vdev) > 0 {
+				tags["vdev"] = s.Vdev
+			}
+			for _, g := range zfsIOGroups {
+				groups[g.Name].AddMetric(tags, g.Value(s))
+			}
+		}
+		var cum zfsLatencyBucket
+		for i, b := range p.Latency {
+			cum.TotalRead += b.TotalRead
+			cum.TotalWrite += b.TotalWrite
+			cum.DiskRead += b.DiskRead
+			cum.DiskWrite += b.DiskWrite
+			le := strconv.FormatFloat(float64(b.UpperNs)/1e9, 'g', -1, 64)
+			if i == len(p.Latency)-1 {
+				le = "+Inf"
+			}
+			for _, w := range []struct {
+				wait        string
+				read, write uint64
+			}{{"total", cum.TotalRead, cum.TotalWrite}, {"disk", cum.DiskRead, cum.DiskWrite}} {
+				tags := map[string]string{"pool": p.Name, "wait": w.wait, "le": le}
+				groups["disk_zfs_read_latency_seconds_bucket"].AddIntMetric(tags, w.read)
+				groups["disk_zfs_write_latency_seconds_bucket"].AddIntMetric(tags, w.write)
+			}
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseZpoolIostat(t *testing.T) {
+	out := []byte("tank\t1081344\t10736336896\t2\t5\t81920\t163840\n" +
+		"mirror-0\t1081344\t10736336896\t2\t5\t81920\t163840\n" +
+		"sda\t-\t-\t1\t2\t40960\t81920\n" +
+		"logs\t-\t-\t-\t-\t-\t-\n" +
+		"nvme0n1\t-\t-\t0\t9\t0\t36864\n")
+	want := []zfsVdevIO{
+		{ReadOps: 2, WriteOps: 5, ReadBytes: 81920, WriteBytes: 163840},
+		{Vdev: "mirror-0", ReadOps: 2, WriteOps: 5, ReadBytes: 81920, WriteBytes: 163840},
+		{Vdev: "sda", ReadOps: 1, WriteOps: 2, ReadBytes: 40960, WriteBytes: 81920},
+		{Vdev: "nvme0n1", WriteOps: 9, WriteBytes: 36864},
+	}
+	if got := parseZpoolIostat(out); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseZpoolIostat() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseZpoolHistogram(t *testing.T) {
+	out := []byte("tank\n1\t0\t0\t0\t0\t0\t0\t0\t0\t0\t0\n1023\t5\t1\t4\t1\t0\t0\t0\t0\t0\t0\n1048575\t2\t3\t1\t3\t0\t0\t0\t0\t0\t0\n")
+	want := []zfsLatencyBucket{
+		{UpperNs: 1},
+		{UpperNs: 1023, TotalRead: 5, TotalWrite: 1, DiskRead: 4, DiskWrite: 1},
+		{UpperNs: 1048575, TotalRead: 2, TotalWrite: 3, DiskRead: 1, DiskWrite: 3},
+	}
+	if got := parseZpoolHistogram(out); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseZpoolHistogram() = %+v, want %+v", got, want)
+	}
+}
+
+func TestAddZFSMetrics(t *testing.T) {
+	groups := map[string]*MetricGroup{}
+	for _, g := range zfsIOGroups {
+		groups[g.Name] = &MetricGroup{Name: g.Name}
+	}
+	groups["disk_zfs_read_latency_seconds_bucket"] = &MetricGroup{}
+	groups["disk_zfs_write_latency_seconds_bucket"] = &MetricGroup{}
+	addZFSMetrics(groups, []zfsPool{{
+		Name: "tank",
+		IO:   []zfsVdevIO{{ReadOps: 2}, {Vdev: "sda", ReadOps: 1}},
+		Latency: []zfsLatencyBucket{
+			{UpperNs: 1023, TotalRead: 5, DiskRead: 4},
+			{UpperNs: 1048575, TotalRead: 2, DiskRead: 1},
+		},
+	}})
+	ops := groups["disk_zfs_read_ops_per_sec"].Metrics
+	if len(ops) != 2 || ops[0].Tags["vdev"] != "" || ops[1].Tags["vdev"] != "sda" || ops[1].Value != 1 {
+		t.Errorf("disk_zfs_read_ops_per_sec = %+v", ops)
+	}
+	got := map[string]uint64{}
+	for _, m := range groups["disk_zfs_read_latency_seconds_bucket"].Metrics {
+		got[m.Tags["wait"]+" "+m.Tags["le"]] = m.IntValue
+	}
+	want := map[string]uint64{"total 1.023e-06": 5, "total +Inf": 7, "disk 1.023e-06": 4, "disk +Inf": 5}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("read latency buckets = %v, want %v", got, want)
+	}
+}